@@ -0,0 +1,401 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"pub-sub/models"
+	"pub-sub/utils"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Options configures a benchmark run
+type Options struct {
+	URL         string        // Base URL of the target broker
+	Topic       string        // Topic to publish to and subscribe on
+	Publishers  int           // Number of publishing WebSocket connections
+	Subscribers int           // Number of subscribing WebSocket connections
+	Rate        int           // Total publish rate in messages per second (0 = unthrottled)
+	PayloadSize int           // Payload padding in bytes
+	Duration    time.Duration // How long publishers run
+	Drain       time.Duration // How long to wait for in-flight deliveries after publishing stops
+	APIKey      string        // Optional API key sent with every connection
+}
+
+// Result holds the measurements of a benchmark run
+type Result struct {
+	Elapsed       time.Duration
+	Sent          int64            // Publish requests sent
+	Acked         int64            // Publish requests acknowledged
+	Rejected      int64            // Publish requests rejected by the broker
+	Received      int64            // Events received across all subscribers
+	Expected      int64            // Acked messages times subscribers
+	SlowConsumer  int64            // SLOW_CONSUMER errors received by subscribers
+	Disconnected  int64            // Subscribers disconnected before the run ended
+	RejectReasons map[string]int64 // Rejections by error code
+	Latencies     []time.Duration  // End-to-end latencies, sorted
+}
+
+// benchPayload is the payload of every benchmark message
+type benchPayload struct {
+	SentAt int64  `json:"sent_at"` // Publish time in Unix nanoseconds
+	Data   string `json:"data"`    // Padding to reach the requested payload size
+}
+
+// Run parses command-line arguments, runs a benchmark and writes the report to out
+func Run(args []string, out io.Writer) error {
+	opts := Options{}
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.StringVar(&opts.URL, "url", "http://localhost:8080", "base URL of the target broker")
+	flags.StringVar(&opts.Topic, "topic", "bench", "topic to publish to and subscribe on")
+	flags.IntVar(&opts.Publishers, "publishers", 2, "number of publisher connections")
+	flags.IntVar(&opts.Subscribers, "subscribers", 4, "number of subscriber connections")
+	flags.IntVar(&opts.Rate, "rate", 1000, "total publish rate in messages per second (0 = unthrottled)")
+	flags.IntVar(&opts.PayloadSize, "size", 256, "payload size in bytes")
+	flags.DurationVar(&opts.Duration, "duration", 10*time.Second, "how long to publish")
+	flags.DurationVar(&opts.Drain, "drain", 2*time.Second, "how long to wait for deliveries after publishing stops")
+	flags.StringVar(&opts.APIKey, "api-key", "", "API key sent with every connection")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := Execute(opts)
+	if err != nil {
+		return err
+	}
+	result.Report(out, opts)
+	return nil
+}
+
+// Execute runs a benchmark against a broker
+func Execute(opts Options) (*Result, error) {
+	if opts.Publishers <= 0 || opts.Subscribers < 0 || opts.Rate < 0 || opts.PayloadSize < 0 || opts.Duration <= 0 {
+		return nil, errors.New("publishers and duration must be positive; subscribers, rate and size must not be negative")
+	}
+
+	if err := createTopic(opts); err != nil {
+		return nil, err
+	}
+
+	run := &run{opts: opts, rejectReasons: make(map[string]int64)}
+
+	// Subscribers are connected and acknowledged before publishing starts
+	subscribers := make([]*websocket.Conn, 0, opts.Subscribers)
+	defer func() {
+		for _, conn := range subscribers {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < opts.Subscribers; i++ {
+		conn, err := run.subscribe(i)
+		if err != nil {
+			return nil, fmt.Errorf("subscriber %d: %w", i, err)
+		}
+		subscribers = append(subscribers, conn)
+	}
+
+	publishers := make([]*websocket.Conn, 0, opts.Publishers)
+	defer func() {
+		for _, conn := range publishers {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < opts.Publishers; i++ {
+		conn, err := run.dial()
+		if err != nil {
+			return nil, fmt.Errorf("publisher %d: %w", i, err)
+		}
+		publishers = append(publishers, conn)
+	}
+
+	var readers sync.WaitGroup
+	for _, conn := range subscribers {
+		readers.Add(1)
+		go run.readEvents(conn, &readers)
+	}
+	for _, conn := range publishers {
+		readers.Add(1)
+		go run.readAcks(conn, &readers)
+	}
+
+	start := time.Now()
+	var publishing sync.WaitGroup
+	for i, conn := range publishers {
+		publishing.Add(1)
+		go run.publish(i, conn, &publishing)
+	}
+	publishing.Wait()
+	elapsed := time.Since(start)
+
+	// Let in-flight deliveries arrive, then stop the readers
+	time.Sleep(opts.Drain)
+	run.stopping.Store(true)
+	for _, conn := range append(subscribers, publishers...) {
+		conn.Close()
+	}
+	readers.Wait()
+
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	sort.Slice(run.latencies, func(i, j int) bool { return run.latencies[i] < run.latencies[j] })
+
+	acked := run.acked.Load()
+	return &Result{
+		Elapsed:       elapsed,
+		Sent:          run.sent.Load(),
+		Acked:         acked,
+		Rejected:      run.rejected.Load(),
+		Received:      int64(len(run.latencies)),
+		Expected:      acked * int64(opts.Subscribers),
+		SlowConsumer:  run.slowConsumer.Load(),
+		Disconnected:  run.disconnected.Load(),
+		RejectReasons: run.rejectReasons,
+		Latencies:     run.latencies,
+	}, nil
+}
+
+// run holds the shared counters of a benchmark in progress
+type run struct {
+	opts          Options
+	sent          atomic.Int64
+	acked         atomic.Int64
+	rejected      atomic.Int64
+	slowConsumer  atomic.Int64
+	disconnected  atomic.Int64
+	stopping      atomic.Bool // Set once connections are closed on purpose
+	latencies     []time.Duration
+	rejectReasons map[string]int64
+	mutex         sync.Mutex // Protects latencies and rejectReasons
+}
+
+// dial opens a WebSocket connection to the broker. A handshake rejected by the
+// broker's connection quota is reported with a hint, since every connection counts
+// against the quota of the benchmark's identity.
+func (r *run) dial() (*websocket.Conn, error) {
+	wsURL, err := url.Parse(r.opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	wsURL.Scheme = strings.Replace(wsURL.Scheme, "http", "ws", 1)
+	wsURL.Path = strings.TrimSuffix(wsURL.Path, "/") + "/ws"
+
+	header := http.Header{}
+	if r.opts.APIKey != "" {
+		header.Set("X-API-Key", r.opts.APIKey)
+	}
+	conn, response, err := websocket.DefaultDialer.Dial(wsURL.String(), header)
+	if errors.Is(err, websocket.ErrBadHandshake) && response != nil && response.StatusCode == http.StatusTooManyRequests {
+		var rejection struct {
+			Error models.Error `json:"error"`
+		}
+		if json.NewDecoder(response.Body).Decode(&rejection) == nil && rejection.Error.Code == "QUOTA_EXCEEDED" {
+			return nil, fmt.Errorf("%w: connection quota exceeded with %d publishers and subscribers; raise MAX_CONNECTIONS_PER_CLIENT on the broker, "+
+				"or pass -api-key with a key from API_KEYS so other clients on this host do not share the quota", err, r.opts.Publishers+r.opts.Subscribers)
+		}
+	}
+	return conn, err
+}
+
+// subscribe opens a connection and waits for its subscription to be acknowledged
+func (r *run) subscribe(index int) (*websocket.Conn, error) {
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	request := models.ClientMessage{
+		Type:      "subscribe",
+		Topic:     r.opts.Topic,
+		ClientID:  fmt.Sprintf("bench-subscriber-%d", index),
+		RequestID: utils.GenerateRequestID(),
+	}
+	if err := conn.WriteJSON(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var response models.ServerMessage
+		if err := conn.ReadJSON(&response); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		switch {
+		case response.Type == "ack" && response.RequestID == request.RequestID:
+			return conn, nil
+		case response.Type == "error" && response.RequestID == request.RequestID:
+			conn.Close()
+			return nil, fmt.Errorf("subscribe rejected: %s", response.Error.Code)
+		}
+	}
+}
+
+// publish sends messages at the publisher's share of the total rate until the duration ends
+func (r *run) publish(index int, conn *websocket.Conn, done *sync.WaitGroup) {
+	defer done.Done()
+
+	var ticker *time.Ticker
+	if r.opts.Rate > 0 {
+		interval := time.Duration(float64(time.Second) * float64(r.opts.Publishers) / float64(r.opts.Rate))
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+
+	padding := strings.Repeat("x", r.opts.PayloadSize)
+	deadline := time.Now().Add(r.opts.Duration)
+	for sequence := 0; time.Now().Before(deadline); sequence++ {
+		if ticker != nil {
+			<-ticker.C
+		}
+
+		request := models.ClientMessage{
+			Type:  "publish",
+			Topic: r.opts.Topic,
+			Message: &models.Message{
+				ID:      fmt.Sprintf("bench-%d-%d", index, sequence),
+				Payload: benchPayload{SentAt: time.Now().UnixNano(), Data: padding},
+			},
+		}
+		if err := conn.WriteJSON(request); err != nil {
+			return
+		}
+		r.sent.Add(1)
+	}
+}
+
+// readAcks counts acknowledgments and rejections on a publisher connection
+func (r *run) readAcks(conn *websocket.Conn, done *sync.WaitGroup) {
+	defer done.Done()
+
+	for {
+		var response models.ServerMessage
+		if err := conn.ReadJSON(&response); err != nil {
+			return
+		}
+		switch response.Type {
+		case "ack":
+			r.acked.Add(1)
+		case "error":
+			r.rejected.Add(1)
+			r.mutex.Lock()
+			r.rejectReasons[response.Error.Code]++
+			r.mutex.Unlock()
+		}
+	}
+}
+
+// readEvents records the end-to-end latency of every event on a subscriber connection
+func (r *run) readEvents(conn *websocket.Conn, done *sync.WaitGroup) {
+	defer done.Done()
+
+	latencies := make([]time.Duration, 0, 1024)
+	defer func() {
+		r.mutex.Lock()
+		r.latencies = append(r.latencies, latencies...)
+		r.mutex.Unlock()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !r.stopping.Load() {
+				r.disconnected.Add(1)
+			}
+			return
+		}
+
+		var event struct {
+			Type    string        `json:"type"`
+			Error   *models.Error `json:"error"`
+			Message *struct {
+				Payload benchPayload `json:"payload"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+
+		switch {
+		case event.Type == "event" && event.Message != nil:
+			latencies = append(latencies, time.Duration(time.Now().UnixNano()-event.Message.Payload.SentAt))
+		case event.Type == "error" && event.Error != nil && event.Error.Code == "SLOW_CONSUMER":
+			r.slowConsumer.Add(1)
+		}
+	}
+}
+
+// createTopic creates the benchmark topic, accepting an existing one
+func createTopic(opts Options) error {
+	body, _ := json.Marshal(map[string]string{"name": opts.Topic})
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(opts.URL, "/")+"/topics", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if opts.APIKey != "" {
+		request.Header.Set("X-API-Key", opts.APIKey)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("create topic: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusConflict {
+		return fmt.Errorf("create topic: unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+// Report writes a human-readable summary of the result
+func (res *Result) Report(out io.Writer, opts Options) {
+	seconds := res.Elapsed.Seconds()
+	dropped := max(res.Expected-res.Received, 0)
+
+	fmt.Fprintf(out, "Target:        %s topic=%s\n", opts.URL, opts.Topic)
+	fmt.Fprintf(out, "Clients:       %d publishers, %d subscribers\n", opts.Publishers, opts.Subscribers)
+	fmt.Fprintf(out, "Payload:       %d bytes\n", opts.PayloadSize)
+	fmt.Fprintf(out, "Duration:      %s\n", res.Elapsed.Round(time.Millisecond))
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Published:     %d sent, %d acked, %d rejected (%.0f msg/s acked)\n",
+		res.Sent, res.Acked, res.Rejected, float64(res.Acked)/seconds)
+	for code, count := range res.RejectReasons {
+		fmt.Fprintf(out, "  %-12s %d\n", code, count)
+	}
+	fmt.Fprintf(out, "Delivered:     %d of %d expected (%.0f msg/s)\n",
+		res.Received, res.Expected, float64(res.Received)/seconds)
+	fmt.Fprintf(out, "Dropped:       %d (%d SLOW_CONSUMER errors, %d subscribers disconnected)\n",
+		dropped, res.SlowConsumer, res.Disconnected)
+
+	if len(res.Latencies) == 0 {
+		fmt.Fprintln(out, "Latency:       no events received")
+		return
+	}
+	fmt.Fprintf(out, "Latency:       p50=%s p90=%s p99=%s p99.9=%s max=%s\n",
+		res.Percentile(50), res.Percentile(90), res.Percentile(99), res.Percentile(99.9),
+		res.Latencies[len(res.Latencies)-1].Round(time.Microsecond))
+}
+
+// Percentile returns the latency at percentile p (0-100) of the sorted latencies
+func (res *Result) Percentile(p float64) time.Duration {
+	if len(res.Latencies) == 0 {
+		return 0
+	}
+	index := int(float64(len(res.Latencies)-1) * p / 100)
+	return res.Latencies[index].Round(time.Microsecond)
+}
@@ -0,0 +1,144 @@
+package bench
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"pub-sub/config"
+	"pub-sub/handlers"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"pub-sub/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestBroker serves the topic creation and WebSocket endpoints of a fresh broker with
+// the default client quotas and returns its base URL
+func newTestBroker(t *testing.T, clientRate int) string {
+	t.Helper()
+	cfg := &config.Config{
+		MaxMessagesPerTopic:       1000,
+		MaxPublishRate:            10000,
+		MaxClientPublishRate:      clientRate,
+		MaxBatchSize:              10,
+		MaxMessageSize:            4096,
+		MaxFrameSize:              8192,
+		DefaultQueueSize:          1000,
+		MaxQueueSize:              1000,
+		MaxConnectionsPerClient:   10,
+		MaxSubscriptionsPerClient: 100,
+		MaxPublishBytesPerSec:     1048576,
+		MaxRetainedBytesPerClient: 10485760,
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	rejections := metrics.NewRejections()
+	schemas := services.NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	quotas := services.NewQuotaService(ps, cfg, log)
+	messages := services.NewMessageService(ps, quotas, schemas, rejections, cfg, log)
+	topics := services.NewTopicService(ps, schemas, log)
+	rest := handlers.NewRestHandler(topics, messages, schemas, nil, nil, quotas, log)
+	ws := handlers.NewWebSocketHandler(ps, messages, quotas, schemas, metrics.NewCompression(), rejections, cfg, log)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/topics", rest.CreateTopic)
+	mux.HandleFunc("/ws", ws.HandleWebSocket)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestExecute(t *testing.T) {
+	opts := Options{
+		URL:         newTestBroker(t, 1000),
+		Topic:       "bench",
+		Publishers:  2,
+		Subscribers: 3,
+		Rate:        200,
+		PayloadSize: 64,
+		Duration:    300 * time.Millisecond,
+		Drain:       300 * time.Millisecond,
+	}
+
+	result, err := Execute(opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	// Every publish is acknowledged and reaches every subscriber
+	if result.Sent == 0 || result.Acked != result.Sent || result.Rejected != 0 {
+		t.Errorf("Expected every publish to be acked, got sent=%d acked=%d rejected=%d", result.Sent, result.Acked, result.Rejected)
+	}
+	if result.Expected != result.Acked*3 || result.Received != result.Expected {
+		t.Errorf("Expected %d events, received %d", result.Acked*3, result.Received)
+	}
+	if result.SlowConsumer != 0 || result.Disconnected != 0 {
+		t.Errorf("Expected no dropped subscribers, got %d slow and %d disconnected", result.SlowConsumer, result.Disconnected)
+	}
+	if p50, p99 := result.Percentile(50), result.Percentile(99); p50 <= 0 || p50 > p99 || p99 > result.Latencies[len(result.Latencies)-1].Round(time.Microsecond) {
+		t.Errorf("Expected ordered percentiles, got p50=%s p99=%s", p50, p99)
+	}
+
+	var report bytes.Buffer
+	result.Report(&report, opts)
+	if !strings.Contains(report.String(), "Dropped:       0 ") {
+		t.Errorf("Expected no drops in the report, got:\n%s", report.String())
+	}
+
+	// Publishes over the client rate limit are counted as rejected and never delivered
+	opts.URL = newTestBroker(t, 20)
+	opts.Rate = 400
+	opts.Duration = 200 * time.Millisecond
+	if result, err = Execute(opts); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Rejected == 0 || result.RejectReasons["RATE_LIMITED"] != result.Rejected || result.Acked+result.Rejected != result.Sent {
+		t.Errorf("Expected rate limited publishes, got sent=%d acked=%d rejected=%v", result.Sent, result.Acked, result.RejectReasons)
+	}
+	if result.Received != result.Acked*3 {
+		t.Errorf("Expected only acked publishes to be delivered, got %d of %d", result.Received, result.Acked*3)
+	}
+
+	if _, err := Execute(Options{URL: opts.URL, Topic: "bench"}); err == nil {
+		t.Error("Expected options without publishers or duration to be rejected")
+	}
+
+	// More connections than the connection quota fail with a hint
+	opts.URL = newTestBroker(t, 1000)
+	opts.Publishers, opts.Subscribers = 4, 8
+	if _, err := Execute(opts); err == nil || !strings.Contains(err.Error(), "MAX_CONNECTIONS_PER_CLIENT") {
+		t.Errorf("Expected the connection quota to be reported, got %v", err)
+	}
+}
+
+func TestRunDefaults(t *testing.T) {
+	// The default clients fit the default connection quota
+	var out bytes.Buffer
+	if err := Run([]string{"-url", newTestBroker(t, 1000), "-duration", "200ms", "-drain", "200ms"}, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "2 publishers, 4 subscribers") {
+		t.Errorf("Expected the default clients in the report, got:\n%s", out.String())
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	if p := (&Result{}).Percentile(50); p != 0 {
+		t.Errorf("Expected 0 without latencies, got %s", p)
+	}
+
+	result := &Result{}
+	for i := 1; i <= 100; i++ {
+		result.Latencies = append(result.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	expected := map[float64]time.Duration{0: time.Millisecond, 50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond}
+	for p, want := range expected {
+		if got := result.Percentile(p); got != want {
+			t.Errorf("Percentile(%v) = %s, want %s", p, got, want)
+		}
+	}
+}
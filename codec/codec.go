@@ -0,0 +1,125 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes protocol messages for one wire encoding. Codecs reuse the
+// `json` struct tags of the models, so every encoding carries the same field names.
+type Codec interface {
+	// Name is the WebSocket subprotocol that selects the codec
+	Name() string
+	// Binary reports whether encoded messages are sent as binary frames
+	Binary() bool
+	// Marshal encodes a value
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into a value
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Default is the codec used when a client does not negotiate a subprotocol
+var Default Codec = jsonCodec{}
+
+// codecs lists the supported codecs in server preference order
+var codecs = []Codec{
+	jsonCodec{},
+	msgpackCodec{},
+	newCBORCodec(),
+}
+
+// Subprotocols returns the subprotocol names of all supported codecs
+func Subprotocols() []string {
+	names := make([]string, 0, len(codecs))
+	for _, c := range codecs {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// ForSubprotocol returns the codec for a negotiated subprotocol, or the default codec
+// when none was negotiated
+func ForSubprotocol(name string) (Codec, bool) {
+	if name == "" {
+		return Default, true
+	}
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// jsonCodec encodes messages as JSON text frames
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+func (jsonCodec) Binary() bool { return false }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec encodes messages as MessagePack binary frames
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+func (msgpackCodec) Binary() bool { return true }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
+
+// cborCodec encodes messages as CBOR binary frames
+type cborCodec struct {
+	encoder cbor.EncMode
+	decoder cbor.DecMode
+}
+
+// newCBORCodec creates a CBOR codec that decodes maps with string keys, so payloads
+// stay representable in every other encoding
+func newCBORCodec() cborCodec {
+	encoder, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	decoder, err := cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborCodec{encoder: encoder, decoder: decoder}
+}
+
+func (cborCodec) Name() string { return "cbor" }
+func (cborCodec) Binary() bool { return true }
+
+func (c cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.encoder.Marshal(v)
+}
+
+func (c cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.decoder.Unmarshal(data, v)
+}
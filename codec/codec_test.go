@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"encoding/json"
+	"pub-sub/models"
+	"testing"
+)
+
+func TestForSubprotocol(t *testing.T) {
+	if c, ok := ForSubprotocol(""); !ok || c.Name() != "json" {
+		t.Error("Expected JSON when no subprotocol is negotiated")
+	}
+
+	for _, name := range Subprotocols() {
+		if c, ok := ForSubprotocol(name); !ok || c.Name() != name {
+			t.Errorf("Expected codec for subprotocol %s", name)
+		}
+	}
+
+	if _, ok := ForSubprotocol("xml"); ok {
+		t.Error("Expected unknown subprotocol to be rejected")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range Subprotocols() {
+		c, _ := ForSubprotocol(name)
+
+		t.Run(name, func(t *testing.T) {
+			// Client messages decode with the same field names as JSON
+			publish := models.ClientMessage{
+				Type:  "publish",
+				Topic: "orders",
+				Message: &models.Message{
+					ID:       "m-1",
+					Payload:  map[string]interface{}{"amount": 99.5, "items": []interface{}{"a", "b"}},
+					Priority: models.PriorityHigh,
+				},
+				RequestID: "r-1",
+			}
+			data, err := c.Marshal(publish)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+
+			var decoded models.ClientMessage
+			if err := c.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if decoded.Type != "publish" || decoded.Topic != "orders" || decoded.RequestID != "r-1" {
+				t.Errorf("Unexpected envelope: %+v", decoded)
+			}
+			if decoded.Message == nil || decoded.Message.ID != "m-1" || decoded.Message.Priority != models.PriorityHigh {
+				t.Fatalf("Unexpected message: %+v", decoded.Message)
+			}
+
+			// Decoded payloads must stay encodable as JSON for subscribers using other codecs
+			if _, err := json.Marshal(decoded.Message.Payload); err != nil {
+				t.Errorf("Decoded payload is not JSON-encodable: %v", err)
+			}
+
+			// Server-only fields are not encoded
+			event := models.ServerMessage{Type: "event", Topic: "orders", Message: decoded.Message, Frames: &models.EncodedFrames{}}
+			data, err = c.Marshal(event)
+			if err != nil {
+				t.Fatalf("Marshal event failed: %v", err)
+			}
+			var decodedEvent models.ServerMessage
+			if err := c.Unmarshal(data, &decodedEvent); err != nil {
+				t.Fatalf("Unmarshal event failed: %v", err)
+			}
+			if decodedEvent.Type != "event" || decodedEvent.Frames != nil || decodedEvent.Message.ID != "m-1" {
+				t.Errorf("Unexpected event: %+v", decodedEvent)
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"pub-sub/schema"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/joho/godotenv"
@@ -21,15 +24,86 @@ type Config struct {
 	Port string
 	Host string
 
-	// Topic configuration
+	// gRPC listener port; 0 (the default) disables the gRPC API
+	GRPCPort string
+
+	// MQTT listener port; 0 (the default) disables the MQTT frontend. Sessions of clients connecting
+	// without CleanSession are kept for the session expiry in seconds after they
+	// disconnect (0 treats every session as clean).
+	MQTTPort          string
+	MQTTSessionExpiry int
+
+	// Redis (RESP) listener port; 0 disables the Redis frontend
+	RedisPort string
+
+	// Topic configuration. Auto-creation lets MQTT and Redis publishes create missing topics.
 	MaxMessagesPerTopic int
+	TopicAutoCreate     bool
+
+	// WebSocket configuration. Subscriptions of a dropped connection are kept for the
+	// session grace period in seconds (0 disables resumable sessions).
+	ReadBufferSize       int
+	WriteBufferSize      int
+	WSSessionGracePeriod int
+
+	// Compression (WebSocket permessage-deflate and REST gzip). Messages smaller
+	// than the threshold in bytes are sent uncompressed.
+	WSCompression        bool
+	CompressionLevel     int
+	CompressionThreshold int
+
+	// Server-Sent Events heartbeat comment interval in seconds
+	SSEHeartbeatInterval int
+
+	// Pull API limits: messages per pull and long-poll wait in seconds
+	PullMaxMessages int
+	PullMaxWait     int
+
+	// Webhook push subscriptions: request timeout in seconds, retries per message with
+	// exponential backoff starting at a base in milliseconds, and the circuit breaker's
+	// consecutive failed messages threshold and cooldown in seconds
+	WebhookTimeout          int
+	WebhookMaxRetries       int
+	WebhookRetryBackoff     int
+	WebhookBreakerThreshold int
+	WebhookBreakerCooldown  int
 
-	// WebSocket configuration
-	ReadBufferSize  int
-	WriteBufferSize int
+	// Host names, IP addresses and CIDR ranges webhooks may target even though they are
+	// loopback, private or link-local. Other internal addresses are refused.
+	WebhookAllowedHosts []string
 
-	// Rate limiting (messages per second per topic)
-	MaxPublishRate int
+	// Subscriber queue configuration (buffered messages per subscriber/client)
+	DefaultQueueSize int
+	MaxQueueSize     int
+
+	// Rate limiting (messages per second per topic, with per-topic overrides,
+	// and per client connection or API key)
+	MaxPublishRate       int
+	TopicPublishRates    map[string]int
+	MaxClientPublishRate int
+
+	// Batch publishing (messages per batch request)
+	MaxBatchSize int
+
+	// Size limits in bytes: encoded messages, with per-topic overrides, and whole
+	// WebSocket frames or REST request bodies
+	MaxMessageSize    int
+	TopicMessageSizes map[string]int
+	MaxFrameSize      int
+
+	// Schema compatibility mode checked when registering topic schemas without an override
+	SchemaCompatibility string
+
+	// API keys accepted as client identities. Clients presenting any other key are
+	// identified by their remote IP.
+	APIKeys []string
+
+	// Client quotas keyed by API key or remote IP (0 disables a quota)
+	MaxConnectionsPerClient   int
+	MaxSubscriptionsPerClient int
+	MaxPublishBytesPerSec     int
+	MaxRetainedBytesPerClient int
+	MaxWebhooksPerClient      int
 
 	// Logging configuration
 	LogLevel  string
@@ -49,14 +123,47 @@ func LoadConfig() *Config {
 		}
 
 		config = &Config{
-			Port:                getEnv("PORT", "8080"),
-			Host:                getEnv("HOST", "0.0.0.0"),
-			MaxMessagesPerTopic: getEnvAsInt("MAX_MESSAGES_PER_TOPIC", 1000),
-			ReadBufferSize:      getEnvAsInt("WS_READ_BUFFER_SIZE", 1024),
-			WriteBufferSize:     getEnvAsInt("WS_WRITE_BUFFER_SIZE", 1024),
-			MaxPublishRate:      getEnvAsInt("MAX_PUBLISH_RATE", 100),
-			LogLevel:            getEnv("LOG_LEVEL", "info"),
-			LogFormat:           getEnv("LOG_FORMAT", "text"),
+			Port:                      getEnv("PORT", "8080"),
+			Host:                      getEnv("HOST", "0.0.0.0"),
+			GRPCPort:                  getEnv("GRPC_PORT", "0"),
+			MQTTPort:                  getEnv("MQTT_PORT", "0"),
+			MQTTSessionExpiry:         getEnvAsInt("MQTT_SESSION_EXPIRY", 3600),
+			RedisPort:                 getEnv("REDIS_PORT", "0"),
+			MaxMessagesPerTopic:       getEnvAsInt("MAX_MESSAGES_PER_TOPIC", 1000),
+			TopicAutoCreate:           getEnvAsBool("TOPIC_AUTO_CREATE", false),
+			ReadBufferSize:            getEnvAsInt("WS_READ_BUFFER_SIZE", 1024),
+			WriteBufferSize:           getEnvAsInt("WS_WRITE_BUFFER_SIZE", 1024),
+			WSSessionGracePeriod:      getEnvAsInt("WS_SESSION_GRACE_PERIOD", 30),
+			WSCompression:             getEnvAsBool("WS_COMPRESSION", true),
+			CompressionLevel:          getEnvAsInt("COMPRESSION_LEVEL", 1),
+			CompressionThreshold:      getEnvAsInt("COMPRESSION_THRESHOLD", 1024),
+			SSEHeartbeatInterval:      getEnvAsInt("SSE_HEARTBEAT_INTERVAL", 15),
+			PullMaxMessages:           getEnvAsInt("PULL_MAX_MESSAGES", 100),
+			PullMaxWait:               getEnvAsInt("PULL_MAX_WAIT", 30),
+			WebhookTimeout:            getEnvAsInt("WEBHOOK_TIMEOUT", 10),
+			WebhookMaxRetries:         getEnvAsInt("WEBHOOK_MAX_RETRIES", 5),
+			WebhookRetryBackoff:       getEnvAsInt("WEBHOOK_RETRY_BACKOFF_MS", 500),
+			WebhookBreakerThreshold:   getEnvAsInt("WEBHOOK_BREAKER_THRESHOLD", 5),
+			WebhookBreakerCooldown:    getEnvAsInt("WEBHOOK_BREAKER_COOLDOWN", 30),
+			WebhookAllowedHosts:       getEnvAsList("WEBHOOK_ALLOWED_HOSTS"),
+			DefaultQueueSize:          getEnvAsInt("DEFAULT_QUEUE_SIZE", 100),
+			MaxQueueSize:              getEnvAsInt("MAX_QUEUE_SIZE", 1000),
+			MaxPublishRate:            getEnvAsInt("MAX_PUBLISH_RATE", 100),
+			TopicPublishRates:         getEnvAsIntMap("TOPIC_PUBLISH_RATES"),
+			MaxClientPublishRate:      getEnvAsInt("MAX_CLIENT_PUBLISH_RATE", 100),
+			MaxBatchSize:              getEnvAsInt("MAX_BATCH_SIZE", 500),
+			MaxMessageSize:            getEnvAsInt("MAX_MESSAGE_SIZE", 1048576),
+			TopicMessageSizes:         getEnvAsIntMap("TOPIC_MESSAGE_SIZES"),
+			MaxFrameSize:              getEnvAsInt("MAX_FRAME_SIZE", 4194304),
+			SchemaCompatibility:       getEnv("SCHEMA_COMPATIBILITY", string(schema.ModeBackward)),
+			APIKeys:                   getEnvAsList("API_KEYS"),
+			MaxConnectionsPerClient:   getEnvAsInt("MAX_CONNECTIONS_PER_CLIENT", 10),
+			MaxSubscriptionsPerClient: getEnvAsInt("MAX_SUBSCRIPTIONS_PER_CLIENT", 100),
+			MaxPublishBytesPerSec:     getEnvAsInt("MAX_PUBLISH_BYTES_PER_SEC", 1048576),
+			MaxRetainedBytesPerClient: getEnvAsInt("MAX_RETAINED_BYTES_PER_CLIENT", 10485760),
+			MaxWebhooksPerClient:      getEnvAsInt("MAX_WEBHOOKS_PER_CLIENT", 10),
+			LogLevel:                  getEnv("LOG_LEVEL", "info"),
+			LogFormat:                 getEnv("LOG_FORMAT", "text"),
 		}
 
 		logrus.Infof("Configuration loaded: Port=%s, Host=%s, MaxMessagesPerTopic=%d, MaxPublishRate=%d",
@@ -94,8 +201,78 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsBool gets an environment variable as boolean or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		logrus.Warnf("Invalid value for %s: %s, using default: %t", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvAsList parses a comma-separated environment variable, skipping empty entries
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvAsIntMap parses an environment variable of the form "key1=1,key2=2"
+func getEnvAsIntMap(key string) map[string]int {
+	result := make(map[string]int)
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		name, rawValue, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			logrus.Warnf("Invalid entry in %s: %s, ignoring", key, pair)
+			continue
+		}
+		intValue, err := strconv.Atoi(strings.TrimSpace(rawValue))
+		if err != nil {
+			logrus.Warnf("Invalid value in %s for %s: %s, ignoring", key, name, rawValue)
+			continue
+		}
+		result[strings.TrimSpace(name)] = intValue
+	}
+	return result
+}
+
 // ValidateConfig validates the configuration and returns any errors
 func (c *Config) ValidateConfig() error {
+	if port, err := strconv.Atoi(c.GRPCPort); err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("GRPC_PORT must be a port number or 0 to disable, got: %s", c.GRPCPort)
+	}
+
+	if c.GRPCEnabled() && c.GRPCPort == c.Port {
+		return fmt.Errorf("GRPC_PORT must differ from PORT, got: %s", c.GRPCPort)
+	}
+
+	if port, err := strconv.Atoi(c.MQTTPort); err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("MQTT_PORT must be a port number or 0 to disable, got: %s", c.MQTTPort)
+	}
+
+	if c.MQTTEnabled() && (c.MQTTPort == c.Port || c.MQTTPort == c.GRPCPort) {
+		return fmt.Errorf("MQTT_PORT must differ from PORT and GRPC_PORT, got: %s", c.MQTTPort)
+	}
+
+	if port, err := strconv.Atoi(c.RedisPort); err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("REDIS_PORT must be a port number or 0 to disable, got: %s", c.RedisPort)
+	}
+
+	if c.RedisEnabled() && (c.RedisPort == c.Port || c.RedisPort == c.GRPCPort || c.RedisPort == c.MQTTPort) {
+		return fmt.Errorf("REDIS_PORT must differ from PORT, GRPC_PORT and MQTT_PORT, got: %s", c.RedisPort)
+	}
+
 	if c.MaxMessagesPerTopic <= 0 {
 		return fmt.Errorf("MAX_MESSAGES_PER_TOPIC must be positive, got: %d", c.MaxMessagesPerTopic)
 	}
@@ -104,6 +281,83 @@ func (c *Config) ValidateConfig() error {
 		return fmt.Errorf("MAX_PUBLISH_RATE must be positive, got: %d", c.MaxPublishRate)
 	}
 
+	for topic, rate := range c.TopicPublishRates {
+		if rate <= 0 {
+			return fmt.Errorf("TOPIC_PUBLISH_RATES rate for %s must be positive, got: %d", topic, rate)
+		}
+	}
+
+	if c.MaxClientPublishRate <= 0 {
+		return fmt.Errorf("MAX_CLIENT_PUBLISH_RATE must be positive, got: %d", c.MaxClientPublishRate)
+	}
+
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("MAX_BATCH_SIZE must be positive, got: %d", c.MaxBatchSize)
+	}
+
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("MAX_MESSAGE_SIZE must be positive, got: %d", c.MaxMessageSize)
+	}
+
+	if c.MaxFrameSize < c.MaxMessageSize {
+		return fmt.Errorf("MAX_FRAME_SIZE must be at least MAX_MESSAGE_SIZE (%d), got: %d", c.MaxMessageSize, c.MaxFrameSize)
+	}
+
+	for topic, size := range c.TopicMessageSizes {
+		if size <= 0 || size > c.MaxFrameSize {
+			return fmt.Errorf("TOPIC_MESSAGE_SIZES size for %s must be between 1 and MAX_FRAME_SIZE (%d), got: %d", topic, c.MaxFrameSize, size)
+		}
+	}
+
+	if _, ok := schema.ParseMode(c.SchemaCompatibility); !ok {
+		return fmt.Errorf("SCHEMA_COMPATIBILITY must be one of NONE, BACKWARD, BACKWARD_TRANSITIVE, FORWARD, FORWARD_TRANSITIVE, FULL or FULL_TRANSITIVE, got: %s", c.SchemaCompatibility)
+	}
+
+	if c.MaxConnectionsPerClient < 0 {
+		return fmt.Errorf("MAX_CONNECTIONS_PER_CLIENT must not be negative, got: %d", c.MaxConnectionsPerClient)
+	}
+
+	if c.MaxSubscriptionsPerClient < 0 {
+		return fmt.Errorf("MAX_SUBSCRIPTIONS_PER_CLIENT must not be negative, got: %d", c.MaxSubscriptionsPerClient)
+	}
+
+	if c.MaxPublishBytesPerSec < 0 {
+		return fmt.Errorf("MAX_PUBLISH_BYTES_PER_SEC must not be negative, got: %d", c.MaxPublishBytesPerSec)
+	}
+
+	// The publish byte budget bursts up to one second's worth, so a larger message could
+	// never be admitted
+	if c.MaxPublishBytesPerSec > 0 {
+		if c.MaxMessageSize > c.MaxPublishBytesPerSec {
+			return fmt.Errorf("MAX_PUBLISH_BYTES_PER_SEC must be at least MAX_MESSAGE_SIZE (%d), got: %d", c.MaxMessageSize, c.MaxPublishBytesPerSec)
+		}
+		for topic, size := range c.TopicMessageSizes {
+			if size > c.MaxPublishBytesPerSec {
+				return fmt.Errorf("MAX_PUBLISH_BYTES_PER_SEC must be at least the TOPIC_MESSAGE_SIZES size for %s (%d), got: %d", topic, size, c.MaxPublishBytesPerSec)
+			}
+		}
+	}
+
+	if c.MaxRetainedBytesPerClient < 0 {
+		return fmt.Errorf("MAX_RETAINED_BYTES_PER_CLIENT must not be negative, got: %d", c.MaxRetainedBytesPerClient)
+	}
+
+	// A message larger than the retained bytes quota could never be published
+	if c.MaxRetainedBytesPerClient > 0 {
+		if c.MaxMessageSize > c.MaxRetainedBytesPerClient {
+			return fmt.Errorf("MAX_RETAINED_BYTES_PER_CLIENT must be at least MAX_MESSAGE_SIZE (%d), got: %d", c.MaxMessageSize, c.MaxRetainedBytesPerClient)
+		}
+		for topic, size := range c.TopicMessageSizes {
+			if size > c.MaxRetainedBytesPerClient {
+				return fmt.Errorf("MAX_RETAINED_BYTES_PER_CLIENT must be at least the TOPIC_MESSAGE_SIZES size for %s (%d), got: %d", topic, size, c.MaxRetainedBytesPerClient)
+			}
+		}
+	}
+
+	if c.MaxWebhooksPerClient < 0 {
+		return fmt.Errorf("MAX_WEBHOOKS_PER_CLIENT must not be negative, got: %d", c.MaxWebhooksPerClient)
+	}
+
 	if c.ReadBufferSize <= 0 {
 		return fmt.Errorf("WS_READ_BUFFER_SIZE must be positive, got: %d", c.ReadBufferSize)
 	}
@@ -112,11 +366,121 @@ func (c *Config) ValidateConfig() error {
 		return fmt.Errorf("WS_WRITE_BUFFER_SIZE must be positive, got: %d", c.WriteBufferSize)
 	}
 
+	if c.WSSessionGracePeriod < 0 {
+		return fmt.Errorf("WS_SESSION_GRACE_PERIOD must not be negative, got: %d", c.WSSessionGracePeriod)
+	}
+
+	if c.MQTTSessionExpiry < 0 {
+		return fmt.Errorf("MQTT_SESSION_EXPIRY must not be negative, got: %d", c.MQTTSessionExpiry)
+	}
+
+	if c.CompressionLevel < -2 || c.CompressionLevel > 9 {
+		return fmt.Errorf("COMPRESSION_LEVEL must be between -2 and 9, got: %d", c.CompressionLevel)
+	}
+
+	if c.CompressionThreshold < 0 {
+		return fmt.Errorf("COMPRESSION_THRESHOLD must not be negative, got: %d", c.CompressionThreshold)
+	}
+
+	if c.SSEHeartbeatInterval <= 0 {
+		return fmt.Errorf("SSE_HEARTBEAT_INTERVAL must be positive, got: %d", c.SSEHeartbeatInterval)
+	}
+
+	if c.PullMaxMessages <= 0 {
+		return fmt.Errorf("PULL_MAX_MESSAGES must be positive, got: %d", c.PullMaxMessages)
+	}
+
+	if c.PullMaxWait < 0 {
+		return fmt.Errorf("PULL_MAX_WAIT must not be negative, got: %d", c.PullMaxWait)
+	}
+
+	if c.WebhookTimeout <= 0 {
+		return fmt.Errorf("WEBHOOK_TIMEOUT must be positive, got: %d", c.WebhookTimeout)
+	}
+
+	if c.WebhookMaxRetries < 0 {
+		return fmt.Errorf("WEBHOOK_MAX_RETRIES must not be negative, got: %d", c.WebhookMaxRetries)
+	}
+
+	if c.WebhookRetryBackoff <= 0 {
+		return fmt.Errorf("WEBHOOK_RETRY_BACKOFF_MS must be positive, got: %d", c.WebhookRetryBackoff)
+	}
+
+	if c.WebhookBreakerThreshold <= 0 {
+		return fmt.Errorf("WEBHOOK_BREAKER_THRESHOLD must be positive, got: %d", c.WebhookBreakerThreshold)
+	}
+
+	if c.WebhookBreakerCooldown <= 0 {
+		return fmt.Errorf("WEBHOOK_BREAKER_COOLDOWN must be positive, got: %d", c.WebhookBreakerCooldown)
+	}
+
+	for _, host := range c.WebhookAllowedHosts {
+		if _, _, err := net.ParseCIDR(host); strings.Contains(host, "/") && err != nil {
+			return fmt.Errorf("WEBHOOK_ALLOWED_HOSTS has an invalid CIDR range: %s", host)
+		}
+	}
+
+	if c.DefaultQueueSize <= 0 {
+		return fmt.Errorf("DEFAULT_QUEUE_SIZE must be positive, got: %d", c.DefaultQueueSize)
+	}
+
+	if c.MaxQueueSize < c.DefaultQueueSize {
+		return fmt.Errorf("MAX_QUEUE_SIZE must be at least DEFAULT_QUEUE_SIZE (%d), got: %d", c.DefaultQueueSize, c.MaxQueueSize)
+	}
+
 	return nil
 }
 
+// GRPCEnabled reports whether the gRPC API is served
+func (c *Config) GRPCEnabled() bool {
+	return c.GRPCPort != "0"
+}
+
+// MQTTEnabled reports whether the MQTT frontend is served
+func (c *Config) MQTTEnabled() bool {
+	return c.MQTTPort != "0"
+}
+
+// RedisEnabled reports whether the Redis frontend is served
+func (c *Config) RedisEnabled() bool {
+	return c.RedisPort != "0"
+}
+
+// PublishRateForTopic returns the allowed messages per second for a topic,
+// using the per-topic override when one is configured
+func (c *Config) PublishRateForTopic(topic string) int {
+	if rate, exists := c.TopicPublishRates[topic]; exists {
+		return rate
+	}
+	return c.MaxPublishRate
+}
+
+// MessageSizeForTopic returns the largest encoded message size in bytes allowed on a
+// topic, using the per-topic override when one is configured
+func (c *Config) MessageSizeForTopic(topic string) int {
+	if size, exists := c.TopicMessageSizes[topic]; exists {
+		return size
+	}
+	return c.MaxMessageSize
+}
+
+// QueueSize resolves a client-requested queue size against the configured bounds.
+// Non-positive requests fall back to the default, larger ones are capped at the maximum.
+func (c *Config) QueueSize(requested int) int {
+	if requested <= 0 {
+		requested = c.DefaultQueueSize
+	}
+	if requested <= 0 {
+		requested = 100
+	}
+	if c.MaxQueueSize > 0 && requested > c.MaxQueueSize {
+		requested = c.MaxQueueSize
+	}
+	return requested
+}
+
 // String returns a string representation of the configuration
 func (c *Config) String() string {
-	return fmt.Sprintf("Config{Port: %s, Host: %s, MaxMessagesPerTopic: %d, MaxPublishRate: %d, ReadBufferSize: %d, WriteBufferSize: %d, LogLevel: %s, LogFormat: %s}",
-		c.Port, c.Host, c.MaxMessagesPerTopic, c.MaxPublishRate, c.ReadBufferSize, c.WriteBufferSize, c.LogLevel, c.LogFormat)
+	return fmt.Sprintf("Config{Port: %s, Host: %s, GRPCPort: %s, MQTTPort: %s, MQTTSessionExpiry: %d, RedisPort: %s, MaxMessagesPerTopic: %d, TopicAutoCreate: %t, MaxPublishRate: %d, MaxClientPublishRate: %d, MaxBatchSize: %d, MaxMessageSize: %d, MaxFrameSize: %d, SchemaCompatibility: %s, ReadBufferSize: %d, WriteBufferSize: %d, WSSessionGracePeriod: %d, WSCompression: %t, CompressionLevel: %d, CompressionThreshold: %d, SSEHeartbeatInterval: %d, PullMaxMessages: %d, PullMaxWait: %d, WebhookTimeout: %d, WebhookMaxRetries: %d, WebhookRetryBackoff: %d, WebhookBreakerThreshold: %d, WebhookBreakerCooldown: %d, DefaultQueueSize: %d, MaxQueueSize: %d, LogLevel: %s, LogFormat: %s}",
+		c.Port, c.Host, c.GRPCPort, c.MQTTPort, c.MQTTSessionExpiry, c.RedisPort, c.MaxMessagesPerTopic, c.TopicAutoCreate, c.MaxPublishRate, c.MaxClientPublishRate, c.MaxBatchSize, c.MaxMessageSize, c.MaxFrameSize, c.SchemaCompatibility, c.ReadBufferSize, c.WriteBufferSize, c.WSSessionGracePeriod, c.WSCompression, c.CompressionLevel, c.CompressionThreshold, c.SSEHeartbeatInterval, c.PullMaxMessages, c.PullMaxWait, c.WebhookTimeout, c.WebhookMaxRetries, c.WebhookRetryBackoff, c.WebhookBreakerThreshold, c.WebhookBreakerCooldown, c.DefaultQueueSize, c.MaxQueueSize, c.LogLevel, c.LogFormat)
 }
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"pub-sub/metrics"
+	"strings"
+	"sync/atomic"
+)
+
+// wireCountingWriter hands the WebSocket upgrader a connection that reports the bytes
+// written after the handshake, which is the compressed size of outbound traffic
+type wireCountingWriter struct {
+	http.ResponseWriter
+	compression *metrics.Compression
+	conn        *wireCountingConn
+}
+
+// Hijack wraps the hijacked connection so writes are counted
+func (w *wireCountingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &wireCountingConn{Conn: conn, compression: w.compression}
+	return w.conn, rw, nil
+}
+
+// startCounting begins counting once the handshake response has been written
+func (w *wireCountingWriter) startCounting() {
+	if w.conn != nil {
+		w.conn.counting.Store(true)
+	}
+}
+
+// wireCountingConn counts bytes written to a network connection
+type wireCountingConn struct {
+	net.Conn
+	compression *metrics.Compression
+	counting    atomic.Bool
+}
+
+// Write writes to the connection and records the bytes once counting has started
+func (c *wireCountingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if c.counting.Load() {
+		c.compression.RecordWebSocketWire(n)
+	}
+	return n, err
+}
+
+// offersDeflate reports whether a WebSocket client offered permessage-deflate
+func offersDeflate(r *http.Request) bool {
+	for _, extensions := range r.Header.Values("Sec-WebSocket-Extensions") {
+		if strings.Contains(extensions, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/proto/pubsubpb"
+	"pub-sub/pubsub"
+	"pub-sub/services"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcErrorDomain identifies this service in google.rpc.ErrorInfo details
+const grpcErrorDomain = "pub-sub"
+
+// GRPCHandler serves the gRPC API on top of the same services as the REST and WebSocket handlers
+type GRPCHandler struct {
+	pubsubpb.UnimplementedPubSubServer
+
+	pubsub         *pubsub.PubSub           // Reference to the pub-sub system
+	topicService   *services.TopicService   // Topic management
+	messageService *services.MessageService // Publishing with rate limits, quotas and schema validation
+	quotaService   *services.QuotaService   // Per-client quota enforcement
+	schemaService  *services.SchemaService  // Schema versions read by subscribers
+	systemService  *services.SystemService  // System statistics
+	logger         logger.Logger            // Logger instance
+	done           chan struct{}            // Closed on shutdown to end all subscribe streams
+	shutdownOnce   sync.Once                // Guards closing done
+}
+
+// NewGRPCHandler creates a new gRPC handler
+func NewGRPCHandler(pubsub *pubsub.PubSub, topicService *services.TopicService, messageService *services.MessageService, quotaService *services.QuotaService, schemaService *services.SchemaService, systemService *services.SystemService, log logger.Logger) *GRPCHandler {
+	return &GRPCHandler{
+		pubsub:         pubsub,
+		topicService:   topicService,
+		messageService: messageService,
+		quotaService:   quotaService,
+		schemaService:  schemaService,
+		systemService:  systemService,
+		logger:         log,
+		done:           make(chan struct{}),
+	}
+}
+
+// CreateTopic creates a topic
+func (h *GRPCHandler) CreateTopic(ctx context.Context, request *pubsubpb.CreateTopicRequest) (*pubsubpb.TopicResponse, error) {
+	response, err := h.topicService.CreateTopic(request.GetName())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pubsubpb.TopicResponse{Status: response.Status, Topic: response.Topic}, nil
+}
+
+// DeleteTopic deletes a topic and notifies its subscribers
+func (h *GRPCHandler) DeleteTopic(ctx context.Context, request *pubsubpb.DeleteTopicRequest) (*pubsubpb.TopicResponse, error) {
+	response, err := h.topicService.DeleteTopic(request.GetName())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pubsubpb.TopicResponse{Status: response.Status, Topic: response.Topic}, nil
+}
+
+// Publish publishes one message
+func (h *GRPCHandler) Publish(ctx context.Context, request *pubsubpb.PublishRequest) (*pubsubpb.PublishResponse, error) {
+	key := grpcClientKey(ctx, h.quotaService)
+	response, err := h.messageService.PublishMessage(services.Publisher{RateKey: key, QuotaKey: key}, request.GetTopic(), fromProtoMessage(request.GetMessage()))
+	if err != nil {
+		h.logger.Warnf("Failed to publish message over gRPC: %v", err)
+		return nil, grpcError(err)
+	}
+	return &pubsubpb.PublishResponse{Status: response.Status, Topic: response.Topic}, nil
+}
+
+// PublishStream publishes each streamed message in order. A failed message does not end
+// the stream; failures are reported once the client closes it.
+func (h *GRPCHandler) PublishStream(stream pubsubpb.PubSub_PublishStreamServer) error {
+	key := grpcClientKey(stream.Context(), h.quotaService)
+	publisher := services.Publisher{RateKey: key, QuotaKey: key}
+
+	response := &pubsubpb.PublishStreamResponse{}
+	for index := int32(0); ; index++ {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		message := fromProtoMessage(request.GetMessage())
+		if _, err := h.messageService.PublishMessage(publisher, request.GetTopic(), message); err != nil {
+			response.Failed++
+			response.Failures = append(response.Failures, &pubsubpb.PublishResult{
+				Index:     index,
+				Topic:     request.GetTopic(),
+				MessageId: request.GetMessage().GetId(),
+				Error:     &pubsubpb.Error{Code: errorCode(err), Message: err.Error()},
+			})
+			continue
+		}
+		response.Published++
+	}
+
+	switch {
+	case response.Failed == 0:
+		response.Status = "published"
+	case response.Published == 0:
+		response.Status = "failed"
+	default:
+		response.Status = "partial"
+	}
+
+	h.logger.Infof("gRPC publish stream processed: published=%d, failed=%d", response.Published, response.Failed)
+	return stream.SendAndClose(response)
+}
+
+// Subscribe streams a topic's events. Like a Server-Sent Events stream, each call is one
+// connection with one subscription against the client's quotas.
+func (h *GRPCHandler) Subscribe(request *pubsubpb.SubscribeRequest, stream pubsubpb.PubSub_SubscribeServer) error {
+	ctx := stream.Context()
+	topicName := request.GetTopic()
+	if topicName == "" {
+		return grpcError(models.ErrTopicRequired)
+	}
+
+	schemaVersion := int(request.GetSchemaVersion())
+	if schemaVersion > 0 {
+		if err := h.schemaService.CheckVersion(topicName, schemaVersion); err != nil {
+			return grpcError(err)
+		}
+	}
+
+	quotaKey := grpcClientKey(ctx, h.quotaService)
+	if err := h.quotaService.AcquireConnection(quotaKey); err != nil {
+		return grpcError(err)
+	}
+	if err := h.quotaService.AcquireSubscription(quotaKey); err != nil {
+		h.quotaService.ReleaseConnection(quotaKey, 0)
+		return grpcError(err)
+	}
+	defer h.quotaService.ReleaseConnection(quotaKey, 1)
+
+	subscriberID := "grpc-" + generateClientID()
+	err := h.pubsub.SubscribeWithOptions(subscriberID, topicName, pubsub.SubscribeOptions{
+		LastN:     int(request.GetLastN()),
+		QueueSize: int(request.GetQueueSize()),
+	})
+	if err != nil {
+		return grpcError(err)
+	}
+	defer h.pubsub.RemoveSubscriber(subscriberID)
+
+	messages := h.pubsub.GetSubscriberChannel(subscriberID)
+	if messages == nil {
+		return grpcError(models.ErrSubscriberNotFound)
+	}
+
+	h.logger.Infof("gRPC client %s subscribed to topic %s", subscriberID, topicName)
+	defer h.logger.Infof("gRPC client %s disconnected from topic %s", subscriberID, topicName)
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				// Subscriber removed after its queue overflowed
+				return grpcError(models.ErrSlowConsumer)
+			}
+			if schemaVersion > 0 && message.Message != nil && !h.schemaService.Readable(topicName, schemaVersion, message.Message) {
+				continue
+			}
+
+			response, err := encodeGRPCResponse(message)
+			if err != nil {
+				h.logger.Errorf("Failed to encode event for gRPC client %s: %v", subscriberID, err)
+				continue
+			}
+			if err := stream.Send(response); err != nil {
+				return err
+			}
+			if message.Type == "info" && message.Msg == "topic_deleted" {
+				return nil
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-h.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		}
+	}
+}
+
+// Stats returns system statistics
+func (h *GRPCHandler) Stats(ctx context.Context, request *pubsubpb.StatsRequest) (*pubsubpb.StatsResponse, error) {
+	stats := h.systemService.GetStats()
+
+	response := &pubsubpb.StatsResponse{
+		TotalTopics:       int64(stats.TotalTopics),
+		TotalMessages:     int64(stats.TotalMessages),
+		TotalSubscribers:  int64(stats.TotalSubscribers),
+		ActiveConnections: int64(stats.ActiveConnections),
+		UptimeSeconds:     int64(stats.UptimeSeconds),
+		Topics:            make(map[string]*pubsubpb.TopicStats, len(stats.Topics)),
+	}
+	if generatedAt, err := time.Parse(time.RFC3339, stats.GeneratedAt); err == nil {
+		response.GeneratedAt = timestamppb.New(generatedAt)
+	}
+	for name, topic := range stats.Topics {
+		topicStats := &pubsubpb.TopicStats{
+			Name:        topic.Name,
+			Messages:    int64(topic.Messages),
+			Subscribers: int64(topic.Subscribers),
+			CreatedAt:   timestamppb.New(topic.CreatedAt),
+		}
+		if !topic.LastMessageAt.IsZero() {
+			topicStats.LastMessageAt = timestamppb.New(topic.LastMessageAt)
+		}
+		response.Topics[name] = topicStats
+	}
+	return response, nil
+}
+
+// Shutdown ends all subscribe streams, so the gRPC server can stop gracefully
+func (h *GRPCHandler) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// grpcClientKey identifies a gRPC client by a configured x-api-key metadata value, falling
+// back to the peer IP, matching the REST and WebSocket client keys
+func grpcClientKey(ctx context.Context, quotas *services.QuotaService) string {
+	apiKey := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-api-key"); len(values) > 0 {
+			apiKey = values[0]
+		}
+	}
+
+	host := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		var err error
+		if host, _, err = net.SplitHostPort(p.Addr.String()); err != nil {
+			host = p.Addr.String()
+		}
+	}
+	return quotas.ClientKey(apiKey, host)
+}
+
+// errorCode returns the API error code of a service error
+func errorCode(err error) string {
+	if _, known := grpcCode(err); !known {
+		return "INTERNAL"
+	}
+	return err.Error()
+}
+
+// grpcCode maps a service error to a gRPC status code, reporting whether the error is
+// one of the API errors, whose text is its error code
+func grpcCode(err error) (codes.Code, bool) {
+	switch {
+	case errors.Is(err, models.ErrTopicNotFound), errors.Is(err, models.ErrSubscriberNotFound):
+		return codes.NotFound, true
+	case errors.Is(err, models.ErrTopicExists):
+		return codes.AlreadyExists, true
+	case errors.Is(err, models.ErrRateLimited), errors.Is(err, models.ErrQuotaExceeded),
+		errors.Is(err, models.ErrMessageTooLarge), errors.Is(err, models.ErrSlowConsumer):
+		return codes.ResourceExhausted, true
+	case errors.Is(err, models.ErrInvalidRequest), errors.Is(err, models.ErrTopicRequired),
+		errors.Is(err, models.ErrMessageRequired), errors.Is(err, models.ErrMessageIDRequired),
+		errors.Is(err, models.ErrInvalidPriority), errors.Is(err, models.ErrSchemaViolation),
+		errors.Is(err, models.ErrSchemaNotFound), errors.Is(err, models.ErrSchemaVersionNotFound):
+		return codes.InvalidArgument, true
+	}
+	return codes.Internal, false
+}
+
+// grpcError converts a service error to a gRPC status carrying its API error code as an
+// ErrorInfo reason, with retry and schema violation details where they apply
+func grpcError(err error) error {
+	code, known := grpcCode(err)
+	if !known {
+		return status.Error(code, err.Error())
+	}
+
+	message := err.Error()
+	var rateLimitErr *models.RateLimitError
+	var quotaErr *models.QuotaError
+	var sizeErr *models.MessageSizeError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		message = fmt.Sprintf("Publish rate exceeded for %s", rateLimitErr.Scope)
+	case errors.As(err, &quotaErr):
+		message = fmt.Sprintf("Client quota exceeded for %s (limit %d)", quotaErr.Resource, quotaErr.Limit)
+	case errors.As(err, &sizeErr):
+		message = messageSizeDetails(err)
+	}
+
+	st := status.New(code, message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: err.Error(), Domain: grpcErrorDomain}}
+
+	var retryAfter time.Duration
+	if rateLimitErr != nil {
+		retryAfter = rateLimitErr.RetryAfter
+	} else if quotaErr != nil {
+		retryAfter = quotaErr.RetryAfter
+	}
+	if retryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+
+	var schemaErr *models.SchemaError
+	if errors.As(err, &schemaErr) {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(schemaErr.Violations))
+		for i, violation := range schemaErr.Violations {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: violation.Path, Description: violation.Message}
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	if withDetails, detailErr := st.WithDetails(details...); detailErr == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// encodeGRPCResponse converts a server message to a subscribe response, sharing the
+// conversion across all recipients of a fan-out message
+func encodeGRPCResponse(message *models.ServerMessage) (*pubsubpb.SubscribeResponse, error) {
+	if message.Frames == nil {
+		return grpcResponse(message)
+	}
+	response, err := message.Frames.Get("grpc", func() (any, error) {
+		return grpcResponse(message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.(*pubsubpb.SubscribeResponse), nil
+}
+
+// grpcResponse converts a server message to a subscribe response
+func grpcResponse(message *models.ServerMessage) (*pubsubpb.SubscribeResponse, error) {
+	response := &pubsubpb.SubscribeResponse{
+		Type:  message.Type,
+		Topic: message.Topic,
+		Info:  message.Msg,
+	}
+	if ts, err := time.Parse(time.RFC3339, message.TS); err == nil {
+		response.Ts = timestamppb.New(ts)
+	}
+	if message.Error != nil {
+		response.Error = &pubsubpb.Error{Code: message.Error.Code, Message: message.Error.Message}
+	}
+	if message.Message != nil {
+		protoMessage, err := toProtoMessage(message.Message)
+		if err != nil {
+			return nil, err
+		}
+		response.Message = protoMessage
+	}
+	return response, nil
+}
+
+// fromProtoMessage converts a gRPC message to a model message, decoding the payload as
+// JSON decoding would
+func fromProtoMessage(message *pubsubpb.Message) *models.Message {
+	if message == nil {
+		return nil
+	}
+	return &models.Message{
+		ID:       message.GetId(),
+		Payload:  message.GetPayload().AsInterface(),
+		Priority: message.GetPriority(),
+		Headers:  message.GetHeaders(),
+	}
+}
+
+// toProtoMessage converts a model message to a gRPC message
+func toProtoMessage(message *models.Message) (*pubsubpb.Message, error) {
+	payload, err := structpb.NewValue(message.Payload)
+	if err != nil {
+		// Payloads decoded by the binary codecs may hold types structpb does not
+		// support, such as byte strings or non-string map keys; convert through JSON
+		data, err := json.Marshal(message.Payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = &structpb.Value{}
+		if err := protojson.Unmarshal(data, payload); err != nil {
+			return nil, err
+		}
+	}
+	return &pubsubpb.Message{
+		Id:       message.ID,
+		Payload:  payload,
+		Priority: message.Priority,
+		Headers:  message.Headers,
+	}, nil
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/proto/pubsubpb"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"pub-sub/services"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newGRPCClient serves the gRPC API over an in-memory listener and returns a client for it
+func newGRPCClient(t *testing.T) pubsubpb.PubSubClient {
+	t.Helper()
+
+	cfg := &config.Config{
+		MaxMessagesPerTopic:  10,
+		MaxPublishRate:       1000,
+		MaxClientPublishRate: 1000,
+		MaxBatchSize:         10,
+		MaxMessageSize:       1024,
+		MaxFrameSize:         4096,
+		DefaultQueueSize:     10,
+		MaxQueueSize:         100,
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	rejections := metrics.NewRejections()
+	schemas := services.NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	quotas := services.NewQuotaService(ps, cfg, log)
+	handler := NewGRPCHandler(
+		ps,
+		services.NewTopicService(ps, schemas, log),
+		services.NewMessageService(ps, quotas, schemas, rejections, cfg, log),
+		quotas,
+		schemas,
+		services.NewSystemService(ps, quotas, nil, metrics.NewCompression(), rejections, log),
+		log,
+	)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pubsubpb.RegisterPubSubServer(server, handler)
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		handler.Shutdown()
+		server.Stop()
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pubsubpb.NewPubSubClient(conn)
+}
+
+// errorReason returns the ErrorInfo reason of a gRPC error
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestGRPCPublishSubscribe(t *testing.T) {
+	client := newGRPCClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.CreateTopic(ctx, &pubsubpb.CreateTopicRequest{Name: "orders"}); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+	_, err := client.CreateTopic(ctx, &pubsubpb.CreateTopicRequest{Name: "orders"})
+	if status.Code(err) != codes.AlreadyExists || errorReason(err) != "TOPIC_EXISTS" {
+		t.Errorf("Expected AlreadyExists with reason TOPIC_EXISTS, got %v", err)
+	}
+
+	payload, _ := structpb.NewValue(map[string]interface{}{"order_id": "ORD-1", "amount": 99.5})
+	if _, err := client.Publish(ctx, &pubsubpb.PublishRequest{
+		Topic:   "orders",
+		Message: &pubsubpb.Message{Id: "m-1", Payload: payload},
+	}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	_, err = client.Publish(ctx, &pubsubpb.PublishRequest{Topic: "missing", Message: &pubsubpb.Message{Id: "m-0"}})
+	if status.Code(err) != codes.NotFound || errorReason(err) != "TOPIC_NOT_FOUND" {
+		t.Errorf("Expected NotFound with reason TOPIC_NOT_FOUND, got %v", err)
+	}
+
+	subscription, err := client.Subscribe(ctx, &pubsubpb.SubscribeRequest{Topic: "orders", LastN: 1})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	replayed, err := subscription.Recv()
+	if err != nil || replayed.Type != "event" || replayed.Message.GetId() != "m-1" {
+		t.Fatalf("Expected replay of m-1, got %v %v", replayed, err)
+	}
+	if amount := replayed.Message.Payload.GetStructValue().GetFields()["amount"].GetNumberValue(); amount != 99.5 {
+		t.Errorf("Expected payload amount 99.5, got %v", amount)
+	}
+
+	// Streamed messages are published in order; failures do not end the stream
+	stream, err := client.PublishStream(ctx)
+	if err != nil {
+		t.Fatalf("PublishStream failed: %v", err)
+	}
+	for _, request := range []*pubsubpb.PublishRequest{
+		{Topic: "orders", Message: &pubsubpb.Message{Id: "m-2", Payload: structpb.NewStringValue("a")}},
+		{Topic: "orders", Message: &pubsubpb.Message{}},
+		{Topic: "orders", Message: &pubsubpb.Message{Id: "m-3", Payload: structpb.NewStringValue("b")}},
+	} {
+		if err := stream.Send(request); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv failed: %v", err)
+	}
+	if summary.Status != "partial" || summary.Published != 2 || len(summary.Failures) != 1 ||
+		summary.Failures[0].Index != 1 || summary.Failures[0].Error.Code != "MESSAGE_ID_REQUIRED" {
+		t.Errorf("Unexpected stream summary: %v", summary)
+	}
+
+	for _, id := range []string{"m-2", "m-3"} {
+		event, err := subscription.Recv()
+		if err != nil || event.Message.GetId() != id {
+			t.Fatalf("Expected live event %s, got %v %v", id, event, err)
+		}
+	}
+
+	stats, err := client.Stats(ctx, &pubsubpb.StatsRequest{})
+	if err != nil || stats.TotalTopics != 1 || stats.Topics["orders"].GetMessages() != 3 || stats.TotalSubscribers != 1 {
+		t.Errorf("Unexpected stats: %v %v", stats, err)
+	}
+
+	// Deleting the topic notifies the subscriber and ends the stream
+	if _, err := client.DeleteTopic(ctx, &pubsubpb.DeleteTopicRequest{Name: "orders"}); err != nil {
+		t.Fatalf("DeleteTopic failed: %v", err)
+	}
+	info, err := subscription.Recv()
+	if err != nil || info.Type != "info" || info.Info != "topic_deleted" {
+		t.Fatalf("Expected topic_deleted notice, got %v %v", info, err)
+	}
+	if _, err := subscription.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected the stream to end, got %v", err)
+	}
+}
@@ -0,0 +1,893 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/mqtt"
+	"pub-sub/pubsub"
+	"pub-sub/services"
+)
+
+const (
+	// mqttConnectTimeout bounds the wait for the CONNECT packet of a new connection
+	mqttConnectTimeout = 10 * time.Second
+	// mqttWriteTimeout bounds each packet write, so a stalled client does not block delivery forever
+	mqttWriteTimeout = 10 * time.Second
+	// mqttMaxInflight bounds the QoS 1 deliveries awaiting PUBACK; delivery pauses at the limit
+	mqttMaxInflight = 100
+)
+
+// errQoS2Unsupported ends connections that publish at QoS 2
+var errQoS2Unsupported = errors.New("QoS 2 is not supported")
+
+// MQTTHandler serves MQTT 3.1.1 clients. MQTT topic names map onto topics by replacing
+// the '/' level separator with '.', so sensors/room1/temp is the topic sensors.room1.temp.
+// To keep the mapping reversible, MQTT names and filters may not contain '.' and topics
+// whose names contain '/' are not visible over MQTT.
+type MQTTHandler struct {
+	pubsub         *pubsub.PubSub           // Reference to the pub-sub system
+	topicService   *services.TopicService   // Creates topics on first publish if auto-creation is enabled
+	messageService *services.MessageService // Publishes messages under rate limits and quotas
+	quotaService   *services.QuotaService   // Per-client quota enforcement
+	config         *config.Config           // System configuration
+	logger         logger.Logger            // Logger instance
+	sessions       map[string]*mqttSession  // Connected sessions keyed by MQTT client ID
+	parked         map[string]*mqttSession  // Persistent sessions without a connection keyed by MQTT client ID
+	retained       map[string]*mqttRetained // Retained messages keyed by MQTT topic name
+	retainOrder    uint64                   // Order of the last retained message
+	listener       net.Listener             // Listener accepting connections, closed on shutdown
+	mutex          sync.RWMutex             // Protects sessions, parked, retained and listener
+	done           chan struct{}            // Closed on shutdown
+	shutdownOnce   sync.Once                // Guards closing done
+}
+
+// mqttRetained is a topic's retained message, whose payload is charged to its
+// publisher's retained bytes quota
+type mqttRetained struct {
+	publish *mqtt.Publish // Message sent to new subscriptions
+	owner   string        // Quota identity of the publisher
+	order   uint64        // Retention order; the oldest are dropped first
+}
+
+// mqttSession is the state of one MQTT client. The session of a client connecting
+// without CleanSession outlives its connection: it is parked with its subscriber still
+// queuing messages until a connection with the same client ID resumes it or it expires.
+type mqttSession struct {
+	ClientID     string    // MQTT client identifier
+	SubscriberID string    // Pub-sub subscriber receiving the session's topics
+	Conn         net.Conn  // Current or last client connection
+	ConnectedAt  time.Time // When the current or last connection was established
+
+	quotaKey   string             // Quota identity: the username or remote IP
+	publisher  services.Publisher // Publishing identity for rate limits and quotas
+	will       *mqtt.Publish      // Last will, published unless the client sends DISCONNECT
+	persistent bool               // Whether the session is kept after the connection ends
+	ended      chan struct{}      // Closed once the current connection has been disconnected
+
+	filters    map[string]byte // Granted QoS keyed by topic filter
+	topics     map[string]bool // Subscribed topics matched by the filters
+	inflight   []*mqtt.Publish // QoS 1 deliveries awaiting PUBACK, oldest first
+	acked      chan struct{}   // Signalled when a PUBACK frees an inflight slot
+	delivering bool            // Whether the delivery goroutine runs
+	stop       chan struct{}   // Closed to stop the delivery goroutine
+	delivery   sync.WaitGroup  // Tracks the delivery goroutine
+	parked     bool            // Set while the session has no connection; nothing is delivered
+	closed     bool            // Set once the session ends; no further subscriptions
+	expiry     *time.Timer     // Discards the parked session when the session expiry ends
+	packetID   uint16          // Last packet identifier used for a QoS 1 delivery
+	mutex      sync.Mutex      // Protects the subscription and delivery state, inflight and packetID
+	writeMutex sync.Mutex      // Serializes packet writes
+}
+
+// NewMQTTHandler creates a new MQTT handler and registers it for topic changes, so
+// wildcard subscriptions pick up topics created later, and with the quota service, so
+// retained messages can be dropped for their publisher's retained bytes quota
+func NewMQTTHandler(pubsub *pubsub.PubSub, topicService *services.TopicService, messageService *services.MessageService, quotaService *services.QuotaService, cfg *config.Config, log logger.Logger) *MQTTHandler {
+	handler := &MQTTHandler{
+		pubsub:         pubsub,
+		topicService:   topicService,
+		messageService: messageService,
+		quotaService:   quotaService,
+		config:         cfg,
+		logger:         log,
+		sessions:       make(map[string]*mqttSession),
+		parked:         make(map[string]*mqttSession),
+		retained:       make(map[string]*mqttRetained),
+		done:           make(chan struct{}),
+	}
+	pubsub.AddTopicHandler(handler.topicChanged)
+	quotaService.AddRetainedDropper(handler.dropRetained)
+	return handler
+}
+
+// Serve accepts MQTT connections until the listener fails or the handler shuts down
+func (h *MQTTHandler) Serve(listener net.Listener) error {
+	h.mutex.Lock()
+	h.listener = listener
+	h.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-h.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go h.handleConnection(conn)
+	}
+}
+
+// handleConnection runs one MQTT connection from CONNECT to disconnect
+func (h *MQTTHandler) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(mqttConnectTimeout))
+	packet, err := mqtt.ReadPacket(reader, h.config.MaxFrameSize)
+	if err != nil {
+		h.logger.Debugf("MQTT connection from %s closed before CONNECT: %v", conn.RemoteAddr(), err)
+		return
+	}
+	connect, ok := packet.(*mqtt.Connect)
+	if !ok {
+		h.logger.Warnf("MQTT connection from %s did not start with CONNECT", conn.RemoteAddr())
+		return
+	}
+	if connect.Will != nil && !validTopicName(connect.Will.Topic) {
+		h.logger.Warnf("MQTT connection from %s has an invalid will topic %q", conn.RemoteAddr(), connect.Will.Topic)
+		return
+	}
+
+	session, resumed, code := h.connect(conn, connect)
+	if code != mqtt.Accepted {
+		conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+		mqtt.WritePacket(conn, &mqtt.Connack{ReturnCode: code})
+		return
+	}
+
+	clean := false
+	defer func() {
+		h.disconnect(session, clean)
+	}()
+
+	if err := session.write(&mqtt.Connack{SessionPresent: resumed, ReturnCode: mqtt.Accepted}); err != nil {
+		return
+	}
+	if resumed {
+		h.resumeSession(session)
+	}
+	h.logger.Infof("MQTT client %s connected from %s, session present: %t", session.ClientID, conn.RemoteAddr(), resumed)
+
+	// Clients must send a packet within one and a half keep-alive intervals
+	keepAlive := time.Duration(connect.KeepAlive) * time.Second * 3 / 2
+	for {
+		if keepAlive > 0 {
+			conn.SetReadDeadline(time.Now().Add(keepAlive))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+
+		packet, err := mqtt.ReadPacket(reader, h.config.MaxFrameSize)
+		if err != nil {
+			h.logger.Debugf("MQTT client %s read failed: %v", session.ClientID, err)
+			return
+		}
+
+		switch p := packet.(type) {
+		case *mqtt.Publish:
+			if err := h.handlePublish(session, p); err != nil {
+				h.logger.Warnf("Closing MQTT client %s: %v", session.ClientID, err)
+				return
+			}
+		case *mqtt.Puback:
+			session.acknowledge(p.PacketID)
+		case *mqtt.Subscribe:
+			if err := h.handleSubscribe(session, p); err != nil {
+				return
+			}
+		case *mqtt.Unsubscribe:
+			if err := h.handleUnsubscribe(session, p); err != nil {
+				return
+			}
+		case *mqtt.Pingreq:
+			if err := session.write(&mqtt.Pingresp{}); err != nil {
+				return
+			}
+		case *mqtt.Disconnect:
+			clean = true
+			return
+		default:
+			h.logger.Warnf("Closing MQTT client %s: unexpected %T packet", session.ClientID, packet)
+			return
+		}
+	}
+}
+
+// connect validates a CONNECT packet and registers its session, taking over any
+// connected session with the same client ID. Without CleanSession a parked session of
+// the client is resumed. It returns whether a session was resumed and the CONNACK
+// return code.
+func (h *MQTTHandler) connect(conn net.Conn, connect *mqtt.Connect) (*mqttSession, bool, byte) {
+	if connect.ProtocolName != "MQTT" || connect.ProtocolLevel != mqtt.ProtocolLevel {
+		return nil, false, mqtt.RefusedProtocolVersion
+	}
+
+	clientID := connect.ClientID
+	if clientID == "" {
+		// Only clean sessions may have the server assign an identifier
+		if !connect.CleanSession {
+			return nil, false, mqtt.RefusedIdentifierRejected
+		}
+		clientID = "auto-" + generateClientID()
+	}
+
+	// The username plays the part of an API key
+	username := ""
+	if connect.Username != nil {
+		username = *connect.Username
+	}
+	quotaKey := h.quotaService.ClientKey(username, remoteHost(conn.RemoteAddr()))
+	if err := h.quotaService.AcquireConnection(quotaKey); err != nil {
+		h.logger.Warnf("MQTT client %s refused: %v", clientID, err)
+		return nil, false, mqtt.RefusedServerUnavailable
+	}
+
+	session := &mqttSession{
+		ClientID:     clientID,
+		SubscriberID: "mqtt-" + generateClientID(),
+		Conn:         conn,
+		ConnectedAt:  time.Now(),
+		quotaKey:     quotaKey,
+		will:         connect.Will,
+		persistent:   !connect.CleanSession && h.config.MQTTSessionExpiry > 0,
+		filters:      make(map[string]byte),
+		topics:       make(map[string]bool),
+		acked:        make(chan struct{}, 1),
+	}
+
+	// Clients with a username share its rate limits, others are limited per connection
+	session.publisher = services.Publisher{RateKey: session.SubscriberID, QuotaKey: quotaKey}
+	if services.IsAPIKey(quotaKey) {
+		session.publisher.RateKey = quotaKey
+	}
+
+	// A connection still registered with the client ID is closed first, so its session is
+	// parked or discarded before the new connection takes over
+	h.mutex.Lock()
+	for previous := h.sessions[clientID]; previous != nil; previous = h.sessions[clientID] {
+		previousConn, ended := previous.Conn, previous.ended
+		h.mutex.Unlock()
+		h.logger.Infof("MQTT client %s reconnected, closing its previous connection", clientID)
+		previousConn.Close()
+		<-ended
+		h.mutex.Lock()
+	}
+
+	// Only the same client identity may resume a session
+	parked := h.parked[clientID]
+	delete(h.parked, clientID)
+	resumed := parked != nil && session.persistent && parked.quotaKey == quotaKey
+	if resumed {
+		parked.mutex.Lock()
+		parked.Conn, parked.ConnectedAt, parked.will = conn, session.ConnectedAt, session.will
+		parked.mutex.Unlock()
+		session = parked
+	}
+	session.ended = make(chan struct{})
+	h.sessions[clientID] = session
+	h.mutex.Unlock()
+
+	if parked != nil {
+		// A timer that already fired finds the session gone and leaves it alone
+		parked.expiry.Stop()
+		if !resumed {
+			h.discardSession(parked)
+		}
+	}
+	return session, resumed, mqtt.Accepted
+}
+
+// disconnect ends a connection. A persistent session is parked, others are discarded.
+// The last will is published unless the client disconnected cleanly or the server is
+// shutting down. The session stays registered until then, so a connection with the same
+// client ID waits to take it over.
+func (h *MQTTHandler) disconnect(session *mqttSession, clean bool) {
+	h.mutex.RLock()
+	will, ended := session.will, session.ended
+	h.mutex.RUnlock()
+
+	h.stopDelivery(session)
+	h.quotaService.ReleaseConnection(session.quotaKey, 0)
+
+	if !clean && will != nil && !h.isShuttingDown() {
+		h.logger.Infof("Publishing last will of MQTT client %s to %s", session.ClientID, will.Topic)
+		if err := h.publish(session, will); err != nil {
+			h.logger.Warnf("Failed to publish last will of MQTT client %s: %v", session.ClientID, err)
+		}
+	}
+
+	h.mutex.Lock()
+	if h.sessions[session.ClientID] == session {
+		delete(h.sessions, session.ClientID)
+	}
+	park := session.persistent && !h.isShuttingDown()
+	if park {
+		h.parkSession(session)
+	}
+	h.mutex.Unlock()
+	if !park {
+		h.discardSession(session)
+	}
+
+	h.logger.Infof("MQTT client %s disconnected", session.ClientID)
+	close(ended)
+}
+
+// handlePublish publishes an inbound message. MQTT 3.1.1 cannot report publish failures,
+// so a rejected QoS 1 message is not acknowledged: the connection is closed instead and
+// the client redelivers the message when it reconnects. Rejected QoS 0 messages are dropped.
+func (h *MQTTHandler) handlePublish(session *mqttSession, publish *mqtt.Publish) error {
+	if publish.QoS > 1 {
+		return errQoS2Unsupported
+	}
+	if !validTopicName(publish.Topic) {
+		return fmt.Errorf("invalid topic name %q", publish.Topic)
+	}
+
+	if err := h.publish(session, publish); err != nil {
+		h.logger.Warnf("Failed to publish MQTT message from client %s to %s: %v", session.ClientID, publish.Topic, err)
+		if publish.QoS == 1 {
+			return fmt.Errorf("QoS 1 publish to %s rejected: %w", publish.Topic, err)
+		}
+		return nil
+	}
+
+	if publish.QoS == 1 {
+		return session.write(&mqtt.Puback{PacketID: publish.PacketID})
+	}
+	return nil
+}
+
+// publish publishes an MQTT message, creating its topic on first use if auto-creation is
+// enabled, and keeps it as the topic's retained message if the retain flag is set
+func (h *MQTTHandler) publish(session *mqttSession, publish *mqtt.Publish) error {
+	topic := pubsubTopicName(publish.Topic)
+	if h.config.TopicAutoCreate && !h.pubsub.HasTopic(topic) {
+		// Another client may create it concurrently
+		if _, err := h.topicService.CreateTopic(topic); err != nil && !models.IsErrorType(err, models.ErrTopicExists) {
+			return err
+		}
+	}
+
+	message := &models.Message{
+		ID:         generateClientID(),
+		Payload:    decodePayload(publish.Payload),
+		BestEffort: publish.QoS == 0,
+	}
+	if _, err := h.messageService.PublishMessage(session.publisher, topic, message); err != nil {
+		return err
+	}
+
+	if publish.Retain {
+		h.retain(session, publish)
+	}
+	return nil
+}
+
+// retain stores a topic's retained message against the publisher's retained bytes
+// quota; an empty payload clears it. A message over the quota clears it too, since the
+// previous one is no longer the topic's last.
+func (h *MQTTHandler) retain(session *mqttSession, publish *mqtt.Publish) {
+	var retained *mqttRetained
+	if len(publish.Payload) > 0 {
+		// Reserving may drop retained messages, which takes the handler lock
+		if err := h.quotaService.ReserveRetained(session.quotaKey, len(publish.Payload)); err != nil {
+			h.logger.Warnf("MQTT client %s message on %s not retained: %v", session.ClientID, publish.Topic, err)
+		} else {
+			retained = &mqttRetained{
+				publish: &mqtt.Publish{
+					QoS:     min(publish.QoS, 1),
+					Retain:  true,
+					Topic:   publish.Topic,
+					Payload: publish.Payload,
+				},
+				owner: session.quotaKey,
+			}
+		}
+	}
+
+	h.mutex.Lock()
+	previous := h.retained[publish.Topic]
+	if retained != nil {
+		h.retainOrder++
+		retained.order = h.retainOrder
+		h.retained[publish.Topic] = retained
+	} else {
+		delete(h.retained, publish.Topic)
+	}
+	h.mutex.Unlock()
+
+	if previous != nil {
+		h.quotaService.ReleaseRetained(previous.owner, len(previous.publish.Payload))
+	}
+}
+
+// dropRetained drops a client's oldest retained messages until at least size bytes are
+// released, and returns the bytes released
+func (h *MQTTHandler) dropRetained(client string, size int) int {
+	h.mutex.Lock()
+	var owned []*mqttRetained
+	for _, retained := range h.retained {
+		if retained.owner == client {
+			owned = append(owned, retained)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].order < owned[j].order
+	})
+
+	released := 0
+	for _, retained := range owned {
+		if released >= size {
+			break
+		}
+		delete(h.retained, retained.publish.Topic)
+		released += len(retained.publish.Payload)
+	}
+	h.mutex.Unlock()
+
+	if released > 0 {
+		h.quotaService.ReleaseRetained(client, released)
+	}
+	return released
+}
+
+// handleSubscribe subscribes the session to every topic matching each filter, then
+// sends the SUBACK and the matching retained messages. QoS 2 is granted as QoS 1. Each
+// filter counts as one subscription against the client's quota, however many topics it
+// matches.
+func (h *MQTTHandler) handleSubscribe(session *mqttSession, subscribe *mqtt.Subscribe) error {
+	topics := h.pubsub.GetTopics()
+	returnCodes := make([]byte, len(subscribe.Subscriptions))
+
+	session.mutex.Lock()
+	for i, subscription := range subscribe.Subscriptions {
+		if !validFilter(subscription.Filter) {
+			returnCodes[i] = mqtt.SubscribeFailure
+			continue
+		}
+
+		// Subscribing to a filter again only replaces its QoS
+		if _, exists := session.filters[subscription.Filter]; !exists {
+			if err := h.quotaService.AcquireSubscription(session.quotaKey); err != nil {
+				h.logger.Warnf("MQTT client %s failed to subscribe to filter %s: %v", session.ClientID, subscription.Filter, err)
+				returnCodes[i] = mqtt.SubscribeFailure
+				continue
+			}
+		}
+		granted := min(subscription.QoS, 1)
+		session.filters[subscription.Filter] = granted
+		returnCodes[i] = granted
+
+		for _, topic := range topics {
+			if !hasMQTTName(topic.Name) || !mqtt.Match(subscription.Filter, mqttTopicName(topic.Name)) {
+				continue
+			}
+			err := h.subscribeTopic(session, topic.Name)
+			if models.IsErrorType(err, models.ErrTopicNotFound) {
+				// Deleted since it was listed
+				continue
+			}
+			if err != nil {
+				h.logger.Warnf("MQTT client %s failed to subscribe to topic %s: %v", session.ClientID, topic.Name, err)
+				delete(session.filters, subscription.Filter)
+				h.quotaService.ReleaseSubscription(session.quotaKey)
+				returnCodes[i] = mqtt.SubscribeFailure
+				break
+			}
+		}
+	}
+	h.pruneTopics(session)
+	h.startDelivery(session)
+	session.mutex.Unlock()
+
+	if err := session.write(&mqtt.Suback{PacketID: subscribe.PacketID, ReturnCodes: returnCodes}); err != nil {
+		return err
+	}
+	h.logger.Infof("MQTT client %s subscribed to %d filters", session.ClientID, len(subscribe.Subscriptions))
+
+	for i, subscription := range subscribe.Subscriptions {
+		if returnCodes[i] == mqtt.SubscribeFailure {
+			continue
+		}
+		for _, retained := range h.retainedMatching(subscription.Filter) {
+			if err := session.deliver(retained.Topic, min(retained.QoS, returnCodes[i]), true, retained.Payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleUnsubscribe removes filters and unsubscribes from topics no remaining filter matches
+func (h *MQTTHandler) handleUnsubscribe(session *mqttSession, unsubscribe *mqtt.Unsubscribe) error {
+	session.mutex.Lock()
+	for _, filter := range unsubscribe.Filters {
+		if _, exists := session.filters[filter]; exists {
+			delete(session.filters, filter)
+			h.quotaService.ReleaseSubscription(session.quotaKey)
+		}
+	}
+	h.pruneTopics(session)
+	session.mutex.Unlock()
+
+	h.logger.Infof("MQTT client %s unsubscribed from %d filters", session.ClientID, len(unsubscribe.Filters))
+	return session.write(&mqtt.Unsuback{PacketID: unsubscribe.PacketID})
+}
+
+// subscribeTopic subscribes a session to a topic matched by its filters, which carry the
+// subscription quota. Parked sessions subscribe to topics created while they were away
+// when they are resumed. The session mutex must be held.
+func (h *MQTTHandler) subscribeTopic(session *mqttSession, topic string) error {
+	if session.closed || session.parked || session.topics[topic] {
+		return nil
+	}
+
+	if err := h.pubsub.Subscribe(session.SubscriberID, topic, 0); err != nil {
+		return err
+	}
+	session.topics[topic] = true
+	return nil
+}
+
+// startDelivery starts delivering a connected session's events once it has a subscriber.
+// The session mutex must be held.
+func (h *MQTTHandler) startDelivery(session *mqttSession) {
+	if session.delivering || session.parked {
+		return
+	}
+	messages := h.pubsub.GetSubscriberChannel(session.SubscriberID)
+	if messages == nil {
+		return
+	}
+	session.delivering = true
+	session.stop = make(chan struct{})
+	session.delivery.Add(1)
+	go h.deliver(session, session.Conn, messages, session.stop)
+}
+
+// pruneTopics unsubscribes a session from topics that none of its filters match. The
+// session mutex must be held.
+func (h *MQTTHandler) pruneTopics(session *mqttSession) {
+	for topic := range session.topics {
+		if _, matched := session.grantedQoS(mqttTopicName(topic)); matched {
+			continue
+		}
+		if err := h.pubsub.Unsubscribe(session.SubscriberID, topic); err != nil && !models.IsErrorType(err, models.ErrTopicNotFound) {
+			h.logger.Warnf("MQTT client %s failed to unsubscribe from topic %s: %v", session.ClientID, topic, err)
+		}
+		delete(session.topics, topic)
+	}
+}
+
+// deliver forwards a session's events to its connection until stopped. It is the only
+// reader of the subscriber channel, so events of all topics are delivered in order.
+func (h *MQTTHandler) deliver(session *mqttSession, conn net.Conn, messages <-chan *models.ServerMessage, stop <-chan struct{}) {
+	defer session.delivery.Done()
+	// The channel closes when the session ends or its queue overflowed
+	defer conn.Close()
+
+	for {
+		var message *models.ServerMessage
+		select {
+		case <-stop:
+			return
+		case received, ok := <-messages:
+			if !ok {
+				return
+			}
+			message = received
+		}
+
+		switch message.Type {
+		case "event":
+			if message.Message == nil {
+				continue
+			}
+			topicName := mqttTopicName(message.Topic)
+
+			session.mutex.Lock()
+			qos, matched := session.grantedQoS(topicName)
+			session.mutex.Unlock()
+			if !matched {
+				continue
+			}
+			if message.Message.BestEffort {
+				qos = 0
+			}
+			if qos > 0 && !session.awaitInflight(stop) {
+				return
+			}
+
+			payload, err := encodeEventPayload(message)
+			if err != nil {
+				h.logger.Errorf("Failed to encode event for MQTT client %s: %v", session.ClientID, err)
+				continue
+			}
+			if err := session.deliver(topicName, qos, false, payload); err != nil {
+				return
+			}
+		case "error":
+			// MQTT has no error packet; overflowing events are dropped
+			h.logger.Warnf("MQTT client %s dropped events: %s", session.ClientID, message.Error.Code)
+		}
+	}
+}
+
+// topicChanged subscribes sessions with matching filters to a created topic, and
+// forgets the subscriptions and retained message of a deleted topic
+func (h *MQTTHandler) topicChanged(topic string, created bool) {
+	if !hasMQTTName(topic) {
+		return
+	}
+	name := mqttTopicName(topic)
+
+	h.mutex.Lock()
+	retained := h.retained[name]
+	if !created {
+		delete(h.retained, name)
+	}
+	sessions := make([]*mqttSession, 0, len(h.sessions)+len(h.parked))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	for _, session := range h.parked {
+		sessions = append(sessions, session)
+	}
+	h.mutex.Unlock()
+
+	if !created && retained != nil {
+		h.quotaService.ReleaseRetained(retained.owner, len(retained.publish.Payload))
+	}
+
+	for _, session := range sessions {
+		session.mutex.Lock()
+		if created {
+			if _, matched := session.grantedQoS(name); matched {
+				if err := h.subscribeTopic(session, topic); err != nil {
+					h.logger.Warnf("MQTT client %s failed to subscribe to new topic %s: %v", session.ClientID, topic, err)
+				}
+				h.startDelivery(session)
+			}
+		} else {
+			delete(session.topics, topic)
+		}
+		session.mutex.Unlock()
+	}
+}
+
+// retainedMatching returns the retained messages whose topic matches a filter
+func (h *MQTTHandler) retainedMatching(filter string) []*mqtt.Publish {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var matching []*mqtt.Publish
+	for name, retained := range h.retained {
+		if mqtt.Match(filter, name) {
+			matching = append(matching, retained.publish)
+		}
+	}
+	return matching
+}
+
+// GetActiveClients returns information about all MQTT clients, including persistent
+// sessions awaiting a connection
+func (h *MQTTHandler) GetActiveClients() []models.ClientInfo {
+	h.mutex.RLock()
+	sessions := make([]*mqttSession, 0, len(h.sessions)+len(h.parked))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	for _, session := range h.parked {
+		sessions = append(sessions, session)
+	}
+	h.mutex.RUnlock()
+
+	clients := make([]models.ClientInfo, 0, len(sessions))
+	for _, session := range sessions {
+		session.mutex.Lock()
+		topics := make([]string, 0, len(session.topics))
+		for topic := range session.topics {
+			topics = append(topics, topic)
+		}
+		remoteAddr, connectedAt, connected := session.Conn.RemoteAddr().String(), session.ConnectedAt, !session.parked
+		session.mutex.Unlock()
+
+		subscriberQueues := make(map[string]models.QueueStats)
+		if subscriber := h.pubsub.GetSubscriber(session.SubscriberID); subscriber != nil {
+			subscriberQueues[session.SubscriberID] = subscriber.QueueStats()
+		}
+
+		clients = append(clients, models.ClientInfo{
+			ID:               session.ClientID,
+			Protocol:         "mqtt",
+			RemoteAddr:       remoteAddr,
+			Topics:           topics,
+			ConnectedAt:      connectedAt,
+			IsConnected:      connected,
+			SubscriberQueues: subscriberQueues,
+		})
+	}
+	return clients
+}
+
+// Shutdown stops accepting connections and closes all sessions without publishing
+// their last wills
+func (h *MQTTHandler) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.done)
+	})
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	for _, session := range h.sessions {
+		session.Conn.Close()
+	}
+	for _, session := range h.parked {
+		session.expiry.Stop()
+	}
+}
+
+// isShuttingDown reports whether Shutdown was called
+func (h *MQTTHandler) isShuttingDown() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// grantedQoS returns the highest QoS granted by the session's filters matching an MQTT
+// topic name. The session mutex must be held.
+func (s *mqttSession) grantedQoS(name string) (byte, bool) {
+	qos, matched := byte(0), false
+	for filter, granted := range s.filters {
+		if mqtt.Match(filter, name) {
+			qos, matched = max(qos, granted), true
+		}
+	}
+	return qos, matched
+}
+
+// deliver sends an application message to the client. QoS 1 deliveries are numbered
+// and kept until the client acknowledges them, so they are resent if the session is
+// resumed before then.
+func (s *mqttSession) deliver(topicName string, qos byte, retain bool, payload []byte) error {
+	publish := &mqtt.Publish{QoS: qos, Retain: retain, Topic: topicName, Payload: payload}
+	if qos > 0 {
+		s.mutex.Lock()
+		publish.PacketID = s.nextPacketID()
+		s.inflight = append(s.inflight, publish)
+		s.mutex.Unlock()
+	}
+	return s.write(publish)
+}
+
+// nextPacketID returns the next packet identifier not used by an inflight delivery. The
+// session mutex must be held.
+func (s *mqttSession) nextPacketID() uint16 {
+	for {
+		s.packetID++
+		if s.packetID == 0 {
+			continue
+		}
+		inUse := false
+		for _, publish := range s.inflight {
+			if publish.PacketID == s.packetID {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			return s.packetID
+		}
+	}
+}
+
+// acknowledge completes the inflight delivery a PUBACK refers to
+func (s *mqttSession) acknowledge(packetID uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, publish := range s.inflight {
+		if publish.PacketID == packetID {
+			s.inflight = append(s.inflight[:i], s.inflight[i+1:]...)
+			select {
+			case s.acked <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// awaitInflight waits until fewer than mqttMaxInflight deliveries await PUBACK. It
+// returns false if delivery is stopped first.
+func (s *mqttSession) awaitInflight(stop <-chan struct{}) bool {
+	for {
+		s.mutex.Lock()
+		full := len(s.inflight) >= mqttMaxInflight
+		s.mutex.Unlock()
+		if !full {
+			return true
+		}
+
+		select {
+		case <-s.acked:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// write sends a packet to the client
+func (s *mqttSession) write(packet mqtt.Packet) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.Conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	return mqtt.WritePacket(s.Conn, packet)
+}
+
+// validTopicName reports whether an MQTT topic name may be published to. '.' would map
+// to a level separator on the way back, so it is not allowed.
+func validTopicName(name string) bool {
+	return mqtt.ValidTopicName(name) && !strings.Contains(name, ".")
+}
+
+// validFilter reports whether an MQTT topic filter is well-formed and free of '.'
+func validFilter(filter string) bool {
+	return mqtt.ValidFilter(filter) && !strings.Contains(filter, ".")
+}
+
+// hasMQTTName reports whether a topic is visible over MQTT. The MQTT name of a topic
+// containing '/' would map back to a different topic.
+func hasMQTTName(topic string) bool {
+	return !strings.Contains(topic, "/")
+}
+
+// pubsubTopicName maps an MQTT topic name to a topic name
+func pubsubTopicName(name string) string {
+	return strings.ReplaceAll(name, "/", ".")
+}
+
+// mqttTopicName maps a topic name to an MQTT topic name
+func mqttTopicName(topic string) string {
+	return strings.ReplaceAll(topic, ".", "/")
+}
+
+// remoteHost returns the host of a remote address
+func remoteHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"time"
+
+	"pub-sub/models"
+)
+
+// parkSession keeps a persistent session whose connection ended for the session expiry.
+// Its subscriber keeps queuing messages and its subscriptions keep counting against the
+// client's quota. Caller must hold the handler lock.
+func (h *MQTTHandler) parkSession(session *mqttSession) {
+	session.expiry = time.AfterFunc(time.Duration(h.config.MQTTSessionExpiry)*time.Second, func() {
+		h.expireSession(session)
+	})
+	h.parked[session.ClientID] = session
+
+	h.logger.Infof("MQTT session of client %s kept for %ds", session.ClientID, h.config.MQTTSessionExpiry)
+}
+
+// resumeSession restores delivery to a session resumed by a new connection. Deliveries
+// the client had not acknowledged are resent first with the DUP flag. A subscriber
+// removed for overflowing its queue while the client was away is replaced, and topics
+// created meanwhile that match the session's filters are subscribed.
+func (h *MQTTHandler) resumeSession(session *mqttSession) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	for _, publish := range session.inflight {
+		publish.Dup = true
+		if err := session.write(publish); err != nil {
+			// The connection's read loop notices the failure and parks the session again
+			h.logger.Debugf("MQTT client %s resend failed: %v", session.ClientID, err)
+			return
+		}
+	}
+
+	if h.pubsub.GetSubscriber(session.SubscriberID) == nil && len(session.topics) > 0 {
+		h.logger.Warnf("MQTT client %s lost queued messages while disconnected: subscriber queue overflow", session.ClientID)
+		session.topics = make(map[string]bool)
+	}
+
+	session.parked = false
+	for _, topic := range h.pubsub.GetTopics() {
+		if !hasMQTTName(topic.Name) {
+			continue
+		}
+		if _, matched := session.grantedQoS(mqttTopicName(topic.Name)); !matched {
+			continue
+		}
+		if err := h.subscribeTopic(session, topic.Name); err != nil && !models.IsErrorType(err, models.ErrTopicNotFound) {
+			h.logger.Warnf("MQTT client %s failed to subscribe to topic %s: %v", session.ClientID, topic.Name, err)
+		}
+	}
+	h.startDelivery(session)
+
+	h.logger.Infof("MQTT session of client %s resumed: topics=%d, resent=%d", session.ClientID, len(session.topics), len(session.inflight))
+}
+
+// expireSession discards a parked session whose expiry ended without resumption
+func (h *MQTTHandler) expireSession(session *mqttSession) {
+	h.mutex.Lock()
+	if h.parked[session.ClientID] != session {
+		h.mutex.Unlock()
+		return
+	}
+	delete(h.parked, session.ClientID)
+	h.mutex.Unlock()
+
+	h.discardSession(session)
+	h.logger.Infof("MQTT session of client %s expired", session.ClientID)
+}
+
+// discardSession ends a session for good, removing its subscriber and releasing the
+// subscriptions of its filters
+func (h *MQTTHandler) discardSession(session *mqttSession) {
+	session.mutex.Lock()
+	session.closed = true
+	subscriptions := len(session.filters)
+	session.topics = make(map[string]bool)
+	session.mutex.Unlock()
+
+	h.pubsub.RemoveSubscriber(session.SubscriberID)
+	for i := 0; i < subscriptions; i++ {
+		h.quotaService.ReleaseSubscription(session.quotaKey)
+	}
+	// Rate limits keyed by the session itself end with it
+	if session.publisher.RateKey == session.SubscriberID {
+		h.messageService.ForgetClient(session.publisher.RateKey)
+	}
+}
+
+// stopDelivery stops a session's delivery goroutine when its connection ends and waits
+// for it to exit. Nothing is delivered again until the session is resumed.
+func (h *MQTTHandler) stopDelivery(session *mqttSession) {
+	session.mutex.Lock()
+	session.parked = true
+	stop := session.stop
+	session.stop = nil
+	session.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	session.delivery.Wait()
+
+	session.mutex.Lock()
+	session.delivering = false
+	session.mutex.Unlock()
+}
@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/mqtt"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"pub-sub/services"
+)
+
+// mqttClient is a minimal MQTT client for driving the handler
+type mqttClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newMQTTServer serves MQTT on a local port and returns the handler and its address.
+// Topic auto-creation is enabled unless a configure function changes it.
+func newMQTTServer(t *testing.T, configure ...func(*config.Config)) (*MQTTHandler, string) {
+	t.Helper()
+
+	cfg := &config.Config{
+		MaxMessagesPerTopic:  10,
+		MaxPublishRate:       1000,
+		MaxClientPublishRate: 1000,
+		MaxBatchSize:         10,
+		MaxMessageSize:       1024,
+		MaxFrameSize:         4096,
+		DefaultQueueSize:     10,
+		MaxQueueSize:         100,
+		MQTTSessionExpiry:    60,
+		TopicAutoCreate:      true,
+	}
+	for _, apply := range configure {
+		apply(cfg)
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	schemas := services.NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	quotas := services.NewQuotaService(ps, cfg, log)
+	handler := NewMQTTHandler(
+		ps,
+		services.NewTopicService(ps, schemas, log),
+		services.NewMessageService(ps, quotas, schemas, metrics.NewRejections(), cfg, log),
+		quotas,
+		cfg,
+		log,
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go handler.Serve(listener)
+	t.Cleanup(handler.Shutdown)
+	return handler, listener.Addr().String()
+}
+
+// connectMQTT opens a connection and completes the CONNECT handshake for a clean session
+func connectMQTT(t *testing.T, addr string, connect *mqtt.Connect) *mqttClient {
+	t.Helper()
+	connect.CleanSession = true
+	client, _ := resumeMQTT(t, addr, connect)
+	return client
+}
+
+// resumeMQTT opens a connection, completes the CONNECT handshake with the packet's
+// CleanSession flag and returns whether a session was present
+func resumeMQTT(t *testing.T, addr string, connect *mqtt.Connect) (*mqttClient, bool) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := &mqttClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	connect.ProtocolName, connect.ProtocolLevel = "MQTT", mqtt.ProtocolLevel
+	client.send(connect)
+	connack, ok := client.receive().(*mqtt.Connack)
+	if !ok || connack.ReturnCode != mqtt.Accepted {
+		t.Fatalf("Expected accepted CONNACK, got %+v", connack)
+	}
+	return client, connack.SessionPresent
+}
+
+// waitForParked waits until the MQTT session of a client is parked
+func waitForParked(t *testing.T, handler *MQTTHandler, clientID string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		handler.mutex.RLock()
+		_, parked := handler.parked[clientID]
+		handler.mutex.RUnlock()
+		if parked {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the session of %s to be kept", clientID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (c *mqttClient) send(packet mqtt.Packet) {
+	c.t.Helper()
+	if err := mqtt.WritePacket(c.conn, packet); err != nil {
+		c.t.Fatalf("Failed to send %T: %v", packet, err)
+	}
+}
+
+func (c *mqttClient) receive() mqtt.Packet {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet, err := mqtt.ReadPacket(c.reader, 4096)
+	if err != nil {
+		c.t.Fatalf("Failed to receive packet: %v", err)
+	}
+	return packet
+}
+
+// expectPublish receives a PUBLISH and checks its topic, payload, QoS and retain flag
+func (c *mqttClient) expectPublish(topic, payload string, qos byte, retain bool) {
+	c.t.Helper()
+	publish, ok := c.receive().(*mqtt.Publish)
+	if !ok || publish.Topic != topic || string(publish.Payload) != payload || publish.QoS != qos || publish.Retain != retain {
+		c.t.Fatalf("Expected PUBLISH %s %q qos=%d retain=%v, got %+v", topic, payload, qos, retain, publish)
+	}
+}
+
+func TestMQTTPublishSubscribe(t *testing.T) {
+	handler, addr := newMQTTServer(t)
+
+	subscriber := connectMQTT(t, addr, &mqtt.Connect{ClientID: "subscriber"})
+	subscriber.send(&mqtt.Subscribe{PacketID: 1, Subscriptions: []mqtt.Subscription{
+		{Filter: "sensors/+/temp", QoS: 2},
+		{Filter: "sensors/#/bad", QoS: 0},
+	}})
+	if suback, ok := subscriber.receive().(*mqtt.Suback); !ok || suback.ReturnCodes[0] != 1 || suback.ReturnCodes[1] != mqtt.SubscribeFailure {
+		t.Fatalf("Expected SUBACK granting QoS 1 and rejecting the bad filter, got %+v", suback)
+	}
+
+	publisher := connectMQTT(t, addr, &mqtt.Connect{
+		ClientID: "publisher",
+		Will:     &mqtt.Publish{Topic: "status/publisher", Payload: []byte("offline")},
+	})
+
+	// Publishing creates the topic, which the wildcard subscription picks up
+	publisher.send(&mqtt.Publish{QoS: 1, Retain: true, Topic: "sensors/room1/temp", PacketID: 5, Payload: []byte(`{"c":21.5}`)})
+	if puback, ok := publisher.receive().(*mqtt.Puback); !ok || puback.PacketID != 5 {
+		t.Fatalf("Expected PUBACK 5, got %+v", puback)
+	}
+	subscriber.expectPublish("sensors/room1/temp", `{"c":21.5}`, 1, false)
+
+	// QoS 0 publishes are delivered at QoS 0
+	publisher.send(&mqtt.Publish{Topic: "sensors/room2/temp", Payload: []byte("20")})
+	subscriber.expectPublish("sensors/room2/temp", "20", 0, false)
+
+	// New subscriptions receive the retained message
+	late := connectMQTT(t, addr, &mqtt.Connect{ClientID: "late"})
+	late.send(&mqtt.Subscribe{PacketID: 2, Subscriptions: []mqtt.Subscription{{Filter: "sensors/#", QoS: 0}}})
+	if _, ok := late.receive().(*mqtt.Suback); !ok {
+		t.Fatal("Expected SUBACK")
+	}
+	late.expectPublish("sensors/room1/temp", `{"c":21.5}`, 0, true)
+
+	clients := handler.GetActiveClients()
+	if len(clients) != 3 || clients[0].Protocol != "mqtt" {
+		t.Errorf("Expected 3 MQTT clients, got %+v", clients)
+	}
+
+	// An abnormal disconnect publishes the last will
+	subscriber.send(&mqtt.Subscribe{PacketID: 3, Subscriptions: []mqtt.Subscription{{Filter: "status/#", QoS: 1}}})
+	if _, ok := subscriber.receive().(*mqtt.Suback); !ok {
+		t.Fatal("Expected SUBACK")
+	}
+	publisher.conn.Close()
+	subscriber.expectPublish("status/publisher", "offline", 0, false)
+
+	// A clean disconnect discards it
+	late.send(&mqtt.Unsubscribe{PacketID: 4, Filters: []string{"sensors/#"}})
+	if _, ok := late.receive().(*mqtt.Unsuback); !ok {
+		t.Fatal("Expected UNSUBACK")
+	}
+	late.send(&mqtt.Disconnect{})
+	subscriber.send(&mqtt.Pingreq{})
+	if _, ok := subscriber.receive().(*mqtt.Pingresp); !ok {
+		t.Fatal("Expected PINGRESP")
+	}
+}
+
+func TestMQTTRejectedPublish(t *testing.T) {
+	_, addr := newMQTTServer(t)
+	client := connectMQTT(t, addr, &mqtt.Connect{ClientID: "publisher"})
+	oversized := []byte(strings.Repeat("x", 2048))
+
+	// Rejected QoS 0 publishes are dropped and the connection stays open
+	client.send(&mqtt.Publish{Topic: "sensors/room1/temp", Payload: oversized})
+	client.send(&mqtt.Pingreq{})
+	if _, ok := client.receive().(*mqtt.Pingresp); !ok {
+		t.Fatal("Expected PINGRESP")
+	}
+
+	// Rejected QoS 1 publishes are not acknowledged; the connection is closed instead
+	client.send(&mqtt.Publish{QoS: 1, Topic: "sensors/room1/temp", PacketID: 7, Payload: oversized})
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if packet, err := mqtt.ReadPacket(client.reader, 4096); err == nil {
+		t.Fatalf("Expected the connection to be closed, got %+v", packet)
+	}
+}
+
+func TestMQTTTopicNamesWithDots(t *testing.T) {
+	handler, addr := newMQTTServer(t)
+
+	// Topics whose names contain '/' have no MQTT name
+	if err := handler.pubsub.CreateTopic("a/b"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+	client := connectMQTT(t, addr, &mqtt.Connect{ClientID: "client"})
+	client.send(&mqtt.Subscribe{PacketID: 1, Subscriptions: []mqtt.Subscription{
+		{Filter: "sensors.room1/#", QoS: 0},
+		{Filter: "#", QoS: 0},
+	}})
+	if suback, ok := client.receive().(*mqtt.Suback); !ok || suback.ReturnCodes[0] != mqtt.SubscribeFailure || suback.ReturnCodes[1] != 0 {
+		t.Fatalf("Expected SUBACK rejecting the filter with a '.', got %+v", suback)
+	}
+	if clients := handler.GetActiveClients(); len(clients) != 1 || len(clients[0].Topics) != 0 {
+		t.Errorf("Expected no topic to be subscribed, got %+v", clients)
+	}
+
+	// Publishing to a name with a '.' closes the connection
+	client.send(&mqtt.Publish{Topic: "sensors.room1", Payload: []byte("20")})
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if packet, err := mqtt.ReadPacket(client.reader, 4096); err == nil {
+		t.Fatalf("Expected the connection to be closed, got %+v", packet)
+	}
+}
+
+func TestMQTTPersistentSession(t *testing.T) {
+	handler, addr := newMQTTServer(t)
+	if err := handler.pubsub.CreateTopic("orders.1"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+
+	client, present := resumeMQTT(t, addr, &mqtt.Connect{ClientID: "durable"})
+	if present {
+		t.Fatal("Expected no session to be present on the first connection")
+	}
+	client.send(&mqtt.Subscribe{PacketID: 1, Subscriptions: []mqtt.Subscription{{Filter: "orders/#", QoS: 1}}})
+	if _, ok := client.receive().(*mqtt.Suback); !ok {
+		t.Fatal("Expected SUBACK")
+	}
+
+	// Messages published while the client is away are queued for the session
+	client.conn.Close()
+	waitForParked(t, handler, "durable")
+	publisher := connectMQTT(t, addr, &mqtt.Connect{ClientID: "publisher"})
+	publisher.send(&mqtt.Publish{QoS: 1, Topic: "orders/1", PacketID: 1, Payload: []byte("queued")})
+	if _, ok := publisher.receive().(*mqtt.Puback); !ok {
+		t.Fatal("Expected PUBACK")
+	}
+	if clients := handler.GetActiveClients(); len(clients) != 2 {
+		t.Errorf("Expected the parked session to be listed, got %+v", clients)
+	}
+
+	client, present = resumeMQTT(t, addr, &mqtt.Connect{ClientID: "durable"})
+	if !present {
+		t.Fatal("Expected the session to be present")
+	}
+	client.expectPublish("orders/1", "queued", 1, false)
+
+	// The subscription carries on after resumption
+	publisher.send(&mqtt.Publish{Topic: "orders/1", Payload: []byte("live")})
+	client.expectPublish("orders/1", "live", 0, false)
+
+	// A clean session discards the stored one
+	client.conn.Close()
+	waitForParked(t, handler, "durable")
+	if _, present := resumeMQTT(t, addr, &mqtt.Connect{ClientID: "durable", CleanSession: true}); present {
+		t.Error("Expected a clean session to start without the stored session")
+	}
+}
+
+func TestMQTTResendUnacknowledged(t *testing.T) {
+	handler, addr := newMQTTServer(t)
+	if err := handler.pubsub.CreateTopic("orders"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+
+	client, _ := resumeMQTT(t, addr, &mqtt.Connect{ClientID: "durable"})
+	client.send(&mqtt.Subscribe{PacketID: 1, Subscriptions: []mqtt.Subscription{{Filter: "orders", QoS: 1}}})
+	if _, ok := client.receive().(*mqtt.Suback); !ok {
+		t.Fatal("Expected SUBACK")
+	}
+	publisher := connectMQTT(t, addr, &mqtt.Connect{ClientID: "publisher"})
+	for _, payload := range []string{"first", "second"} {
+		publisher.send(&mqtt.Publish{QoS: 1, Topic: "orders", PacketID: 1, Payload: []byte(payload)})
+		if _, ok := publisher.receive().(*mqtt.Puback); !ok {
+			t.Fatal("Expected PUBACK")
+		}
+	}
+
+	// Only the first delivery is acknowledged before the connection drops
+	first, ok := client.receive().(*mqtt.Publish)
+	if !ok || string(first.Payload) != "first" || first.Dup {
+		t.Fatalf("Expected the first delivery, got %+v", first)
+	}
+	second, ok := client.receive().(*mqtt.Publish)
+	if !ok || string(second.Payload) != "second" {
+		t.Fatalf("Expected the second delivery, got %+v", second)
+	}
+	client.send(&mqtt.Puback{PacketID: first.PacketID})
+	client.send(&mqtt.Pingreq{})
+	if _, ok := client.receive().(*mqtt.Pingresp); !ok {
+		t.Fatal("Expected PINGRESP")
+	}
+	client.conn.Close()
+	waitForParked(t, handler, "durable")
+
+	// The unacknowledged delivery is resent with the DUP flag, ahead of anything else
+	client, _ = resumeMQTT(t, addr, &mqtt.Connect{ClientID: "durable"})
+	resent, ok := client.receive().(*mqtt.Publish)
+	if !ok || string(resent.Payload) != "second" || !resent.Dup || resent.PacketID != second.PacketID {
+		t.Fatalf("Expected the second delivery to be resent with DUP, got %+v", resent)
+	}
+	client.send(&mqtt.Puback{PacketID: resent.PacketID})
+	client.send(&mqtt.Pingreq{})
+	if _, ok := client.receive().(*mqtt.Pingresp); !ok {
+		t.Fatal("Expected PINGRESP")
+	}
+
+	// Acknowledged deliveries are not resent
+	client.conn.Close()
+	waitForParked(t, handler, "durable")
+	client, _ = resumeMQTT(t, addr, &mqtt.Connect{ClientID: "durable"})
+	client.send(&mqtt.Pingreq{})
+	if packet, ok := client.receive().(*mqtt.Pingresp); !ok {
+		t.Fatalf("Expected PINGRESP without resends, got %+v", packet)
+	}
+}
+
+func TestMQTTTopicAutoCreateDisabled(t *testing.T) {
+	handler, addr := newMQTTServer(t, func(cfg *config.Config) {
+		cfg.TopicAutoCreate = false
+	})
+	client := connectMQTT(t, addr, &mqtt.Connect{ClientID: "publisher"})
+
+	// Publishing to a missing topic does not create it
+	client.send(&mqtt.Publish{Topic: "sensors/room1/temp", Payload: []byte("20")})
+	client.send(&mqtt.Pingreq{})
+	if _, ok := client.receive().(*mqtt.Pingresp); !ok {
+		t.Fatal("Expected PINGRESP")
+	}
+	if handler.pubsub.HasTopic("sensors.room1.temp") {
+		t.Error("Expected the topic not to be created")
+	}
+}
+
+func TestMQTTSubscriptionQuota(t *testing.T) {
+	handler, addr := newMQTTServer(t, func(cfg *config.Config) {
+		cfg.MaxSubscriptionsPerClient = 2
+	})
+	for _, topic := range []string{"sensors.room1", "sensors.room2", "sensors.room3"} {
+		if err := handler.pubsub.CreateTopic(topic); err != nil {
+			t.Fatalf("CreateTopic failed: %v", err)
+		}
+	}
+	client := connectMQTT(t, addr, &mqtt.Connect{ClientID: "client"})
+	subscribe := func(packetID uint16, filter string) byte {
+		t.Helper()
+		client.send(&mqtt.Subscribe{PacketID: packetID, Subscriptions: []mqtt.Subscription{{Filter: filter, QoS: 0}}})
+		suback, ok := client.receive().(*mqtt.Suback)
+		if !ok {
+			t.Fatalf("Expected SUBACK, got %+v", suback)
+		}
+		return suback.ReturnCodes[0]
+	}
+
+	// A wildcard counts as one subscription however many topics it matches, and
+	// subscribing to a filter again is not charged
+	if code := subscribe(1, "#"); code != 0 {
+		t.Fatalf("Expected the wildcard to be granted, got %#x", code)
+	}
+	if code := subscribe(2, "sensors/+"); code != 0 {
+		t.Fatalf("Expected a second filter to be granted, got %#x", code)
+	}
+	if code := subscribe(3, "#"); code != 0 {
+		t.Fatalf("Expected the wildcard to be granted again, got %#x", code)
+	}
+	if clients := handler.GetActiveClients(); len(clients) != 1 || len(clients[0].Topics) != 3 {
+		t.Errorf("Expected 3 subscribed topics, got %+v", clients)
+	}
+
+	// A filter over the quota is rejected until another one is unsubscribed
+	if code := subscribe(4, "sensors/room1"); code != mqtt.SubscribeFailure {
+		t.Fatalf("Expected the filter over the quota to be rejected, got %#x", code)
+	}
+	client.send(&mqtt.Unsubscribe{PacketID: 5, Filters: []string{"#"}})
+	if _, ok := client.receive().(*mqtt.Unsuback); !ok {
+		t.Fatal("Expected UNSUBACK")
+	}
+	if code := subscribe(6, "sensors/room1"); code != 0 {
+		t.Fatalf("Expected the filter to be granted after unsubscribing, got %#x", code)
+	}
+}
+
+func TestMQTTRetainedQuota(t *testing.T) {
+	handler, addr := newMQTTServer(t, func(cfg *config.Config) {
+		cfg.MaxRetainedBytesPerClient = 300
+	})
+	client := connectMQTT(t, addr, &mqtt.Connect{ClientID: "publisher"})
+	payload := []byte(strings.Repeat("x", 100))
+	retainedBytes := func() int {
+		report := handler.quotaService.GetQuotas()
+		if len(report.Clients) != 1 {
+			t.Fatalf("Expected one client in the quota report, got %+v", report.Clients)
+		}
+		return report.Clients[0].RetainedBytes
+	}
+
+	// Retained messages count against the quota; the publisher's oldest are dropped so
+	// it keeps retaining its latest ones
+	for i := 1; i <= 5; i++ {
+		client.send(&mqtt.Publish{QoS: 1, Retain: true, Topic: fmt.Sprintf("sensors/room%d", i), PacketID: uint16(i), Payload: payload})
+		if puback, ok := client.receive().(*mqtt.Puback); !ok || puback.PacketID != uint16(i) {
+			t.Fatalf("Expected PUBACK %d, got %+v", i, puback)
+		}
+		if used := retainedBytes(); used > 300 {
+			t.Fatalf("Expected at most 300 retained bytes, got %d", used)
+		}
+	}
+	handler.mutex.RLock()
+	_, latest := handler.retained["sensors/room5"]
+	_, oldest := handler.retained["sensors/room1"]
+	handler.mutex.RUnlock()
+	if !latest || oldest {
+		t.Errorf("Expected the latest retained message to be kept and the oldest dropped")
+	}
+
+	// An empty payload clears the retained message, and deleting the topics releases
+	// every retained byte
+	client.send(&mqtt.Publish{QoS: 1, Retain: true, Topic: "sensors/room5", PacketID: 6})
+	if _, ok := client.receive().(*mqtt.Puback); !ok {
+		t.Fatal("Expected PUBACK")
+	}
+	handler.mutex.RLock()
+	_, latest = handler.retained["sensors/room5"]
+	handler.mutex.RUnlock()
+	if latest {
+		t.Error("Expected the empty payload to clear the retained message")
+	}
+	for i := 1; i <= 5; i++ {
+		if err := handler.pubsub.DeleteTopic(fmt.Sprintf("sensors.room%d", i)); err != nil {
+			t.Fatalf("DeleteTopic failed: %v", err)
+		}
+	}
+	if used := retainedBytes(); used != 0 {
+		t.Errorf("Expected no retained bytes after deleting the topics, got %d", used)
+	}
+}
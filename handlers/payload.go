@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+
+	"pub-sub/models"
+)
+
+// decodePayload converts the raw payload of an MQTT, STOMP or Redis message to a
+// message payload: JSON objects and arrays are decoded, other UTF-8 text becomes a string and
+// binary data stays bytes
+func decodePayload(payload []byte) interface{} {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var value interface{}
+		if err := json.Unmarshal(trimmed, &value); err == nil {
+			return value
+		}
+	}
+	if utf8.Valid(payload) {
+		return string(payload)
+	}
+	return payload
+}
+
+// encodeEventPayload returns the raw payload of an event for MQTT, STOMP and Redis
+// clients, sharing the encoding across all recipients of a fan-out message
+func encodeEventPayload(message *models.ServerMessage) ([]byte, error) {
+	if message.Frames == nil {
+		return encodePayload(message.Message.Payload)
+	}
+	payload, err := message.Frames.Get("payload", func() (any, error) {
+		return encodePayload(message.Message.Payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payload.([]byte), nil
+}
+
+// encodePayload encodes a message payload as raw bytes: strings and bytes are sent as
+// is, other values as JSON
+func encodePayload(payload interface{}) ([]byte, error) {
+	switch value := payload.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	}
+	return json.Marshal(payload)
+}
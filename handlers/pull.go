@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"pub-sub/models"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// pullWriteTimeout is the time allowed to write a pull response once its wait is over
+const pullWriteTimeout = 15 * time.Second
+
+// PullMessages handles POST /topics/{name}/pull endpoint
+func (h *RestHandler) PullMessages(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	// An empty body pulls from the oldest retained message without waiting
+	var request models.PullRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		h.sendInvalidBody(w, err)
+		return
+	}
+
+	// Long polls outlive the server's write timeout
+	if request.WaitMs > 0 {
+		deadline := time.Now().Add(time.Duration(request.WaitMs)*time.Millisecond + pullWriteTimeout)
+		http.NewResponseController(w).SetWriteDeadline(deadline)
+	}
+
+	response, err := h.messageService.Pull(r.Context(), topicName, &request)
+	if err != nil {
+		switch {
+		case models.IsErrorType(err, models.ErrTopicNotFound):
+			h.sendErrorResponse(w, http.StatusNotFound, err.Error(), "TOPIC_NOT_FOUND")
+		case models.IsErrorType(err, models.ErrInvalidCursor):
+			h.sendErrorResponse(w, http.StatusBadRequest, "Cursor is beyond the newest message", "INVALID_CURSOR")
+		case models.IsErrorType(err, models.ErrInvalidRequest):
+			h.sendErrorResponse(w, http.StatusBadRequest, "max_messages and wait_ms must not be negative", "INVALID_REQUEST")
+		default:
+			h.logger.Errorf("Failed to pull messages from topic %s: %v", topicName, err)
+			h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), "INTERNAL")
+		}
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
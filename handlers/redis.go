@@ -0,0 +1,680 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/resp"
+	"pub-sub/services"
+)
+
+// redisWriteTimeout bounds each reply write, so a stalled client does not block delivery forever
+const redisWriteTimeout = 10 * time.Second
+
+// RedisHandler serves Redis clients speaking RESP2 pub/sub commands. Redis channels are
+// topic names; publishing to a channel creates its topic on first use.
+type RedisHandler struct {
+	pubsub         *pubsub.PubSub           // Reference to the pub-sub system
+	topicService   *services.TopicService   // Creates topics on first publish
+	messageService *services.MessageService // Publishes messages under rate limits and quotas
+	quotaService   *services.QuotaService   // Per-client quota enforcement
+	config         *config.Config           // System configuration
+	logger         logger.Logger            // Logger instance
+	sessions       map[string]*redisSession // Connected sessions keyed by ID
+	listener       net.Listener             // Listener accepting connections, closed on shutdown
+	mutex          sync.RWMutex             // Protects sessions and listener
+	done           chan struct{}            // Closed on shutdown
+	shutdownOnce   sync.Once                // Guards closing done
+}
+
+// redisSession is one connected Redis client
+type redisSession struct {
+	ID           string    // Client identifier
+	SubscriberID string    // Pub-sub subscriber receiving the session's topics
+	Conn         net.Conn  // Client connection
+	ConnectedAt  time.Time // When the client connected
+
+	quotaKey  string             // Quota identity: the remote IP
+	publisher services.Publisher // Publishing identity for rate limits and quotas
+
+	channels   map[string]bool // Subscribed channels
+	patterns   map[string]bool // Subscribed channel patterns
+	topics     map[string]bool // Subscribed topics matched by the channels and patterns
+	delivering bool            // Whether the delivery goroutine runs
+	closed     bool            // Set once the session ends; no further subscriptions
+	mutex      sync.Mutex      // Protects the subscription state
+
+	writer     *resp.Writer // Reply writer
+	writeMutex sync.Mutex   // Serializes replies
+}
+
+// NewRedisHandler creates a new Redis handler and registers it for topic changes, so
+// channels and patterns pick up topics created later
+func NewRedisHandler(pubsub *pubsub.PubSub, topicService *services.TopicService, messageService *services.MessageService, quotaService *services.QuotaService, cfg *config.Config, log logger.Logger) *RedisHandler {
+	handler := &RedisHandler{
+		pubsub:         pubsub,
+		topicService:   topicService,
+		messageService: messageService,
+		quotaService:   quotaService,
+		config:         cfg,
+		logger:         log,
+		sessions:       make(map[string]*redisSession),
+		done:           make(chan struct{}),
+	}
+	pubsub.AddTopicHandler(handler.topicChanged)
+	return handler
+}
+
+// Serve accepts Redis connections until the listener fails or the handler shuts down
+func (h *RedisHandler) Serve(listener net.Listener) error {
+	h.mutex.Lock()
+	h.listener = listener
+	h.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-h.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go h.handleConnection(conn)
+	}
+}
+
+// handleConnection runs one Redis connection until QUIT or disconnect
+func (h *RedisHandler) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	session, err := h.connect(conn)
+	if err != nil {
+		h.logger.Warnf("Redis client from %s refused: %v", conn.RemoteAddr(), err)
+		writer := resp.NewWriter(conn)
+		writer.Error(errorCode(err) + " connection refused")
+		conn.SetWriteDeadline(time.Now().Add(redisWriteTimeout))
+		writer.Flush()
+		return
+	}
+	defer h.disconnect(session)
+	h.logger.Infof("Redis client %s connected from %s", session.ID, conn.RemoteAddr())
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := resp.ReadCommand(reader, h.config.MaxFrameSize)
+		if errors.Is(err, resp.ErrProtocol) || errors.Is(err, resp.ErrTooLarge) {
+			session.reply(func(w *resp.Writer) {
+				w.Error("ERR Protocol error: " + err.Error())
+			})
+			h.logger.Warnf("Closing Redis client %s: %v", session.ID, err)
+			return
+		}
+		if err != nil {
+			h.logger.Debugf("Redis client %s read failed: %v", session.ID, err)
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if quit, err := h.handleCommand(session, args); quit || err != nil {
+			return
+		}
+	}
+}
+
+// connect registers the session of a new connection against the connection quota
+func (h *RedisHandler) connect(conn net.Conn) (*redisSession, error) {
+	quotaKey := "ip:" + remoteHost(conn.RemoteAddr())
+	if err := h.quotaService.AcquireConnection(quotaKey); err != nil {
+		return nil, err
+	}
+
+	id := generateClientID()
+	session := &redisSession{
+		ID:           id,
+		SubscriberID: "redis-" + id,
+		Conn:         conn,
+		ConnectedAt:  time.Now(),
+		quotaKey:     quotaKey,
+		channels:     make(map[string]bool),
+		patterns:     make(map[string]bool),
+		topics:       make(map[string]bool),
+		writer:       resp.NewWriter(conn),
+	}
+	// Redis clients do not authenticate, so each connection is rate limited on its own
+	session.publisher = services.Publisher{RateKey: session.SubscriberID, QuotaKey: quotaKey}
+
+	h.mutex.Lock()
+	h.sessions[session.ID] = session
+	h.mutex.Unlock()
+	return session, nil
+}
+
+// disconnect ends a session and releases its subscriptions
+func (h *RedisHandler) disconnect(session *redisSession) {
+	h.mutex.Lock()
+	delete(h.sessions, session.ID)
+	h.mutex.Unlock()
+
+	session.mutex.Lock()
+	session.closed = true
+	subscriptions := len(session.topics)
+	session.mutex.Unlock()
+
+	h.pubsub.RemoveSubscriber(session.SubscriberID)
+	h.quotaService.ReleaseConnection(session.quotaKey, subscriptions)
+	h.messageService.ForgetClient(session.publisher.RateKey)
+
+	h.logger.Infof("Redis client %s disconnected", session.ID)
+}
+
+// handleCommand executes one command, reporting whether the client quit. The error
+// reports a failed reply write.
+func (h *RedisHandler) handleCommand(session *redisSession, args [][]byte) (bool, error) {
+	name := strings.ToUpper(string(args[0]))
+	params := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		params[i] = string(arg)
+	}
+
+	// Only subscription commands are allowed while subscribed
+	switch name {
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+	default:
+		if session.subscribed() {
+			return false, session.reply(func(w *resp.Writer) {
+				w.Error(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(name)))
+			})
+		}
+	}
+
+	switch name {
+	case "PING":
+		if len(params) > 1 {
+			return false, session.arityError(name)
+		}
+		return false, session.reply(func(w *resp.Writer) {
+			switch {
+			case session.subscribed():
+				w.Array(2)
+				w.BulkString("pong")
+				if len(params) == 1 {
+					w.BulkString(params[0])
+				} else {
+					w.BulkString("")
+				}
+			case len(params) == 1:
+				w.Bulk(args[1])
+			default:
+				w.SimpleString("PONG")
+			}
+		})
+	case "QUIT":
+		session.reply(func(w *resp.Writer) {
+			w.SimpleString("OK")
+		})
+		return true, nil
+	case "PUBLISH":
+		if len(params) != 2 {
+			return false, session.arityError(name)
+		}
+		return false, h.handlePublish(session, params[0], args[2])
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(params) == 0 {
+			return false, session.arityError(name)
+		}
+		return false, h.handleSubscribe(session, name == "PSUBSCRIBE", params)
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return false, h.handleUnsubscribe(session, name == "PUNSUBSCRIBE", params)
+	case "PUBSUB":
+		if len(params) == 0 {
+			return false, session.arityError(name)
+		}
+		return false, h.handlePubsub(session, params)
+	}
+
+	return false, session.reply(func(w *resp.Writer) {
+		w.Error(fmt.Sprintf("ERR unknown command '%s'", string(args[0])))
+	})
+}
+
+// handlePublish publishes a message, creating the channel's topic on first use if
+// auto-creation is enabled, and replies with the number of the topic's subscribers
+func (h *RedisHandler) handlePublish(session *redisSession, channel string, payload []byte) error {
+	if h.config.TopicAutoCreate && !h.pubsub.HasTopic(channel) {
+		// Another client may create it concurrently
+		if _, err := h.topicService.CreateTopic(channel); err != nil && !models.IsErrorType(err, models.ErrTopicExists) {
+			return session.publishError(channel, err)
+		}
+	}
+
+	message := &models.Message{
+		ID:      generateClientID(),
+		Payload: decodePayload(payload),
+	}
+	if _, err := h.messageService.PublishMessage(session.publisher, channel, message); err != nil {
+		h.logger.Warnf("Failed to publish Redis message from client %s to topic %s: %v", session.ID, channel, err)
+		return session.publishError(channel, err)
+	}
+
+	receivers := 0
+	if stats, err := h.pubsub.GetTopicStats(channel); err == nil {
+		receivers = stats.Subscribers
+	}
+	return session.reply(func(w *resp.Writer) {
+		w.Integer(receivers)
+	})
+}
+
+// handleSubscribe subscribes the session to channels or patterns, replying with one
+// confirmation per argument. Channels without a topic are subscribed once it is created.
+func (h *RedisHandler) handleSubscribe(session *redisSession, pattern bool, names []string) error {
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+	topics := h.pubsub.GetTopics()
+
+	for _, name := range names {
+		session.mutex.Lock()
+		var err error
+		if pattern {
+			session.patterns[name] = true
+			for _, topic := range topics {
+				if resp.Match(name, topic.Name) {
+					if err = h.subscribeTopic(session, topic.Name); err != nil {
+						break
+					}
+				}
+			}
+		} else {
+			session.channels[name] = true
+			err = h.subscribeTopic(session, name)
+		}
+		if models.IsErrorType(err, models.ErrTopicNotFound) {
+			// Subscribed once the topic is created
+			err = nil
+		}
+		if err != nil {
+			delete(session.channels, name)
+			delete(session.patterns, name)
+			h.pruneTopics(session)
+		}
+		count := session.subscriptionCount()
+		session.mutex.Unlock()
+
+		if err != nil {
+			h.logger.Warnf("Redis client %s failed to %s to %s: %v", session.ID, kind, name, err)
+			if err := session.reply(func(w *resp.Writer) {
+				w.Error(errorCode(err) + " failed to " + kind + " to '" + name + "'")
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := session.reply(func(w *resp.Writer) {
+			w.Array(3)
+			w.BulkString(kind)
+			w.BulkString(name)
+			w.Integer(count)
+		}); err != nil {
+			return err
+		}
+	}
+
+	h.logger.Infof("Redis client %s %sd to %d names", session.ID, kind, len(names))
+	return nil
+}
+
+// handleUnsubscribe removes channels or patterns, all of them when none are named, and
+// unsubscribes from topics nothing else matches
+func (h *RedisHandler) handleUnsubscribe(session *redisSession, pattern bool, names []string) error {
+	kind := "unsubscribe"
+	if pattern {
+		kind = "punsubscribe"
+	}
+
+	session.mutex.Lock()
+	subscriptions := session.channels
+	if pattern {
+		subscriptions = session.patterns
+	}
+	if len(names) == 0 {
+		for name := range subscriptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	counts := make([]int, len(names))
+	for i, name := range names {
+		delete(subscriptions, name)
+		counts[i] = session.subscriptionCount()
+	}
+	h.pruneTopics(session)
+	session.mutex.Unlock()
+
+	return session.reply(func(w *resp.Writer) {
+		if len(names) == 0 {
+			w.Array(3)
+			w.BulkString(kind)
+			w.Null()
+			w.Integer(0)
+			return
+		}
+		for i, name := range names {
+			w.Array(3)
+			w.BulkString(kind)
+			w.BulkString(name)
+			w.Integer(counts[i])
+		}
+	})
+}
+
+// handlePubsub answers the PUBSUB introspection subcommands. Subscriber counts cover
+// the subscribers of every protocol, not only Redis clients.
+func (h *RedisHandler) handlePubsub(session *redisSession, params []string) error {
+	subcommand := strings.ToUpper(params[0])
+	switch subcommand {
+	case "CHANNELS":
+		if len(params) > 2 {
+			return session.arityError("PUBSUB|CHANNELS")
+		}
+		pattern := "*"
+		if len(params) == 2 {
+			pattern = params[1]
+		}
+
+		var channels []string
+		for _, topic := range h.pubsub.GetTopics() {
+			if topic.Subscribers > 0 && resp.Match(pattern, topic.Name) {
+				channels = append(channels, topic.Name)
+			}
+		}
+		sort.Strings(channels)
+		return session.reply(func(w *resp.Writer) {
+			w.Array(len(channels))
+			for _, channel := range channels {
+				w.BulkString(channel)
+			}
+		})
+	case "NUMSUB":
+		return session.reply(func(w *resp.Writer) {
+			w.Array(2 * (len(params) - 1))
+			for _, channel := range params[1:] {
+				subscribers := 0
+				if stats, err := h.pubsub.GetTopicStats(channel); err == nil {
+					subscribers = stats.Subscribers
+				}
+				w.BulkString(channel)
+				w.Integer(subscribers)
+			}
+		})
+	case "NUMPAT":
+		if len(params) != 1 {
+			return session.arityError("PUBSUB|NUMPAT")
+		}
+		return session.reply(func(w *resp.Writer) {
+			w.Integer(h.patternCount())
+		})
+	}
+
+	return session.reply(func(w *resp.Writer) {
+		w.Error(fmt.Sprintf("ERR unknown subcommand '%s'", params[0]))
+	})
+}
+
+// subscribeTopic subscribes a session to a topic against its subscription quota and
+// starts delivery on the first subscription. The session mutex must be held.
+func (h *RedisHandler) subscribeTopic(session *redisSession, topic string) error {
+	if session.closed || session.topics[topic] {
+		return nil
+	}
+
+	if err := h.quotaService.AcquireSubscription(session.quotaKey); err != nil {
+		return err
+	}
+	if err := h.pubsub.Subscribe(session.SubscriberID, topic, 0); err != nil {
+		h.quotaService.ReleaseSubscription(session.quotaKey)
+		return err
+	}
+	session.topics[topic] = true
+
+	if !session.delivering {
+		messages := h.pubsub.GetSubscriberChannel(session.SubscriberID)
+		if messages == nil {
+			return models.ErrSubscriberNotFound
+		}
+		session.delivering = true
+		go h.deliver(session, messages)
+	}
+	return nil
+}
+
+// pruneTopics unsubscribes a session from topics that none of its channels and patterns
+// match. The session mutex must be held.
+func (h *RedisHandler) pruneTopics(session *redisSession) {
+	for topic := range session.topics {
+		if session.matches(topic) {
+			continue
+		}
+		if err := h.pubsub.Unsubscribe(session.SubscriberID, topic); err != nil && !models.IsErrorType(err, models.ErrTopicNotFound) {
+			h.logger.Warnf("Redis client %s failed to unsubscribe from topic %s: %v", session.ID, topic, err)
+		}
+		delete(session.topics, topic)
+		h.quotaService.ReleaseSubscription(session.quotaKey)
+	}
+}
+
+// deliver forwards a session's events to its connection, once as a message for a
+// subscribed channel and once as a pmessage per matching pattern. It is the only reader
+// of the subscriber channel, so events of all topics are delivered in order.
+func (h *RedisHandler) deliver(session *redisSession, messages <-chan *models.ServerMessage) {
+	// The channel closes when the session ends or its queue overflowed
+	defer session.Conn.Close()
+
+	for message := range messages {
+		switch message.Type {
+		case "event":
+			if message.Message == nil {
+				continue
+			}
+
+			session.mutex.Lock()
+			direct := session.channels[message.Topic]
+			var patterns []string
+			for pattern := range session.patterns {
+				if resp.Match(pattern, message.Topic) {
+					patterns = append(patterns, pattern)
+				}
+			}
+			session.mutex.Unlock()
+			if !direct && len(patterns) == 0 {
+				continue
+			}
+			sort.Strings(patterns)
+
+			payload, err := encodeEventPayload(message)
+			if err != nil {
+				h.logger.Errorf("Failed to encode event for Redis client %s: %v", session.ID, err)
+				continue
+			}
+			if err := session.reply(func(w *resp.Writer) {
+				if direct {
+					w.Array(3)
+					w.BulkString("message")
+					w.BulkString(message.Topic)
+					w.Bulk(payload)
+				}
+				for _, pattern := range patterns {
+					w.Array(4)
+					w.BulkString("pmessage")
+					w.BulkString(pattern)
+					w.BulkString(message.Topic)
+					w.Bulk(payload)
+				}
+			}); err != nil {
+				return
+			}
+		case "error":
+			// Redis has no error push; overflowing events are dropped
+			h.logger.Warnf("Redis client %s dropped events: %s", session.ID, message.Error.Code)
+		}
+	}
+}
+
+// topicChanged subscribes sessions with matching channels or patterns to a created
+// topic, and releases the subscriptions of a deleted topic
+func (h *RedisHandler) topicChanged(topic string, created bool) {
+	h.mutex.RLock()
+	sessions := make([]*redisSession, 0, len(h.sessions))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	h.mutex.RUnlock()
+
+	for _, session := range sessions {
+		session.mutex.Lock()
+		if created {
+			if session.matches(topic) {
+				if err := h.subscribeTopic(session, topic); err != nil {
+					h.logger.Warnf("Redis client %s failed to subscribe to new topic %s: %v", session.ID, topic, err)
+				}
+			}
+		} else if session.topics[topic] {
+			delete(session.topics, topic)
+			h.quotaService.ReleaseSubscription(session.quotaKey)
+		}
+		session.mutex.Unlock()
+	}
+}
+
+// patternCount returns the number of pattern subscriptions across all sessions
+func (h *RedisHandler) patternCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	count := 0
+	for _, session := range h.sessions {
+		session.mutex.Lock()
+		count += len(session.patterns)
+		session.mutex.Unlock()
+	}
+	return count
+}
+
+// GetActiveClients returns information about all connected Redis clients
+func (h *RedisHandler) GetActiveClients() []models.ClientInfo {
+	h.mutex.RLock()
+	sessions := make([]*redisSession, 0, len(h.sessions))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	h.mutex.RUnlock()
+
+	clients := make([]models.ClientInfo, 0, len(sessions))
+	for _, session := range sessions {
+		session.mutex.Lock()
+		topics := make([]string, 0, len(session.topics))
+		for topic := range session.topics {
+			topics = append(topics, topic)
+		}
+		session.mutex.Unlock()
+
+		subscriberQueues := make(map[string]models.QueueStats)
+		if subscriber := h.pubsub.GetSubscriber(session.SubscriberID); subscriber != nil {
+			subscriberQueues[session.SubscriberID] = subscriber.QueueStats()
+		}
+
+		clients = append(clients, models.ClientInfo{
+			ID:               session.ID,
+			Protocol:         "redis",
+			RemoteAddr:       session.Conn.RemoteAddr().String(),
+			Topics:           topics,
+			ConnectedAt:      session.ConnectedAt,
+			IsConnected:      true,
+			SubscriberQueues: subscriberQueues,
+		})
+	}
+	return clients
+}
+
+// Shutdown stops accepting connections and closes all sessions
+func (h *RedisHandler) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.done)
+	})
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	for _, session := range h.sessions {
+		session.Conn.Close()
+	}
+}
+
+// matches reports whether a topic matches one of the session's channels or patterns.
+// The session mutex must be held.
+func (s *redisSession) matches(topic string) bool {
+	if s.channels[topic] {
+		return true
+	}
+	for pattern := range s.patterns {
+		if resp.Match(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionCount returns the number of channels and patterns subscribed. The session
+// mutex must be held.
+func (s *redisSession) subscriptionCount() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// subscribed reports whether the session is in subscribe mode
+func (s *redisSession) subscribed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.subscriptionCount() > 0
+}
+
+// arityError replies that a command was given the wrong number of arguments
+func (s *redisSession) arityError(command string) error {
+	return s.reply(func(w *resp.Writer) {
+		w.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(command)))
+	})
+}
+
+// publishError replies with the API error code of a rejected publish
+func (s *redisSession) publishError(channel string, err error) error {
+	return s.reply(func(w *resp.Writer) {
+		w.Error(fmt.Sprintf("%s publish to '%s' rejected", errorCode(err), channel))
+	})
+}
+
+// reply writes and flushes replies to the client
+func (s *redisSession) reply(write func(w *resp.Writer)) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.Conn.SetWriteDeadline(time.Now().Add(redisWriteTimeout))
+	write(s.writer)
+	return s.writer.Flush()
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/pubsub"
+	"pub-sub/resp"
+	"pub-sub/schema"
+	"pub-sub/services"
+)
+
+// redisClient is a minimal Redis client for driving the handler
+type redisClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply as returned by redisClient.receive
+type redisError string
+
+// newRedisServer serves Redis on a local port and returns the handler and its address.
+// Topic auto-creation is enabled unless a configure function changes it.
+func newRedisServer(t *testing.T, configure ...func(*config.Config)) (*RedisHandler, string) {
+	t.Helper()
+
+	cfg := &config.Config{
+		MaxMessagesPerTopic:  10,
+		MaxPublishRate:       1000,
+		MaxClientPublishRate: 1000,
+		MaxBatchSize:         10,
+		MaxMessageSize:       1024,
+		MaxFrameSize:         4096,
+		DefaultQueueSize:     10,
+		MaxQueueSize:         100,
+		TopicAutoCreate:      true,
+	}
+	for _, apply := range configure {
+		apply(cfg)
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	schemas := services.NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	quotas := services.NewQuotaService(ps, cfg, log)
+	handler := NewRedisHandler(
+		ps,
+		services.NewTopicService(ps, schemas, log),
+		services.NewMessageService(ps, quotas, schemas, metrics.NewRejections(), cfg, log),
+		quotas,
+		cfg,
+		log,
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go handler.Serve(listener)
+	t.Cleanup(handler.Shutdown)
+	return handler, listener.Addr().String()
+}
+
+// connectRedis opens a connection to the handler
+func connectRedis(t *testing.T, addr string) *redisClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &redisClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *redisClient) send(args ...string) {
+	c.t.Helper()
+	writer := resp.NewWriter(c.conn)
+	writer.Array(len(args))
+	for _, arg := range args {
+		writer.BulkString(arg)
+	}
+	if err := writer.Flush(); err != nil {
+		c.t.Fatalf("Failed to send %s: %v", args[0], err)
+	}
+}
+
+// receive reads a reply as a string, int, redisError, nil or []interface{}
+func (c *redisClient) receive() interface{} {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := readRedisReply(c.reader)
+	if err != nil {
+		c.t.Fatalf("Failed to receive reply: %v", err)
+	}
+	return reply
+}
+
+// expect receives a reply and checks it
+func (c *redisClient) expect(want interface{}) {
+	c.t.Helper()
+	if got := c.receive(); !reflect.DeepEqual(got, want) {
+		c.t.Fatalf("Expected %#v, got %#v", want, got)
+	}
+}
+
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.Atoi(line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]interface{}, count)
+		for i := range elements {
+			if elements[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+func TestRedisPublishSubscribe(t *testing.T) {
+	handler, addr := newRedisServer(t)
+
+	publisher := connectRedis(t, addr)
+	publisher.send("PING")
+	publisher.expect("PONG")
+
+	// Channels may be subscribed before their topic exists
+	subscriber := connectRedis(t, addr)
+	subscriber.send("SUBSCRIBE", "orders")
+	subscriber.expect([]interface{}{"subscribe", "orders", 1})
+	subscriber.send("PSUBSCRIBE", "orders*")
+	subscriber.expect([]interface{}{"psubscribe", "orders*", 2})
+
+	// Publishing creates the topic, delivered once per matching channel and pattern
+	publisher.send("PUBLISH", "orders", `{"amount":5}`)
+	publisher.expect(1)
+	subscriber.expect([]interface{}{"message", "orders", `{"amount":5}`})
+	subscriber.expect([]interface{}{"pmessage", "orders*", "orders", `{"amount":5}`})
+
+	publisher.send("PUBLISH", "orders.eu", "hello")
+	publisher.expect(1)
+	subscriber.expect([]interface{}{"pmessage", "orders*", "orders.eu", "hello"})
+
+	publisher.send("PUBSUB", "CHANNELS", "orders*")
+	publisher.expect([]interface{}{"orders", "orders.eu"})
+	publisher.send("PUBSUB", "NUMSUB", "orders", "missing")
+	publisher.expect([]interface{}{"orders", 1, "missing", 0})
+	publisher.send("PUBSUB", "NUMPAT")
+	publisher.expect(1)
+
+	// Subscribe mode only allows subscription commands
+	subscriber.send("PUBLISH", "orders", "x")
+	if reply, ok := subscriber.receive().(redisError); !ok || !strings.HasPrefix(string(reply), "ERR Can't execute 'publish'") {
+		t.Fatalf("Expected a subscribe mode error, got %#v", reply)
+	}
+	subscriber.send("PING")
+	subscriber.expect([]interface{}{"pong", ""})
+
+	clients := handler.GetActiveClients()
+	if len(clients) != 2 || clients[0].Protocol != "redis" {
+		t.Errorf("Expected 2 Redis clients, got %+v", clients)
+	}
+
+	subscriber.send("PUNSUBSCRIBE")
+	subscriber.expect([]interface{}{"punsubscribe", "orders*", 1})
+	subscriber.send("UNSUBSCRIBE")
+	subscriber.expect([]interface{}{"unsubscribe", "orders", 0})
+	subscriber.send("UNSUBSCRIBE")
+	subscriber.expect([]interface{}{"unsubscribe", nil, 0})
+
+	publisher.send("PUBLISH", "orders", "after")
+	publisher.expect(0)
+
+	publisher.send("GET", "orders")
+	publisher.expect(redisError("ERR unknown command 'GET'"))
+	publisher.send("QUIT")
+	publisher.expect("OK")
+}
+
+func TestRedisTopicAutoCreateDisabled(t *testing.T) {
+	handler, addr := newRedisServer(t, func(cfg *config.Config) {
+		cfg.TopicAutoCreate = false
+	})
+	client := connectRedis(t, addr)
+
+	client.send("PUBLISH", "orders", "hello")
+	client.expect(redisError("TOPIC_NOT_FOUND publish to 'orders' rejected"))
+	if handler.pubsub.HasTopic("orders") {
+		t.Error("Expected the topic not to be created")
+	}
+}
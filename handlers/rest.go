@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"pub-sub/logger"
 	"pub-sub/models"
 	"pub-sub/services"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -15,16 +20,22 @@ import (
 type RestHandler struct {
 	topicService   *services.TopicService
 	messageService *services.MessageService
+	schemaService  *services.SchemaService
+	webhookService *services.WebhookService
 	systemService  *services.SystemService
+	quotaService   *services.QuotaService
 	logger         logger.Logger
 }
 
 // NewRestHandler creates a new REST handler
-func NewRestHandler(topicService *services.TopicService, messageService *services.MessageService, systemService *services.SystemService, log logger.Logger) *RestHandler {
+func NewRestHandler(topicService *services.TopicService, messageService *services.MessageService, schemaService *services.SchemaService, webhookService *services.WebhookService, systemService *services.SystemService, quotaService *services.QuotaService, log logger.Logger) *RestHandler {
 	return &RestHandler{
 		topicService:   topicService,
 		messageService: messageService,
+		schemaService:  schemaService,
+		webhookService: webhookService,
 		systemService:  systemService,
+		quotaService:   quotaService,
 		logger:         log,
 	}
 }
@@ -36,8 +47,7 @@ func (h *RestHandler) CreateTopic(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		h.logger.Warnf("Invalid request body: %v", err)
-		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", "INVALID_JSON")
+		h.sendInvalidBody(w, err)
 		return
 	}
 
@@ -130,6 +140,12 @@ func (h *RestHandler) GetActiveClients(w http.ResponseWriter, r *http.Request) {
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
+// GetQuotas handles GET /quotas endpoint
+func (h *RestHandler) GetQuotas(w http.ResponseWriter, r *http.Request) {
+	response := h.systemService.GetQuotas()
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
 // GetHealth handles GET /health endpoint
 func (h *RestHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
 	response := h.systemService.GetHealth()
@@ -144,20 +160,42 @@ func (h *RestHandler) PublishMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		h.logger.Warnf("Invalid request body: %v", err)
-		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", "INVALID_JSON")
+		h.sendInvalidBody(w, err)
 		return
 	}
 
-	response, err := h.messageService.PublishMessage(request.Topic, request.Message)
+	response, err := h.messageService.PublishMessage(requestPublisher(h.quotaService, r), request.Topic, request.Message)
 	if err != nil {
 		h.logger.Errorf("Failed to publish message: %v", err)
 		statusCode := http.StatusInternalServerError
 		if models.IsErrorType(err, models.ErrTopicNotFound) {
 			statusCode = http.StatusNotFound
+		} else if models.IsErrorType(err, models.ErrRateLimited) {
+			statusCode = http.StatusTooManyRequests
+			setRetryAfter(w, err)
+			h.sendErrorResponse(w, statusCode, err.Error(), "RATE_LIMITED")
+			return
+		} else if models.IsErrorType(err, models.ErrSchemaViolation) {
+			h.sendSchemaViolation(w, err)
+			return
+		} else if models.IsErrorType(err, models.ErrMessageTooLarge) {
+			h.sendErrorResponse(w, http.StatusRequestEntityTooLarge, messageSizeDetails(err), "MESSAGE_TOO_LARGE")
+			return
+		} else if models.IsErrorType(err, models.ErrQuotaExceeded) {
+			statusCode = http.StatusForbidden
+			var quotaErr *models.QuotaError
+			if errors.As(err, &quotaErr) && quotaErr.RetryAfter > 0 {
+				statusCode = http.StatusTooManyRequests
+				setRetryAfter(w, err)
+			}
+			h.sendErrorResponse(w, statusCode, err.Error(), "QUOTA_EXCEEDED")
+			return
 		} else if models.IsErrorType(err, models.ErrTopicRequired) || 
 		          models.IsErrorType(err, models.ErrMessageRequired) || 
-		          models.IsErrorType(err, models.ErrMessageIDRequired) {
+		          models.IsErrorType(err, models.ErrMessageIDRequired) ||
+		          models.IsErrorType(err, models.ErrInvalidPriority) ||
+		          models.IsErrorType(err, models.ErrSchemaNotFound) ||
+		          models.IsErrorType(err, models.ErrSchemaVersionNotFound) {
 			statusCode = http.StatusBadRequest
 		}
 		h.sendErrorResponse(w, statusCode, err.Error(), "MESSAGE_PUBLISH_FAILED")
@@ -167,6 +205,70 @@ func (h *RestHandler) PublishMessage(w http.ResponseWriter, r *http.Request) {
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
+// PublishBatch handles POST /publish/batch endpoint
+func (h *RestHandler) PublishBatch(w http.ResponseWriter, r *http.Request) {
+	var request models.BatchPublishRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendInvalidBody(w, err)
+		return
+	}
+
+	response, err := h.messageService.PublishBatch(requestPublisher(h.quotaService, r), request.Messages)
+	if err != nil {
+		h.logger.Errorf("Failed to publish batch: %v", err)
+		statusCode := http.StatusInternalServerError
+		if models.IsErrorType(err, models.ErrBatchEmpty) {
+			statusCode = http.StatusBadRequest
+		} else if models.IsErrorType(err, models.ErrBatchTooLarge) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		h.sendErrorResponse(w, statusCode, err.Error(), "BATCH_PUBLISH_FAILED")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// clientKey identifies the client by a configured API key, falling back to the remote IP
+func clientKey(quotas *services.QuotaService, r *http.Request) string {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		apiKey = r.URL.Query().Get("api_key")
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return quotas.ClientKey(apiKey, host)
+}
+
+// requestPublisher identifies a REST publisher by its client key for both rate limits and quotas
+func requestPublisher(quotas *services.QuotaService, r *http.Request) services.Publisher {
+	key := clientKey(quotas, r)
+	return services.Publisher{RateKey: key, QuotaKey: key}
+}
+
+// setRetryAfter sets the Retry-After header (in whole seconds) for rate limit and quota errors
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var retryAfter time.Duration
+	var rateLimitErr *models.RateLimitError
+	var quotaErr *models.QuotaError
+	if errors.As(err, &rateLimitErr) {
+		retryAfter = rateLimitErr.RetryAfter
+	} else if errors.As(err, &quotaErr) {
+		retryAfter = quotaErr.RetryAfter
+	} else {
+		return
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
 // sendJSONResponse sends a JSON response with proper headers
 func (h *RestHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -180,23 +282,62 @@ func (h *RestHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, da
 
 // sendErrorResponse sends a structured error response
 func (h *RestHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message, code string) {
+	writeErrorResponse(w, h.logger, statusCode, message, code)
+}
+
+// messageSizeDetails describes a message rejected by a size limit
+func messageSizeDetails(err error) string {
+	var sizeErr *models.MessageSizeError
+	if errors.As(err, &sizeErr) {
+		return fmt.Sprintf("Message is %d bytes, limit is %d bytes", sizeErr.Size, sizeErr.Limit)
+	}
+	return err.Error()
+}
+
+// sendInvalidBody reports a request body that could not be read or decoded, including
+// bodies cut off by the frame size limit
+func (h *RestHandler) sendInvalidBody(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.logger.Warnf("Request body exceeds %d bytes", maxBytesErr.Limit)
+		h.sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit), "MESSAGE_TOO_LARGE")
+		return
+	}
+
+	h.logger.Warnf("Invalid request body: %v", err)
+	h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", "INVALID_JSON")
+}
+
+// sendSchemaViolation sends a 422 response listing the payload paths that failed validation
+func (h *RestHandler) sendSchemaViolation(w http.ResponseWriter, err error) {
+	details := &models.Error{Code: "SCHEMA_VIOLATION", Message: "Payload does not match the topic schema"}
+	var schemaErr *models.SchemaError
+	if errors.As(err, &schemaErr) {
+		details.Violations = schemaErr.Violations
+	}
+	writeErrorDetails(w, h.logger, http.StatusUnprocessableEntity, details)
+}
+
+// writeErrorResponse writes a structured error response
+func writeErrorResponse(w http.ResponseWriter, log logger.Logger, statusCode int, message, code string) {
+	writeErrorDetails(w, log, statusCode, &models.Error{Code: code, Message: message})
+}
+
+// writeErrorDetails writes a structured error response with optional details
+func writeErrorDetails(w http.ResponseWriter, log logger.Logger, statusCode int, details *models.Error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
 	errorResponse := struct {
-		Error struct {
-			Code    string `json:"code"`
-			Message string `json:"message"`
-		} `json:"error"`
-		Timestamp string `json:"timestamp"`
+		Error     *models.Error `json:"error"`
+		Timestamp string        `json:"timestamp"`
 	}{
+		Error:     details,
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
-	errorResponse.Error.Code = code
-	errorResponse.Error.Message = message
 
 	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
-		h.logger.Errorf("Failed to encode error response: %v", err)
+		log.Errorf("Failed to encode error response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pub-sub/models"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterSchema handles PUT /topics/{name}/schema endpoint
+func (h *RestHandler) RegisterSchema(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.sendInvalidBody(w, err)
+		return
+	}
+	if !json.Valid(body) {
+		h.logger.Warnf("Invalid schema body for topic %s", topicName)
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", "INVALID_JSON")
+		return
+	}
+
+	response, created, err := h.schemaService.RegisterSchema(topicName, body)
+	if err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if created {
+		statusCode = http.StatusCreated
+	}
+	h.sendJSONResponse(w, statusCode, response)
+}
+
+// GetSchema handles GET /topics/{name}/schema endpoint
+func (h *RestHandler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	response, err := h.schemaService.GetSchema(topicName)
+	if err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// DeleteSchema handles DELETE /topics/{name}/schema endpoint
+func (h *RestHandler) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	if err := h.schemaService.DeleteSchema(topicName); err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, models.TopicResponse{
+		Status: "schema_deleted",
+		Topic:  topicName,
+	})
+}
+
+// ListSchemaVersions handles GET /topics/{name}/schema/versions endpoint
+func (h *RestHandler) ListSchemaVersions(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	response, err := h.schemaService.ListVersions(topicName)
+	if err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// GetSchemaVersion handles GET /topics/{name}/schema/versions/{version} endpoint
+func (h *RestHandler) GetSchemaVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Version must be a number", "INVALID_REQUEST")
+		return
+	}
+
+	response, err := h.schemaService.GetSchemaVersion(vars["name"], version)
+	if err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// GetSchemaCompatibility handles GET /topics/{name}/schema/compatibility endpoint
+func (h *RestHandler) GetSchemaCompatibility(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	response, err := h.schemaService.GetCompatibility(topicName)
+	if err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// SetSchemaCompatibility handles PUT /topics/{name}/schema/compatibility endpoint
+func (h *RestHandler) SetSchemaCompatibility(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+
+	var request models.SchemaCompatibility
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendInvalidBody(w, err)
+		return
+	}
+
+	response, err := h.schemaService.SetCompatibility(topicName, request.Compatibility)
+	if err != nil {
+		h.sendSchemaError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// sendSchemaError maps a schema registry error to its response
+func (h *RestHandler) sendSchemaError(w http.ResponseWriter, err error) {
+	var compatibilityErr *models.CompatibilityError
+	switch {
+	case errors.As(err, &compatibilityErr):
+		h.logger.Warnf("Schema rejected: %v", err)
+		writeErrorDetails(w, h.logger, http.StatusConflict, &models.Error{
+			Code:       "SCHEMA_INCOMPATIBLE",
+			Message:    fmt.Sprintf("Schema is not %s compatible with version %d", compatibilityErr.Compatibility, compatibilityErr.Version),
+			Violations: compatibilityErr.Issues,
+		})
+	case models.IsErrorType(err, models.ErrTopicNotFound):
+		h.sendErrorResponse(w, http.StatusNotFound, err.Error(), "TOPIC_NOT_FOUND")
+	case models.IsErrorType(err, models.ErrSchemaNotFound):
+		h.sendErrorResponse(w, http.StatusNotFound, err.Error(), "SCHEMA_NOT_FOUND")
+	case models.IsErrorType(err, models.ErrSchemaVersionNotFound):
+		h.sendErrorResponse(w, http.StatusNotFound, err.Error(), "SCHEMA_VERSION_NOT_FOUND")
+	case models.IsErrorType(err, models.ErrInvalidSchema):
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_SCHEMA")
+	case models.IsErrorType(err, models.ErrInvalidCompatibility):
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_COMPATIBILITY")
+	default:
+		h.logger.Errorf("Schema operation failed: %v", err)
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), "INTERNAL")
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"time"
+
+	"pub-sub/models"
+	"pub-sub/services"
+)
+
+// wsSession is the state of a dropped WebSocket client kept for the session grace
+// period. Its pub-sub subscribers stay registered, so messages published while the
+// client is away queue up until a connection presenting the token resumes the session.
+type wsSession struct {
+	token          string                  // Token presented to resume the session
+	clientID       string                  // Client ID the resumed connection takes over
+	publisher      services.Publisher      // Rate limiting and quota identity
+	topics         map[string]string       // Map of topic names to subscription IDs
+	schemaVersions map[string]int          // Schema versions read by subscriptions that requested one
+	pending        []*models.ServerMessage // Events queued but not yet written when the connection dropped
+	remoteAddr     string                  // Remote address of the dropped connection
+	connectedAt    time.Time               // When the dropped connection was established
+	expiry         *time.Timer             // Discards the session when the grace period ends
+}
+
+// parkClient keeps a dropped client's subscriptions as a session awaiting resumption.
+// Caller must hold the handler lock.
+func (h *WebSocketHandler) parkClient(client *WebSocketClient) {
+	session := h.detachClient(client)
+	session.expiry = time.AfterFunc(time.Duration(h.config.WSSessionGracePeriod)*time.Second, func() {
+		h.expireSession(session)
+	})
+	h.sessions[session.token] = session
+
+	h.logger.Infof("WebSocket client disconnected, session kept for %ds: client_id=%s, topics_subscribed=%d, pending=%d",
+		h.config.WSSessionGracePeriod, session.clientID, len(session.topics), len(session.pending))
+}
+
+// detachClient stops delivery to a client and moves its subscriptions and undelivered
+// events into a session. The connection slot is released; subscription slots are held
+// by the session.
+func (h *WebSocketHandler) detachClient(client *WebSocketClient) *wsSession {
+	client.stopDispatching()
+	client.dispatching.Wait()
+	h.quotaService.ReleaseConnection(client.publisher.QuotaKey, 0)
+
+	client.mutex.RLock()
+	session := &wsSession{
+		token:          client.session,
+		clientID:       client.ID,
+		publisher:      client.publisher,
+		topics:         make(map[string]string, len(client.Topics)),
+		schemaVersions: make(map[string]int, len(client.schemaVersions)),
+		remoteAddr:     client.Conn.RemoteAddr().String(),
+		connectedAt:    client.ConnectedAt,
+	}
+	for topicName, subscriberID := range client.Topics {
+		session.topics[topicName] = subscriberID
+	}
+	for topicName, version := range client.schemaVersions {
+		session.schemaVersions[topicName] = version
+	}
+	unsent := client.unsent
+	client.mutex.RUnlock()
+
+	// Events already taken from the subscriber queues are replayed on resumption, queued
+	// ones before those the dispatch loops held; acks and other replies belong to the dropped
+	// connection
+	keep := func(message *models.ServerMessage) {
+		if _, subscribed := session.topics[message.Topic]; subscribed && message.Type == "event" {
+			session.pending = append(session.pending, message)
+		}
+	}
+	for {
+		select {
+		case message := <-client.SendChan:
+			keep(message)
+		default:
+			for _, message := range unsent {
+				keep(message)
+			}
+			return session
+		}
+	}
+}
+
+// claimSession removes and returns the session for a token presented by a connection
+// from the same client. A connection still registered with the token, whose drop has
+// not been noticed yet, is taken over. It returns nil if there is no such session.
+func (h *WebSocketHandler) claimSession(token, quotaKey string) *wsSession {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if session, exists := h.sessions[token]; exists {
+		if session.publisher.QuotaKey != quotaKey {
+			return nil
+		}
+		// A timer that already fired finds the session gone and leaves it alone
+		session.expiry.Stop()
+		delete(h.sessions, token)
+		return session
+	}
+
+	for clientID, client := range h.clients {
+		if client.session != token {
+			continue
+		}
+		if client.publisher.QuotaKey != quotaKey {
+			return nil
+		}
+		delete(h.clients, clientID)
+		client.Conn.Close()
+		session := h.detachClient(client)
+		h.logger.Infof("WebSocket session taken over by a new connection: client_id=%s", clientID)
+		return session
+	}
+	return nil
+}
+
+// resumeSession restores a session on a new connection: undelivered events are sent
+// first, then dispatching from the kept subscribers resumes
+func (h *WebSocketHandler) resumeSession(client *WebSocketClient, session *wsSession) {
+	client.sendWelcome("Session resumed", "")
+
+	for i, message := range session.pending {
+		if !client.enqueue(message) {
+			h.logger.Warnf("Dropped %d pending events resuming session of client %s: channel full", len(session.pending)-i, client.ID)
+			break
+		}
+	}
+
+	// Subscribers removed while the client was away, after their queue overflowed, are
+	// not restored
+	var lost []string
+	subscribers := make(map[string]bool)
+	client.mutex.Lock()
+	for topicName, subscriberID := range client.Topics {
+		if h.pubsub.GetSubscriber(subscriberID) == nil {
+			delete(client.Topics, topicName)
+			delete(client.schemaVersions, topicName)
+			lost = append(lost, topicName)
+			continue
+		}
+		subscribers[subscriberID] = true
+	}
+	topicsRestored := len(client.Topics)
+	client.mutex.Unlock()
+
+	for _, topicName := range lost {
+		h.quotaService.ReleaseSubscription(client.publisher.QuotaKey)
+		client.sendErrorMessage("Subscription lost", "SLOW_CONSUMER", "Subscription to topic "+topicName+" was dropped while disconnected: subscriber queue overflow", "")
+	}
+	for subscriberID := range subscribers {
+		client.startDispatcher(subscriberID)
+	}
+
+	h.logger.Infof("WebSocket session resumed: client_id=%s, topics_restored=%d, topics_lost=%d, pending=%d", client.ID, topicsRestored, len(lost), len(session.pending))
+}
+
+// expireSession discards a session whose grace period ended without resumption
+func (h *WebSocketHandler) expireSession(session *wsSession) {
+	h.mutex.Lock()
+	if h.sessions[session.token] != session {
+		h.mutex.Unlock()
+		return
+	}
+	delete(h.sessions, session.token)
+	h.mutex.Unlock()
+
+	h.discardSession(session)
+	h.logger.Infof("WebSocket session expired: client_id=%s, topics_subscribed=%d", session.clientID, len(session.topics))
+}
+
+// discardSession removes a session's subscribers and releases what it held
+func (h *WebSocketHandler) discardSession(session *wsSession) {
+	// Rate limits keyed by the client itself end with it
+	if session.publisher.RateKey == session.clientID {
+		h.messageService.ForgetClient(session.publisher.RateKey)
+	}
+
+	for topicName, subscriberID := range session.topics {
+		h.logger.Debugf("Removing subscription %s from topic %s", subscriberID, topicName)
+		h.quotaService.ReleaseSubscription(session.publisher.QuotaKey)
+		h.pubsub.RemoveSubscriber(subscriberID)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/services"
+
+	"github.com/gorilla/mux"
+)
+
+// sseWriteTimeout bounds each write to an event stream, so a stalled client does not
+// hold its handler forever
+const sseWriteTimeout = 10 * time.Second
+
+// SSEHandler streams topic events to clients as Server-Sent Events
+type SSEHandler struct {
+	pubsub       *pubsub.PubSub         // Reference to the pub-sub system
+	quotaService *services.QuotaService // Per-client quota enforcement
+	config       *config.Config         // System configuration
+	logger       logger.Logger          // Logger instance
+	done         chan struct{}          // Closed on shutdown to end all streams
+	shutdownOnce sync.Once              // Guards closing done
+}
+
+// NewSSEHandler creates a new Server-Sent Events handler
+func NewSSEHandler(pubsub *pubsub.PubSub, quotaService *services.QuotaService, cfg *config.Config, log logger.Logger) *SSEHandler {
+	return &SSEHandler{
+		pubsub:       pubsub,
+		quotaService: quotaService,
+		config:       cfg,
+		logger:       log,
+		done:         make(chan struct{}),
+	}
+}
+
+// HandleEvents handles GET /topics/{name}/events, streaming the topic's events as
+// text/event-stream. Reconnecting clients resume after the event named by the
+// Last-Event-ID header.
+func (h *SSEHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["name"]
+	query := r.URL.Query()
+
+	lastN := 0
+	if value := query.Get("last_n"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeErrorResponse(w, h.logger, http.StatusBadRequest, "last_n must be a non-negative number", "INVALID_REQUEST")
+			return
+		}
+		lastN = parsed
+	}
+	queueSize, _ := strconv.Atoi(query.Get("queue_size"))
+
+	// EventSource sends Last-Event-ID when reconnecting; the query parameter serves
+	// clients that cannot set headers
+	resumeAfter := r.Header.Get("Last-Event-ID")
+	if resumeAfter == "" {
+		resumeAfter = query.Get("last_event_id")
+	}
+
+	// A stream is one connection with one subscription
+	quotaKey := clientKey(h.quotaService, r)
+	if err := h.quotaService.AcquireConnection(quotaKey); err != nil {
+		writeErrorResponse(w, h.logger, http.StatusTooManyRequests, "Connection quota exceeded", err.Error())
+		return
+	}
+	if err := h.quotaService.AcquireSubscription(quotaKey); err != nil {
+		h.quotaService.ReleaseConnection(quotaKey, 0)
+		writeErrorResponse(w, h.logger, http.StatusTooManyRequests, "Subscription quota exceeded", err.Error())
+		return
+	}
+	defer h.quotaService.ReleaseConnection(quotaKey, 1)
+
+	subscriberID := "sse-" + generateClientID()
+	err := h.pubsub.SubscribeWithOptions(subscriberID, topicName, pubsub.SubscribeOptions{
+		LastN:       lastN,
+		QueueSize:   queueSize,
+		OldestFirst: true,
+		ResumeAfter: resumeAfter,
+	})
+	if err != nil {
+		if models.IsErrorType(err, models.ErrTopicNotFound) {
+			writeErrorResponse(w, h.logger, http.StatusNotFound, err.Error(), "TOPIC_NOT_FOUND")
+		} else {
+			writeErrorResponse(w, h.logger, http.StatusInternalServerError, err.Error(), "INTERNAL")
+		}
+		return
+	}
+	defer h.pubsub.RemoveSubscriber(subscriberID)
+
+	messages := h.pubsub.GetSubscriberChannel(subscriberID)
+	if messages == nil {
+		writeErrorResponse(w, h.logger, http.StatusInternalServerError, "Subscriber not found", "INTERNAL")
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	h.logger.Infof("SSE client %s subscribed to topic %s", subscriberID, topicName)
+	defer h.logger.Infof("SSE client %s disconnected from topic %s", subscriberID, topicName)
+
+	controller := http.NewResponseController(w)
+	write := func(frame []byte) bool {
+		controller.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := w.Write(frame); err != nil {
+			return false
+		}
+		return controller.Flush() == nil
+	}
+
+	if !write([]byte(": connected\n\n")) {
+		return
+	}
+
+	heartbeat := time.NewTicker(time.Duration(h.config.SSEHeartbeatInterval) * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				// Subscriber removed, e.g. after a queue overflow
+				return
+			}
+			frame, err := encodeSSEFrame(message)
+			if err != nil {
+				h.logger.Errorf("Failed to encode event for SSE client %s: %v", subscriberID, err)
+				continue
+			}
+			if !write(frame) {
+				return
+			}
+			if message.Type == "info" && message.Msg == "topic_deleted" {
+				return
+			}
+		case <-heartbeat.C:
+			if !write([]byte(": heartbeat\n\n")) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Shutdown ends all event streams
+func (h *SSEHandler) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// encodeSSEFrame formats a server message as an event stream frame, sharing the encoding
+// across all recipients of a fan-out message
+func encodeSSEFrame(message *models.ServerMessage) ([]byte, error) {
+	if message.Frames == nil {
+		return sseFrame(message)
+	}
+	frame, err := message.Frames.Get("sse", func() (any, error) {
+		return sseFrame(message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return frame.([]byte), nil
+}
+
+// sseFrame formats a server message as an event stream frame. Events use the default
+// event type and carry the message ID, so clients can resume with Last-Event-ID; other
+// server messages are sent as events named after their type.
+func sseFrame(message *models.ServerMessage) ([]byte, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var frame bytes.Buffer
+	if message.Type == "event" {
+		if message.Message != nil && message.Message.ID != "" && !strings.ContainsAny(message.Message.ID, "\r\n") {
+			frame.WriteString("id: " + message.Message.ID + "\n")
+		}
+	} else {
+		frame.WriteString("event: " + message.Type + "\n")
+	}
+	frame.WriteString("data: ")
+	frame.Write(data)
+	frame.WriteString("\n\n")
+	return frame.Bytes(), nil
+}
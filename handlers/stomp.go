@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pub-sub/models"
+	"pub-sub/stomp"
+
+	"github.com/gorilla/websocket"
+)
+
+// stompConnected is the internal server message type queued to answer a CONNECT frame
+const stompConnected = "stomp_connected"
+
+// errStompSessionEnded stops the write pump after an ERROR frame or the receipt of a
+// DISCONNECT, both of which end a STOMP session
+var errStompSessionEnded = errors.New("STOMP session ended")
+
+// stompSendHeaders are SEND frame headers that are not copied into the message headers
+var stompSendHeaders = map[string]bool{
+	"destination":    true,
+	"content-type":   true,
+	"content-length": true,
+	"receipt":        true,
+	"priority":       true,
+	"message-id":     true,
+}
+
+// stompSession is the STOMP state of a WebSocket connection that negotiated the
+// v12.stomp subprotocol. STOMP frames are translated into client messages for the
+// WebSocket handlers, and their responses back into STOMP frames.
+type stompSession struct {
+	connected     bool                          // CONNECT was accepted
+	failed        bool                          // An ERROR frame was queued; later frames are ignored
+	subscriptions map[string]*stompSubscription // Subscriptions keyed by subscription ID
+	topics        map[string]*stompSubscription // Subscriptions keyed by topic
+	acks          map[string]*stompSubscription // Unacknowledged deliveries keyed by ack ID
+	nextAck       uint64                        // Counter for ack IDs
+	mutex         sync.Mutex                    // Protects the session; shared by the read and write pumps
+}
+
+// stompSubscription is a STOMP subscription to one topic. Subscriptions with the client
+// or client-individual ack mode use credit flow: each acknowledged delivery grants a credit.
+type stompSubscription struct {
+	ID          string   // Client-chosen subscription ID
+	Destination string   // Destination as given by the client, echoed in MESSAGE frames
+	Topic       string   // Topic named by the destination
+	AckMode     string   // auto, client or client-individual
+	pending     []string // Unacknowledged ack IDs in delivery order
+}
+
+// newStompSession creates the STOMP state of a connection
+func newStompSession() *stompSession {
+	return &stompSession{
+		subscriptions: make(map[string]*stompSubscription),
+		topics:        make(map[string]*stompSubscription),
+		acks:          make(map[string]*stompSubscription),
+	}
+}
+
+// stompTopic returns the topic named by a destination; the /topic/ prefix used by
+// STOMP brokers is optional
+func stompTopic(destination string) string {
+	return strings.TrimPrefix(destination, "/topic/")
+}
+
+// handleStompMessage handles the frames of one WebSocket message. It returns false when
+// the client disconnected without requesting a receipt.
+func (c *WebSocketClient) handleStompMessage(data []byte) bool {
+	frames, err := stomp.Parse(data)
+	if err != nil {
+		c.sendStompError("BAD_REQUEST", err.Error(), "")
+		return true
+	}
+
+	for _, frame := range frames {
+		c.stomp.mutex.Lock()
+		failed, connected := c.stomp.failed, c.stomp.connected
+		c.stomp.mutex.Unlock()
+		if failed {
+			return true
+		}
+
+		receipt := frame.Headers["receipt"]
+		if !connected && frame.Command != stomp.CommandConnect && frame.Command != stomp.CommandStomp {
+			c.sendStompError("BAD_REQUEST", "The first frame must be CONNECT", receipt)
+			return true
+		}
+
+		switch frame.Command {
+		case stomp.CommandConnect, stomp.CommandStomp:
+			c.handleStompConnect(frame)
+		case stomp.CommandSend:
+			c.handleStompSend(frame, receipt)
+		case stomp.CommandSubscribe:
+			c.handleStompSubscribe(frame, receipt)
+		case stomp.CommandUnsubscribe:
+			c.handleStompUnsubscribe(frame, receipt)
+		case stomp.CommandAck, stomp.CommandNack:
+			c.handleStompAck(frame, receipt)
+		case stomp.CommandBegin, stomp.CommandCommit, stomp.CommandAbort:
+			c.sendStompError("BAD_REQUEST", "Transactions are not supported", receipt)
+		case stomp.CommandDisconnect:
+			if receipt == "" {
+				return false
+			}
+			// The write pump ends the session once the receipt is written
+			c.enqueue(&models.ServerMessage{Type: "ack", RequestID: receipt, Status: "disconnect"})
+		default:
+			c.sendStompError("BAD_REQUEST", "Unsupported frame: "+frame.Command, receipt)
+		}
+	}
+	return true
+}
+
+// handleStompConnect accepts a CONNECT frame offering STOMP 1.2
+func (c *WebSocketClient) handleStompConnect(frame *stomp.Frame) {
+	c.stomp.mutex.Lock()
+	connected := c.stomp.connected
+	c.stomp.connected = true
+	c.stomp.mutex.Unlock()
+
+	if connected {
+		c.sendStompError("BAD_REQUEST", "Already connected", "")
+		return
+	}
+	if !strings.Contains(","+frame.Headers["accept-version"]+",", ",1.2,") {
+		c.sendStompError("BAD_REQUEST", "Only STOMP 1.2 is supported", "")
+		return
+	}
+
+	c.enqueue(&models.ServerMessage{Type: stompConnected})
+}
+
+// handleStompSend publishes the body of a SEND frame through the publish handler
+func (c *WebSocketClient) handleStompSend(frame *stomp.Frame, receipt string) {
+	destination := frame.Headers["destination"]
+	if destination == "" {
+		c.sendStompError("BAD_REQUEST", "SEND requires a destination header", receipt)
+		return
+	}
+	if frame.Headers["transaction"] != "" {
+		c.sendStompError("BAD_REQUEST", "Transactions are not supported", receipt)
+		return
+	}
+
+	message := &models.Message{
+		ID:       frame.Headers["message-id"],
+		Priority: frame.Headers["priority"],
+	}
+	if message.ID == "" {
+		message.ID = generateClientID()
+	}
+
+	// Bodies declared as JSON must decode; others are decoded like MQTT payloads
+	if strings.HasPrefix(frame.Headers["content-type"], "application/json") {
+		if err := json.Unmarshal(frame.Body, &message.Payload); err != nil {
+			c.sendStompError("BAD_REQUEST", "Invalid JSON body: "+err.Error(), receipt)
+			return
+		}
+	} else {
+		message.Payload = decodePayload(frame.Body)
+	}
+
+	for name, value := range frame.Headers {
+		if stompSendHeaders[name] {
+			continue
+		}
+		if message.Headers == nil {
+			message.Headers = make(map[string]string)
+		}
+		message.Headers[name] = value
+	}
+
+	c.handlePublish(&models.ClientMessage{
+		Type:      "publish",
+		Topic:     stompTopic(destination),
+		Message:   message,
+		RequestID: receipt,
+	})
+}
+
+// handleStompSubscribe subscribes through the subscribe handler. Client acknowledgement
+// modes subscribe with credit flow, starting with prefetch-count credits.
+func (c *WebSocketClient) handleStompSubscribe(frame *stomp.Frame, receipt string) {
+	id, destination := frame.Headers["id"], frame.Headers["destination"]
+	if id == "" || destination == "" {
+		c.sendStompError("BAD_REQUEST", "SUBSCRIBE requires id and destination headers", receipt)
+		return
+	}
+
+	ackMode := frame.Headers["ack"]
+	if ackMode == "" {
+		ackMode = "auto"
+	}
+	if ackMode != "auto" && ackMode != "client" && ackMode != "client-individual" {
+		c.sendStompError("BAD_REQUEST", "Unsupported ack mode: "+ackMode, receipt)
+		return
+	}
+
+	subscription := &stompSubscription{ID: id, Destination: destination, Topic: stompTopic(destination), AckMode: ackMode}
+	c.stomp.mutex.Lock()
+	_, idTaken := c.stomp.subscriptions[id]
+	_, topicTaken := c.stomp.topics[subscription.Topic]
+	if !idTaken && !topicTaken {
+		c.stomp.subscriptions[id] = subscription
+		c.stomp.topics[subscription.Topic] = subscription
+	}
+	c.stomp.mutex.Unlock()
+
+	if idTaken || topicTaken {
+		c.sendStompError("BAD_REQUEST", "Subscription ID or destination already subscribed", receipt)
+		return
+	}
+
+	clientMessage := &models.ClientMessage{
+		Type:      "subscribe",
+		Topic:     subscription.Topic,
+		RequestID: receipt,
+	}
+	if ackMode != "auto" {
+		credits, err := strconv.Atoi(frame.Headers["prefetch-count"])
+		if err != nil || credits <= 0 {
+			credits = c.queueSize
+		}
+		clientMessage.Flow, clientMessage.Credits = "credit", credits
+	}
+	c.handleSubscribe(clientMessage)
+
+	// The handler reports failures itself; drop the subscription if it did not take
+	c.mutex.RLock()
+	_, subscribed := c.Topics[subscription.Topic]
+	c.mutex.RUnlock()
+	if !subscribed {
+		c.stomp.remove(subscription)
+	}
+}
+
+// handleStompUnsubscribe unsubscribes through the unsubscribe handler
+func (c *WebSocketClient) handleStompUnsubscribe(frame *stomp.Frame, receipt string) {
+	c.stomp.mutex.Lock()
+	subscription, exists := c.stomp.subscriptions[frame.Headers["id"]]
+	c.stomp.mutex.Unlock()
+	if !exists {
+		c.sendStompError("BAD_REQUEST", "Unknown subscription ID: "+frame.Headers["id"], receipt)
+		return
+	}
+
+	c.stomp.remove(subscription)
+	c.handleUnsubscribe(&models.ClientMessage{
+		Type:      "unsubscribe",
+		Topic:     subscription.Topic,
+		RequestID: receipt,
+	})
+}
+
+// handleStompAck grants credits for acknowledged deliveries through the credit handler.
+// In client mode an ACK covers every earlier delivery of the subscription. NACK is
+// treated like ACK, since events are not redelivered.
+func (c *WebSocketClient) handleStompAck(frame *stomp.Frame, receipt string) {
+	subscription, credits := c.stomp.acknowledge(frame.Headers["id"])
+	if credits == 0 {
+		// Unknown or already acknowledged, e.g. after unsubscribing
+		c.sendAcknowledgment("", "ok", receipt)
+		return
+	}
+
+	c.handleCredit(&models.ClientMessage{
+		Type:      "credit",
+		Topic:     subscription.Topic,
+		Credits:   credits,
+		RequestID: receipt,
+	})
+}
+
+// sendStompError queues an ERROR frame, which ends the session
+func (c *WebSocketClient) sendStompError(code, details, receipt string) {
+	c.stomp.mutex.Lock()
+	c.stomp.failed = true
+	c.stomp.mutex.Unlock()
+
+	c.sendErrorMessage("STOMP error", code, details, receipt)
+}
+
+// remove forgets a subscription and its unacknowledged deliveries
+func (s *stompSession) remove(subscription *stompSubscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.subscriptions, subscription.ID)
+	if s.topics[subscription.Topic] == subscription {
+		delete(s.topics, subscription.Topic)
+	}
+	for _, ackID := range subscription.pending {
+		delete(s.acks, ackID)
+	}
+	subscription.pending = nil
+}
+
+// track records a delivery awaiting acknowledgement and returns its ack ID
+func (s *stompSession) track(subscription *stompSubscription) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextAck++
+	ackID := strconv.FormatUint(s.nextAck, 10)
+	s.acks[ackID] = subscription
+	subscription.pending = append(subscription.pending, ackID)
+	return ackID
+}
+
+// acknowledge settles a delivery, and in client mode every earlier one, returning the
+// subscription and the number of deliveries settled
+func (s *stompSession) acknowledge(ackID string) (*stompSubscription, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	subscription, exists := s.acks[ackID]
+	if !exists {
+		return nil, 0
+	}
+
+	index := 0
+	for index < len(subscription.pending) && subscription.pending[index] != ackID {
+		index++
+	}
+	settled := []string{ackID}
+	if subscription.AckMode == "client" {
+		settled = subscription.pending[:index+1]
+	}
+	for _, id := range settled {
+		delete(s.acks, id)
+	}
+
+	if subscription.AckMode == "client" {
+		subscription.pending = append([]string(nil), subscription.pending[index+1:]...)
+	} else {
+		subscription.pending = append(subscription.pending[:index], subscription.pending[index+1:]...)
+	}
+	return subscription, len(settled)
+}
+
+// writeStompMessage writes a server message as a STOMP frame. Acknowledgements become
+// RECEIPT frames when the request asked for one, and informational messages are not sent.
+func (c *WebSocketClient) writeStompMessage(message *models.ServerMessage) error {
+	var frame *stomp.Frame
+	ended := false
+
+	switch message.Type {
+	case stompConnected:
+		frame = stomp.NewFrame(stomp.CommandConnected, "version", "1.2", "heart-beat", "0,0", "server", "pub-sub", "session", c.ID)
+	case "event":
+		frame = c.stompMessageFrame(message)
+	case "ack":
+		if message.RequestID == "" {
+			return nil
+		}
+		frame = stomp.NewFrame(stomp.CommandReceipt, "receipt-id", message.RequestID)
+		ended = message.Status == "disconnect"
+	case "error":
+		frame = stompErrorFrame(message)
+		ended = true
+	}
+	if frame == nil {
+		return nil
+	}
+
+	data := frame.Encode()
+	compress := c.compress.Load() && len(data) >= c.Handler.config.CompressionThreshold
+	c.Conn.EnableWriteCompression(compress)
+	c.Handler.compression.RecordWebSocketMessage(len(data), compress)
+	if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	if ended {
+		return errStompSessionEnded
+	}
+	return nil
+}
+
+// stompMessageFrame builds the MESSAGE frame of an event, or nil if the event's topic
+// has no STOMP subscription
+func (c *WebSocketClient) stompMessageFrame(message *models.ServerMessage) *stomp.Frame {
+	if message.Message == nil {
+		return nil
+	}
+
+	c.stomp.mutex.Lock()
+	subscription := c.stomp.topics[message.Topic]
+	c.stomp.mutex.Unlock()
+	if subscription == nil {
+		return nil
+	}
+
+	payload, err := encodeEventPayload(message)
+	if err != nil {
+		c.Handler.logger.Errorf("Failed to encode event for STOMP client %s: %v", c.ID, err)
+		return nil
+	}
+
+	contentType := "application/json"
+	if _, text := message.Message.Payload.(string); text {
+		contentType = "text/plain"
+	} else if _, binary := message.Message.Payload.([]byte); binary {
+		contentType = "application/octet-stream"
+	}
+
+	frame := stomp.NewFrame(stomp.CommandMessage,
+		"subscription", subscription.ID,
+		"message-id", message.Message.ID,
+		"destination", subscription.Destination,
+		"content-type", contentType,
+	)
+	for name, value := range message.Message.Headers {
+		if _, reserved := frame.Headers[name]; !reserved {
+			frame.Headers[name] = value
+		}
+	}
+	if message.Message.Priority != "" {
+		frame.Headers["priority"] = message.Message.Priority
+	}
+	if subscription.AckMode != "auto" {
+		frame.Headers["ack"] = c.stomp.track(subscription)
+	}
+	frame.Body = payload
+	return frame
+}
+
+// stompErrorFrame builds the ERROR frame of an error message. The message header
+// carries the error code; schema violations are listed in a JSON body.
+func stompErrorFrame(message *models.ServerMessage) *stomp.Frame {
+	frame := stomp.NewFrame(stomp.CommandError, "content-type", "text/plain")
+	if message.RequestID != "" {
+		frame.Headers["receipt-id"] = message.RequestID
+	}
+	if message.Error == nil {
+		return frame
+	}
+
+	frame.Headers["message"] = message.Error.Code
+	frame.Body = []byte(message.Error.Message)
+	if len(message.Error.Violations) > 0 {
+		if body, err := json.Marshal(message.Error); err == nil {
+			frame.Headers["content-type"] = "application/json"
+			frame.Body = body
+		}
+	}
+	return frame
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"pub-sub/services"
+	"pub-sub/stomp"
+
+	"github.com/gorilla/websocket"
+)
+
+// stompClient is a minimal STOMP over WebSocket client for driving the handler
+type stompClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func (c *stompClient) send(command string, body string, headers ...string) {
+	c.t.Helper()
+	frame := stomp.NewFrame(command, headers...)
+	frame.Body = []byte(body)
+	if err := c.conn.WriteMessage(websocket.TextMessage, frame.Encode()); err != nil {
+		c.t.Fatalf("Failed to send %s: %v", command, err)
+	}
+}
+
+func (c *stompClient) receive() *stomp.Frame {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("Failed to receive frame: %v", err)
+	}
+	frames, err := stomp.Parse(data)
+	if err != nil || len(frames) != 1 {
+		c.t.Fatalf("Expected one frame, got %v %v", frames, err)
+	}
+	return frames[0]
+}
+
+// receiveCommands receives n frames, returning them sorted by command, since receipts
+// and deliveries are written by different goroutines
+func (c *stompClient) receiveCommands(n int) []*stomp.Frame {
+	c.t.Helper()
+	frames := make([]*stomp.Frame, n)
+	for i := range frames {
+		frames[i] = c.receive()
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].Command < frames[j].Command })
+	return frames
+}
+
+func TestStompOverWebSocket(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:  10,
+		MaxPublishRate:       1000,
+		MaxClientPublishRate: 1000,
+		MaxBatchSize:         10,
+		MaxMessageSize:       1024,
+		MaxFrameSize:         4096,
+		DefaultQueueSize:     10,
+		MaxQueueSize:         100,
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	rejections := metrics.NewRejections()
+	schemas := services.NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	quotas := services.NewQuotaService(ps, cfg, log)
+	messages := services.NewMessageService(ps, quotas, schemas, rejections, cfg, log)
+	handler := NewWebSocketHandler(ps, messages, quotas, schemas, metrics.NewCompression(), rejections, cfg, log)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.HandleWebSocket))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{stomp.Subprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != stomp.Subprotocol {
+		t.Fatalf("Expected %s to be negotiated, got %q", stomp.Subprotocol, conn.Subprotocol())
+	}
+	client := &stompClient{t: t, conn: conn}
+
+	client.send(stomp.CommandConnect, "", "accept-version", "1.1,1.2", "host", "localhost")
+	if connected := client.receive(); connected.Command != stomp.CommandConnected || connected.Headers["version"] != "1.2" {
+		t.Fatalf("Expected CONNECTED 1.2, got %+v", connected)
+	}
+
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Client acknowledgement subscribes with credit flow, one credit per prefetched message
+	client.send(stomp.CommandSubscribe, "", "id", "sub-0", "destination", "/topic/orders", "ack", "client-individual", "prefetch-count", "1", "receipt", "r-1")
+	if receipt := client.receive(); receipt.Command != stomp.CommandReceipt || receipt.Headers["receipt-id"] != "r-1" {
+		t.Fatalf("Expected RECEIPT r-1, got %+v", receipt)
+	}
+
+	client.send(stomp.CommandSend, `{"amount":5}`, "destination", "/topic/orders", "content-type", "application/json", "receipt", "r-2")
+	frames := client.receiveCommands(2)
+	message, receipt := frames[0], frames[1]
+	if receipt.Command != stomp.CommandReceipt || receipt.Headers["receipt-id"] != "r-2" {
+		t.Fatalf("Expected RECEIPT r-2, got %+v", receipt)
+	}
+	if message.Command != stomp.CommandMessage || message.Headers["subscription"] != "sub-0" ||
+		message.Headers["destination"] != "/topic/orders" || string(message.Body) != `{"amount":5}` || message.Headers["ack"] == "" {
+		t.Fatalf("Unexpected MESSAGE: %+v", message)
+	}
+
+	// The next message waits for the acknowledgement of the first
+	client.send(stomp.CommandSend, "second", "destination", "orders", "trace-id", "t-1")
+	client.send(stomp.CommandAck, "", "id", message.Headers["ack"])
+	second := client.receive()
+	if second.Command != stomp.CommandMessage || string(second.Body) != "second" ||
+		second.Headers["content-type"] != "text/plain" || second.Headers["trace-id"] != "t-1" {
+		t.Fatalf("Expected the second MESSAGE after ACK, got %+v", second)
+	}
+
+	// Failures end the session with an ERROR frame carrying the error code
+	client.send(stomp.CommandSend, "lost", "destination", "/topic/missing", "receipt", "r-3")
+	if failure := client.receive(); failure.Command != stomp.CommandError || failure.Headers["message"] != "TOPIC_NOT_FOUND" || failure.Headers["receipt-id"] != "r-3" {
+		t.Fatalf("Expected ERROR TOPIC_NOT_FOUND, got %+v", failure)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("Expected the connection to close after ERROR")
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"pub-sub/models"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateWebhook handles POST /webhooks endpoint
+func (h *RestHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendInvalidBody(w, err)
+		return
+	}
+
+	response, err := h.webhookService.CreateWebhook(clientKey(h.quotaService, r), &request)
+	if err != nil {
+		h.sendWebhookError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusCreated, response)
+}
+
+// ListWebhooks handles GET /webhooks endpoint
+func (h *RestHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	h.sendJSONResponse(w, http.StatusOK, h.webhookService.ListWebhooks())
+}
+
+// GetWebhook handles GET /webhooks/{id} endpoint
+func (h *RestHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	response, err := h.webhookService.GetWebhook(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendWebhookError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// DeleteWebhook handles DELETE /webhooks/{id} endpoint
+func (h *RestHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.webhookService.DeleteWebhook(id); err != nil {
+		h.sendWebhookError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, map[string]string{
+		"status": "deleted",
+		"id":     id,
+	})
+}
+
+// sendWebhookError maps webhook service errors to HTTP responses
+func (h *RestHandler) sendWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case models.IsErrorType(err, models.ErrTopicRequired):
+		h.sendErrorResponse(w, http.StatusBadRequest, "Topic is required", "TOPIC_REQUIRED")
+	case models.IsErrorType(err, models.ErrInvalidWebhook):
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_WEBHOOK")
+	case models.IsErrorType(err, models.ErrTopicNotFound):
+		h.sendErrorResponse(w, http.StatusNotFound, err.Error(), "TOPIC_NOT_FOUND")
+	case models.IsErrorType(err, models.ErrWebhookNotFound):
+		h.sendErrorResponse(w, http.StatusNotFound, err.Error(), "WEBHOOK_NOT_FOUND")
+	case models.IsErrorType(err, models.ErrQuotaExceeded):
+		h.sendErrorResponse(w, http.StatusForbidden, err.Error(), "QUOTA_EXCEEDED")
+	default:
+		h.logger.Errorf("Webhook operation failed: %v", err)
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), "INTERNAL")
+	}
+}
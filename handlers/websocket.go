@@ -2,103 +2,222 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"pub-sub/codec"
 	"pub-sub/config"
 	"pub-sub/logger"
+	"pub-sub/metrics"
 	"pub-sub/models"
 	"pub-sub/pubsub"
+	"pub-sub/services"
+	"pub-sub/stomp"
 	"pub-sub/utils"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// WebSocket protocol versions spoken by the server. Clients announce their version in
+// hello and the lower of the two is used.
+const (
+	minProtocolVersion = 1
+	protocolVersion    = 1
+)
+
 // WebSocketHandler handles WebSocket connections for pub-sub operations
 type WebSocketHandler struct {
-	pubsub   *pubsub.PubSub              // Reference to the pub-sub system
-	upgrader websocket.Upgrader          // WebSocket upgrader
-	clients  map[string]*WebSocketClient // Map of client IDs to WebSocket clients
-	mutex    sync.RWMutex                // Mutex for thread-safe client management
-	logger   logger.Logger               // Logger instance
+	pubsub         *pubsub.PubSub              // Reference to the pub-sub system
+	messageService *services.MessageService    // Message publishing service
+	quotaService   *services.QuotaService      // Per-client quota enforcement
+	schemaService  *services.SchemaService     // Schema versions read by subscribers
+	config         *config.Config              // System configuration
+	compression    *metrics.Compression        // Compression ratio metrics
+	rejections     *metrics.Rejections         // Frames rejected by the size limit
+	upgrader       websocket.Upgrader          // WebSocket upgrader
+	clients        map[string]*WebSocketClient // Map of client IDs to WebSocket clients
+	sessions       map[string]*wsSession       // Sessions of dropped clients awaiting resumption, by token
+	closing        bool                        // Set on shutdown, when sessions are no longer kept
+	mutex          sync.RWMutex                // Mutex for thread-safe client management
+	logger         logger.Logger               // Logger instance
 }
 
 // WebSocketClient represents a connected WebSocket client
 type WebSocketClient struct {
-	ID          string                     // Unique client identifier
-	Conn        *websocket.Conn            // WebSocket connection
-	Topics      map[string]string          // Map of topic names to subscription IDs
-	SendChan    chan *models.ServerMessage // Channel for sending messages
-	Handler     *WebSocketHandler          // Reference to the handler
-	mutex       sync.RWMutex               // Client-level mutex
-	stopChan    chan struct{}              // Channel to stop message forwarding
-	ConnectedAt time.Time                  // When the client connected
+	ID             string                     // Unique client identifier
+	Conn           *websocket.Conn            // WebSocket connection
+	Topics         map[string]string          // Map of topic names to subscription IDs
+	schemaVersions map[string]int             // Schema versions read by subscriptions that requested one
+	SendChan       chan *models.ServerMessage // Channel for sending messages
+	Handler        *WebSocketHandler          // Reference to the handler
+	mutex          sync.RWMutex               // Client-level mutex
+	dispatchers    map[string]*dispatcher     // Dispatch loops delivering subscriber queues, by subscriber ID
+	dispatching    sync.WaitGroup             // Running dispatch loops
+	done           chan struct{}              // Closed when the connection stops delivering events
+	unsent         []*models.ServerMessage    // Events held by dispatch loops when delivery stopped
+	ConnectedAt    time.Time                  // When the client connected
+	publisher      services.Publisher         // Rate limiting and quota identity
+	queueSize      int                        // Queue size negotiated on connect, used for subscriptions
+	highMark       int64                      // Highest observed send queue depth (accessed atomically)
+	deflate        bool                       // permessage-deflate was negotiated
+	compress       atomic.Bool                // Server messages are compressed, unless turned off by hello
+	version        int                        // Protocol version, lowered by hello
+	acks           bool                       // Acks are sent for successful operations, unless turned off by hello
+	name           string                     // Client name announced in hello
+	codec          codec.Codec                // Wire encoding negotiated via subprotocol
+	stomp          *stompSession              // STOMP state when v12.stomp was negotiated, nil otherwise
+	session        string                     // Token for resuming the session, empty when sessions are disabled
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
-func NewWebSocketHandler(pubsub *pubsub.PubSub, cfg *config.Config, log logger.Logger) *WebSocketHandler {
+func NewWebSocketHandler(pubsub *pubsub.PubSub, messageService *services.MessageService, quotaService *services.QuotaService, schemaService *services.SchemaService, compression *metrics.Compression, rejections *metrics.Rejections, cfg *config.Config, log logger.Logger) *WebSocketHandler {
 	return &WebSocketHandler{
-		pubsub: pubsub,
-		logger: log,
+		pubsub:         pubsub,
+		messageService: messageService,
+		quotaService:   quotaService,
+		schemaService:  schemaService,
+		config:         cfg,
+		compression:    compression,
+		rejections:     rejections,
+		logger:         log,
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  cfg.ReadBufferSize,
-			WriteBufferSize: cfg.WriteBufferSize,
+			ReadBufferSize:    cfg.ReadBufferSize,
+			WriteBufferSize:   cfg.WriteBufferSize,
+			EnableCompression: cfg.WSCompression,
+			Subprotocols:      append(codec.Subprotocols(), stomp.Subprotocol),
 			CheckOrigin: func(r *http.Request) bool {
 				// Allow all origins for development
 				// In production, implement proper origin checking
 				return true
 			},
 		},
-		clients: make(map[string]*WebSocketClient),
+		clients:  make(map[string]*WebSocketClient),
+		sessions: make(map[string]*wsSession),
 	}
 }
 
 // HandleWebSocket handles WebSocket upgrade and client management
 func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Upgrade HTTP connection to WebSocket
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	// Enforce the connection quota before upgrading
+	quotaKey := clientKey(h.quotaService, r)
+	if err := h.quotaService.AcquireConnection(quotaKey); err != nil {
+		writeErrorResponse(w, h.logger, http.StatusTooManyRequests, "Connection quota exceeded", err.Error())
+		return
+	}
+
+	// Upgrade HTTP connection to WebSocket, counting bytes on the wire for compression metrics
+	counter := &wireCountingWriter{ResponseWriter: w, compression: h.compression}
+	conn, err := h.upgrader.Upgrade(counter, r, nil)
 	if err != nil {
 		h.logger.Errorf("WebSocket upgrade failed: %v", err)
+		h.quotaService.ReleaseConnection(quotaKey, 0)
 		return
 	}
+	counter.startCounting()
+
+	// The subprotocol selects the wire encoding; JSON is used when none was negotiated.
+	// STOMP connections exchange STOMP frames instead.
+	clientCodec, _ := codec.ForSubprotocol(conn.Subprotocol())
+	encoding := conn.Subprotocol()
+	var stompState *stompSession
+	if encoding == stomp.Subprotocol {
+		clientCodec, stompState = codec.Default, newStompSession()
+	} else {
+		encoding = clientCodec.Name()
+	}
+
+	// permessage-deflate is used when enabled and offered by the client
+	compress := h.config.WSCompression && offersDeflate(r)
+	if compress {
+		conn.SetCompressionLevel(h.config.CompressionLevel)
+	}
+
+	// Resolve the requested queue size (?queue_size=N) against the server bounds
+	requestedQueueSize, _ := strconv.Atoi(r.URL.Query().Get("queue_size"))
+	queueSize := h.config.QueueSize(requestedQueueSize)
 
-	// Generate unique client ID
+	// A token from an earlier connection (?session=...) resumes its session under the same
+	// client ID, otherwise a new session is started. STOMP connections have no sessions.
 	clientID := generateClientID()
+	token := r.URL.Query().Get("session")
+	var session *wsSession
+	if stompState == nil && token != "" {
+		session = h.claimSession(token, quotaKey)
+	}
+	topics, schemaVersions := make(map[string]string), make(map[string]int)
+	sessionToken := ""
+	if session != nil {
+		clientID, sessionToken = session.clientID, session.token
+		topics, schemaVersions = session.topics, session.schemaVersions
+	} else if stompState == nil && h.config.WSSessionGracePeriod > 0 {
+		sessionToken = utils.RandomString(32)
+	}
+
+	// Connections identified by an API key share its rate limits, others are limited per connection
+	publisher := services.Publisher{RateKey: clientID, QuotaKey: quotaKey}
+	if services.IsAPIKey(quotaKey) {
+		publisher.RateKey = publisher.QuotaKey
+	}
 
 	// Create new WebSocket client
 	client := &WebSocketClient{
-		ID:          clientID,
-		Conn:        conn,
-		Topics:      make(map[string]string),
-		SendChan:    make(chan *models.ServerMessage, 100), // Buffer for messages
-		Handler:     h,
-		stopChan:    make(chan struct{}),
-		ConnectedAt: time.Now(),
+		ID:             clientID,
+		Conn:           conn,
+		Topics:         topics,
+		schemaVersions: schemaVersions,
+		SendChan:       make(chan *models.ServerMessage, queueSize),
+		Handler:        h,
+		dispatchers:    make(map[string]*dispatcher),
+		done:           make(chan struct{}),
+		ConnectedAt:    time.Now(),
+		publisher:      publisher,
+		queueSize:      queueSize,
+		deflate:        compress,
+		version:        protocolVersion,
+		acks:           true,
+		codec:          clientCodec,
+		stomp:          stompState,
+		session:        sessionToken,
 	}
 
+	client.compress.Store(compress)
+
 	// Register client
 	h.mutex.Lock()
 	h.clients[clientID] = client
 	h.mutex.Unlock()
 
-	h.logger.Infof("WebSocket client connected successfully: client_id=%s, remote_addr=%s, user_agent=%s", clientID, r.RemoteAddr, r.UserAgent())
+	h.logger.Infof("WebSocket client connected successfully: client_id=%s, remote_addr=%s, user_agent=%s, queue_size=%d, compression=%t, encoding=%s, resumed=%t", clientID, r.RemoteAddr, r.UserAgent(), queueSize, compress, encoding, session != nil)
 
 	// Start client goroutines
 	go client.readPump()
 	go client.writePump()
 
-	// Send welcome message
-	client.sendSystemMessage("Connected to Pub/Sub system", "")
+	// Send welcome message, restoring the subscriptions of a resumed session
+	if session != nil {
+		h.resumeSession(client, session)
+		return
+	}
+	client.sendWelcome("Connected to Pub/Sub system", "")
+	if token != "" && stompState == nil {
+		client.sendErrorMessage("Session not resumed", "SESSION_NOT_FOUND", "Session token is unknown or its grace period has ended", "")
+	}
 }
 
 // readPump reads messages from the WebSocket connection
 func (c *WebSocketClient) readPump() {
 	defer func() {
-		c.Handler.removeClient(c.ID)
+		c.Handler.removeClient(c)
 		c.Conn.Close()
 	}()
 
+	// Frames over the limit close the connection with 1009 (message too big)
+	c.Conn.SetReadLimit(int64(c.Handler.config.MaxFrameSize))
+
 	// Set read deadline
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
@@ -110,15 +229,26 @@ func (c *WebSocketClient) readPump() {
 		// Read message from WebSocket
 		_, messageBytes, err := c.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.Handler.rejections.RecordFrame()
+				c.Handler.logger.Warnf("Client %s sent a frame over %d bytes, closing connection", c.ID, c.Handler.config.MaxFrameSize)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.Handler.logger.Errorf("WebSocket read error for client %s: %v", c.ID, err)
 			}
 			break
 		}
 
-		// Parse WebSocket message
+		// STOMP frames are translated onto the same handlers
+		if c.stomp != nil {
+			if !c.handleStompMessage(messageBytes) {
+				break
+			}
+			continue
+		}
+
+		// Parse WebSocket message with the negotiated encoding
 		var clientMessage models.ClientMessage
-		if err := json.Unmarshal(messageBytes, &clientMessage); err != nil {
+		if err := c.codec.Unmarshal(messageBytes, &clientMessage); err != nil {
 			c.sendErrorMessage("Invalid message format", "BAD_REQUEST", err.Error(), "")
 			continue
 		}
@@ -149,7 +279,10 @@ func (c *WebSocketClient) writePump() {
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 
 			// Send message
-			if err := c.Conn.WriteJSON(message); err != nil {
+			if err := c.writeServerMessage(message); err != nil {
+				if errors.Is(err, errStompSessionEnded) {
+					return
+				}
 				c.Handler.logger.Errorf("WebSocket write error for client %s: %v", c.ID, err)
 				return
 			}
@@ -164,15 +297,75 @@ func (c *WebSocketClient) writePump() {
 	}
 }
 
+// preparedFrame is a fan-out event encoded once per codec and shared across connections
+type preparedFrame struct {
+	size     int                        // Uncompressed size in bytes
+	prepared *websocket.PreparedMessage // Frame data, compressed lazily per negotiated setting
+}
+
+// writeServerMessage writes a message to the connection in the negotiated encoding,
+// compressing it when deflate was negotiated and the message reaches the threshold.
+// Fan-out events are encoded once per codec into a prepared message shared by every
+// subscriber's connection.
+func (c *WebSocketClient) writeServerMessage(message *models.ServerMessage) error {
+	if c.stomp != nil {
+		return c.writeStompMessage(message)
+	}
+
+	config := c.Handler.config
+	frameType := websocket.TextMessage
+	if c.codec.Binary() {
+		frameType = websocket.BinaryMessage
+	}
+
+	if message.Frames == nil {
+		data, err := c.codec.Marshal(message)
+		if err != nil {
+			return err
+		}
+		compress := c.compress.Load() && len(data) >= config.CompressionThreshold
+		c.Conn.EnableWriteCompression(compress)
+		c.Handler.compression.RecordWebSocketMessage(len(data), compress)
+		return c.Conn.WriteMessage(frameType, data)
+	}
+
+	frame, err := message.Frames.Get(c.codec.Name(), func() (any, error) {
+		data, err := c.codec.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		prepared, err := websocket.NewPreparedMessage(frameType, data)
+		if err != nil {
+			return nil, err
+		}
+		return &preparedFrame{size: len(data), prepared: prepared}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prepared := frame.(*preparedFrame)
+	compress := c.compress.Load() && prepared.size >= config.CompressionThreshold
+	c.Conn.EnableWriteCompression(compress)
+	c.Handler.compression.RecordWebSocketMessage(prepared.size, compress)
+	return c.Conn.WritePreparedMessage(prepared.prepared)
+}
+
 // handleMessage processes incoming WebSocket messages
 func (c *WebSocketClient) handleMessage(clientMessage *models.ClientMessage) {
 	switch clientMessage.Type {
+	case "hello":
+		c.handleHello(clientMessage)
 	case "publish":
 		c.handlePublish(clientMessage)
+	case "publish_batch":
+		c.handlePublishBatch(clientMessage)
 	case "subscribe":
 		c.handleSubscribe(clientMessage)
 	case "unsubscribe":
 		c.handleUnsubscribe(clientMessage)
+	case "credit":
+		c.handleCredit(clientMessage)
 	case "ping":
 		c.handlePing(clientMessage)
 	default:
@@ -180,6 +373,38 @@ func (c *WebSocketClient) handleMessage(clientMessage *models.ClientMessage) {
 	}
 }
 
+// handleHello negotiates the protocol version and features and replies with a welcome
+// message listing the capabilities and limits in effect
+func (c *WebSocketClient) handleHello(clientMessage *models.ClientMessage) {
+	if clientMessage.Version != 0 && clientMessage.Version < minProtocolVersion {
+		c.sendErrorMessage("Unsupported version", "UNSUPPORTED_VERSION",
+			fmt.Sprintf("Protocol version %d is not supported, versions %d to %d are", clientMessage.Version, minProtocolVersion, protocolVersion), clientMessage.RequestID)
+		return
+	}
+
+	c.mutex.Lock()
+	c.version = protocolVersion
+	if clientMessage.Version != 0 {
+		c.version = min(clientMessage.Version, protocolVersion)
+	}
+	if clientMessage.ClientName != "" {
+		c.name = clientMessage.ClientName
+	}
+	if features := clientMessage.Features; features != nil {
+		if features.Acks != nil {
+			c.acks = *features.Acks
+		}
+		// Compression can only be turned on if permessage-deflate was negotiated on
+		// connect; the encoding is fixed by the subprotocol
+		if features.Compression != nil {
+			c.compress.Store(*features.Compression && c.deflate)
+		}
+	}
+	c.mutex.Unlock()
+
+	c.sendWelcome("Hello acknowledged", clientMessage.RequestID)
+}
+
 // handlePublish handles publish messages
 func (c *WebSocketClient) handlePublish(clientMessage *models.ClientMessage) {
 	if clientMessage.Topic == "" {
@@ -198,13 +423,35 @@ func (c *WebSocketClient) handlePublish(clientMessage *models.ClientMessage) {
 	}
 
 	// Publish message to topic
-	err := c.Handler.pubsub.PublishMessage(clientMessage.Topic, clientMessage.Message)
+	_, err := c.Handler.messageService.PublishMessage(c.publisher, clientMessage.Topic, clientMessage.Message)
 	if err != nil {
 		errorCode := "INTERNAL"
+		details := err.Error()
+		var rateLimitErr *models.RateLimitError
+		var quotaErr *models.QuotaError
+		var schemaErr *models.SchemaError
 		if err.Error() == "TOPIC_NOT_FOUND" {
 			errorCode = "TOPIC_NOT_FOUND"
+		} else if errors.As(err, &schemaErr) {
+			c.sendSchemaViolation(schemaErr, clientMessage.RequestID)
+			return
+		} else if models.IsErrorType(err, models.ErrSchemaNotFound) || models.IsErrorType(err, models.ErrSchemaVersionNotFound) {
+			errorCode = err.Error()
+			details = "Schema version header does not name a registered version of the topic schema"
+		} else if models.IsErrorType(err, models.ErrMessageTooLarge) {
+			errorCode = "MESSAGE_TOO_LARGE"
+			details = messageSizeDetails(err)
+		} else if models.IsErrorType(err, models.ErrInvalidPriority) {
+			errorCode = "BAD_REQUEST"
+			details = "Priority must be one of low, normal or high"
+		} else if errors.As(err, &rateLimitErr) {
+			errorCode = "RATE_LIMITED"
+			details = fmt.Sprintf("Publish rate exceeded for %s, retry after %dms", rateLimitErr.Scope, rateLimitErr.RetryAfter.Milliseconds())
+		} else if errors.As(err, &quotaErr) {
+			errorCode = "QUOTA_EXCEEDED"
+			details = fmt.Sprintf("Client quota exceeded for %s (limit %d)", quotaErr.Resource, quotaErr.Limit)
 		}
-		c.sendErrorMessage("Publish failed", errorCode, err.Error(), clientMessage.RequestID)
+		c.sendErrorMessage("Publish failed", errorCode, details, clientMessage.RequestID)
 		return
 	}
 
@@ -212,6 +459,27 @@ func (c *WebSocketClient) handlePublish(clientMessage *models.ClientMessage) {
 	c.sendAcknowledgment(clientMessage.Topic, "ok", clientMessage.RequestID)
 }
 
+// handlePublishBatch handles publish_batch messages
+func (c *WebSocketClient) handlePublishBatch(clientMessage *models.ClientMessage) {
+	response, err := c.Handler.messageService.PublishBatch(c.publisher, clientMessage.Messages)
+	if err != nil {
+		c.sendErrorMessage("Batch publish failed", err.Error(), err.Error(), clientMessage.RequestID)
+		return
+	}
+
+	ackMessage := models.ServerMessage{
+		Type:      "ack",
+		RequestID: clientMessage.RequestID,
+		Status:    response.Status,
+		Results:   response.Results,
+		TS:        time.Now().Format(time.RFC3339),
+	}
+
+	if !c.enqueue(&ackMessage) {
+		c.Handler.logger.Warnf("Failed to send batch acknowledgment to client %s: channel full", c.ID)
+	}
+}
+
 // handleSubscribe handles subscribe messages
 func (c *WebSocketClient) handleSubscribe(clientMessage *models.ClientMessage) {
 	if clientMessage.Topic == "" {
@@ -226,9 +494,65 @@ func (c *WebSocketClient) handleSubscribe(clientMessage *models.ClientMessage) {
 		c.Handler.logger.Debugf("Using generated client ID %s for subscription to topic %s", subscriberID, clientMessage.Topic)
 	}
 
+	// Subscription queue defaults to the size negotiated on connect
+	queueSize := clientMessage.QueueSize
+	if queueSize <= 0 {
+		queueSize = c.queueSize
+	}
+
+	// Subscriptions reading a schema version only receive messages conforming to it.
+	// Credit-mode subscriptions cannot skip messages, since skipped messages would
+	// consume credits.
+	if clientMessage.SchemaVersion != 0 {
+		if clientMessage.Flow == "credit" {
+			c.sendErrorMessage("Subscribe failed", "BAD_REQUEST", "schema_version cannot be combined with credit flow", clientMessage.RequestID)
+			return
+		}
+		if err := c.Handler.schemaService.CheckVersion(clientMessage.Topic, clientMessage.SchemaVersion); err != nil {
+			c.sendErrorMessage("Subscribe failed", err.Error(), "Schema version is not registered for the topic", clientMessage.RequestID)
+			return
+		}
+	}
+
+	// Route the topic to the subscriber before subscribing, so that a running dispatch loop
+	// does not drop events delivered before the subscribe call returns
+	c.mutex.Lock()
+	previousID, alreadySubscribed := c.Topics[clientMessage.Topic]
+	previousVersion := c.schemaVersions[clientMessage.Topic]
+	c.route(clientMessage.Topic, subscriberID, clientMessage.SchemaVersion)
+	c.mutex.Unlock()
+	restoreRoute := func() {
+		c.mutex.Lock()
+		if alreadySubscribed {
+			c.route(clientMessage.Topic, previousID, previousVersion)
+		} else {
+			delete(c.Topics, clientMessage.Topic)
+			delete(c.schemaVersions, clientMessage.Topic)
+		}
+		c.mutex.Unlock()
+	}
+
+	// New subscriptions count against the client's subscription quota
+	if !alreadySubscribed {
+		if err := c.Handler.quotaService.AcquireSubscription(c.publisher.QuotaKey); err != nil {
+			restoreRoute()
+			c.sendErrorMessage("Subscribe failed", "QUOTA_EXCEEDED", "Client quota exceeded for subscriptions", clientMessage.RequestID)
+			return
+		}
+	}
+
 	// Subscribe to topic
-	err := c.Handler.pubsub.Subscribe(subscriberID, clientMessage.Topic, clientMessage.LastN)
+	err := c.Handler.pubsub.SubscribeWithOptions(subscriberID, clientMessage.Topic, pubsub.SubscribeOptions{
+		LastN:      clientMessage.LastN,
+		QueueSize:  queueSize,
+		CreditMode: clientMessage.Flow == "credit",
+		Credits:    clientMessage.Credits,
+	})
 	if err != nil {
+		restoreRoute()
+		if !alreadySubscribed {
+			c.Handler.quotaService.ReleaseSubscription(c.publisher.QuotaKey)
+		}
 		errorCode := "INTERNAL"
 		if err.Error() == "TOPIC_NOT_FOUND" {
 			errorCode = "TOPIC_NOT_FOUND"
@@ -237,64 +561,176 @@ func (c *WebSocketClient) handleSubscribe(clientMessage *models.ClientMessage) {
 		return
 	}
 
-	// Add topic to client's topic list with subscription ID
-	c.mutex.Lock()
-	c.Topics[clientMessage.Topic] = subscriberID
-	c.mutex.Unlock()
+	// A subscription moved to another subscriber ID leaves the previous subscriber
+	if alreadySubscribed && previousID != subscriberID {
+		c.Handler.pubsub.Unsubscribe(previousID, clientMessage.Topic)
+		c.stopDispatcher(previousID)
+	}
 
-	// Start a goroutine to forward messages from pubsub to WebSocket client
-	go c.forwardMessagesFromPubSub(clientMessage.Topic)
+	// Deliver the subscriber's queue to the connection
+	c.startDispatcher(subscriberID)
 
 	// Send acknowledgment
 	c.sendAcknowledgment(clientMessage.Topic, "ok", clientMessage.RequestID)
 }
 
-// forwardMessagesFromPubSub forwards messages from the pubsub system to the WebSocket client
-func (c *WebSocketClient) forwardMessagesFromPubSub(topicName string) {
-	// Get the subscription ID for this topic
-	c.mutex.RLock()
-	subscriberID, exists := c.Topics[topicName]
-	c.mutex.RUnlock()
+// dispatcher is the dispatch loop delivering one subscriber's queue to a connection.
+// Subscriptions sharing a subscriber ID share its queue, so events are routed to the
+// connection by topic rather than read by one goroutine per topic.
+type dispatcher struct {
+	messages chan *models.ServerMessage // Subscriber queue the loop reads
+	stop     chan struct{}              // Closed when the connection no longer uses the subscriber
+}
 
-	if !exists {
-		c.Handler.logger.Errorf("Topic %s not found in client's topic list", topicName)
-		return
+// route records the subscriber ID and schema version a topic's events are delivered
+// through. Caller must hold the client lock.
+func (c *WebSocketClient) route(topicName, subscriberID string, schemaVersion int) {
+	c.Topics[topicName] = subscriberID
+	if schemaVersion != 0 {
+		c.schemaVersions[topicName] = schemaVersion
+	} else {
+		delete(c.schemaVersions, topicName)
 	}
+}
 
-	// Get the subscriber's message channel from pubsub system
-	messageChan := c.Handler.pubsub.GetSubscriberChannel(subscriberID)
-	if messageChan == nil {
+// startDispatcher starts the dispatch loop of a subscriber unless one is already
+// delivering its current queue
+func (c *WebSocketClient) startDispatcher(subscriberID string) {
+	messages := c.Handler.pubsub.GetSubscriberChannel(subscriberID)
+	if messages == nil {
 		c.Handler.logger.Errorf("Subscriber %s not found in pubsub system", subscriberID)
 		return
 	}
 
-	// Listen for messages on the subscriber's channel
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if running, exists := c.dispatchers[subscriberID]; exists && running.messages == messages {
+		return
+	}
+	select {
+	case <-c.done:
+		// The connection is being removed
+		return
+	default:
+	}
+
+	// A loop left over from a removed subscriber has already returned, since removal
+	// closes the queue it read
+	d := &dispatcher{messages: messages, stop: make(chan struct{})}
+	c.dispatchers[subscriberID] = d
+	c.dispatching.Add(1)
+	go c.dispatch(subscriberID, d)
+}
+
+// stopDispatcher stops the dispatch loop of a subscriber no topic is routed through
+func (c *WebSocketClient) stopDispatcher(subscriberID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, routed := range c.Topics {
+		if routed == subscriberID {
+			return
+		}
+	}
+	if d, exists := c.dispatchers[subscriberID]; exists {
+		close(d.stop)
+		delete(c.dispatchers, subscriberID)
+	}
+}
+
+// stopDispatching stops all of the client's dispatch loops, once
+func (c *WebSocketClient) stopDispatching() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+// dispatch delivers a subscriber's queue to the WebSocket send queue, routing each
+// event to the subscription it belongs to
+func (c *WebSocketClient) dispatch(subscriberID string, d *dispatcher) {
+	defer c.dispatching.Done()
+	defer func() {
+		c.mutex.Lock()
+		if c.dispatchers[subscriberID] == d {
+			delete(c.dispatchers, subscriberID)
+		}
+		c.mutex.Unlock()
+	}()
+
 	for {
 		select {
-		case message, ok := <-messageChan:
+		case message, ok := <-d.messages:
 			if !ok {
-				// Channel closed, stop forwarding
+				// Subscriber removed, stop dispatching
 				return
 			}
+			if !c.routes(subscriberID, message) {
+				continue
+			}
 
-			// Only forward messages for the specific topic
-			if message.Topic == topicName {
-				// Send message to WebSocket client
-				select {
-				case c.SendChan <- message:
-					// Message sent successfully
-				default:
-					// Channel is full, log warning
-					c.Handler.logger.Warnf("WebSocket client %s channel full, dropping message", c.ID)
-				}
+			// Wait for room in the WebSocket queue so that backlog stays in the
+			// priority-aware subscriber queue, where overflow policy is applied
+			select {
+			case c.SendChan <- message:
+				c.recordDepth()
+			case <-d.stop:
+				return
+			case <-c.done:
+				// Keep the event for a session resuming the subscription
+				c.mutex.Lock()
+				c.unsent = append(c.unsent, message)
+				c.mutex.Unlock()
+				return
 			}
-		case <-c.stopChan:
-			// Stop forwarding
+		case <-d.stop:
+			return
+		case <-c.done:
 			return
 		}
 	}
 }
 
+// routes reports whether a message read from a subscriber's queue is delivered: events
+// must belong to a topic the connection routes through that subscriber and conform to
+// the subscription's schema version
+func (c *WebSocketClient) routes(subscriberID string, message *models.ServerMessage) bool {
+	// Notices without a topic, such as SLOW_CONSUMER errors, concern the whole subscriber
+	if message.Topic == "" {
+		return true
+	}
+
+	c.mutex.RLock()
+	routed, subscribed := c.Topics[message.Topic]
+	c.mutex.RUnlock()
+	if !subscribed || routed != subscriberID {
+		return false
+	}
+	return c.readable(message)
+}
+
+// readable reports whether an event conforms to the schema version its subscription reads
+func (c *WebSocketClient) readable(message *models.ServerMessage) bool {
+	if message.Message == nil {
+		return true
+	}
+
+	c.mutex.RLock()
+	version, pinned := c.schemaVersions[message.Topic]
+	c.mutex.RUnlock()
+
+	if !pinned || c.Handler.schemaService.Readable(message.Topic, version, message.Message) {
+		return true
+	}
+	c.Handler.logger.Debugf("Skipping message %s for client %s: payload does not conform to schema version %d", message.Message.ID, c.ID, version)
+	return false
+}
+
 // handleUnsubscribe handles unsubscribe messages
 func (c *WebSocketClient) handleUnsubscribe(clientMessage *models.ClientMessage) {
 	if clientMessage.Topic == "" {
@@ -322,34 +758,80 @@ func (c *WebSocketClient) handleUnsubscribe(clientMessage *models.ClientMessage)
 
 	// Remove topic from client's topic list
 	c.mutex.Lock()
+	_, wasSubscribed := c.Topics[clientMessage.Topic]
 	delete(c.Topics, clientMessage.Topic)
+	delete(c.schemaVersions, clientMessage.Topic)
 	c.mutex.Unlock()
 
-	// Stop message forwarding for this topic
-	close(c.stopChan)
-	c.stopChan = make(chan struct{}) // Create new stop channel for future subscriptions
+	if wasSubscribed {
+		c.Handler.quotaService.ReleaseSubscription(c.publisher.QuotaKey)
+	}
+
+	// Stop dispatching the subscriber's queue once no other topic is routed through it
+	c.stopDispatcher(subscriberID)
 
 	// Send acknowledgment
 	c.sendAcknowledgment(clientMessage.Topic, "ok", clientMessage.RequestID)
 }
 
+// handleCredit handles credit messages granting event credits to a credit-mode subscription
+func (c *WebSocketClient) handleCredit(clientMessage *models.ClientMessage) {
+	if clientMessage.Topic == "" {
+		c.sendErrorMessage("Missing topic", "BAD_REQUEST", "Topic is required for credit", clientMessage.RequestID)
+		return
+	}
+
+	if clientMessage.Credits <= 0 {
+		c.sendErrorMessage("Invalid credits", "BAD_REQUEST", "Credits must be positive", clientMessage.RequestID)
+		return
+	}
+
+	// Use provided client ID or fall back to generated WebSocket client ID
+	subscriberID := clientMessage.ClientID
+	if subscriberID == "" {
+		subscriberID = c.ID
+	}
+
+	err := c.Handler.pubsub.GrantCredits(subscriberID, clientMessage.Topic, clientMessage.Credits)
+	if err != nil {
+		errorCode := "INTERNAL"
+		switch {
+		case models.IsErrorType(err, models.ErrTopicNotFound):
+			errorCode = "TOPIC_NOT_FOUND"
+		case models.IsErrorType(err, models.ErrSubscriberNotFound), models.IsErrorType(err, models.ErrCreditModeRequired):
+			errorCode = "BAD_REQUEST"
+		}
+		c.sendErrorMessage("Credit failed", errorCode, err.Error(), clientMessage.RequestID)
+		return
+	}
+
+	c.sendAcknowledgment(clientMessage.Topic, "ok", clientMessage.RequestID)
+}
+
 // handlePing handles ping messages
 func (c *WebSocketClient) handlePing(clientMessage *models.ClientMessage) {
-	// Send pong response
+	// Send pong response through the write pump, the connection's only writer
 	response := models.ServerMessage{
 		Type:      "pong",
 		RequestID: clientMessage.RequestID,
 		TS:        time.Now().Format(time.RFC3339),
 	}
 
-	c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	if err := c.Conn.WriteJSON(response); err != nil {
-		c.Handler.logger.Errorf("Failed to send pong to client %s: %v", c.ID, err)
+	if !c.enqueue(&response) {
+		c.Handler.logger.Warnf("Failed to send pong to client %s: channel full", c.ID)
 	}
 }
 
 // sendAcknowledgment sends an acknowledgment message to the client
 func (c *WebSocketClient) sendAcknowledgment(topic, status, requestID string) {
+	// Clients may turn acks off in hello
+	c.mutex.RLock()
+	acks := c.acks
+	c.mutex.RUnlock()
+	if !acks {
+		return
+	}
+
 	ackMessage := models.ServerMessage{
 		Type:      "ack",
 		RequestID: requestID,
@@ -358,15 +840,50 @@ func (c *WebSocketClient) sendAcknowledgment(topic, status, requestID string) {
 		TS:        time.Now().Format(time.RFC3339),
 	}
 
-	select {
-	case c.SendChan <- &ackMessage:
-		// Acknowledgment sent successfully
-	default:
+	if !c.enqueue(&ackMessage) {
 		// Channel is full, log error
 		c.Handler.logger.Warnf("Failed to send acknowledgment to client %s: channel full", c.ID)
 	}
 }
 
+// sendWelcome sends a welcome message carrying the session token and the negotiated
+// protocol version, capabilities and limits
+func (c *WebSocketClient) sendWelcome(message, requestID string) {
+	config := c.Handler.config
+
+	c.mutex.RLock()
+	version, acks := c.version, c.acks
+	c.mutex.RUnlock()
+
+	welcomeMessage := models.ServerMessage{
+		Type:      "welcome",
+		RequestID: requestID,
+		Msg:       message,
+		Session:   c.session,
+		Version:   version,
+		Capabilities: &models.Capabilities{
+			Acks:        acks,
+			Compression: c.compress.Load(),
+			Encoding:    c.codec.Name(),
+			Sessions:    c.session != "",
+			Limits: models.Limits{
+				MaxMessageSize:     config.MaxMessageSize,
+				MaxFrameSize:       config.MaxFrameSize,
+				MaxBatchSize:       config.MaxBatchSize,
+				PublishRate:        config.MaxClientPublishRate,
+				QueueSize:          c.queueSize,
+				MaxQueueSize:       config.MaxQueueSize,
+				SessionGracePeriod: config.WSSessionGracePeriod,
+			},
+		},
+		TS: time.Now().Format(time.RFC3339),
+	}
+
+	if !c.enqueue(&welcomeMessage) {
+		c.Handler.logger.Warnf("Failed to send welcome message to client %s: channel full", c.ID)
+	}
+}
+
 // sendSystemMessage sends a system message to the client
 func (c *WebSocketClient) sendSystemMessage(message, topic string) {
 	infoMessage := models.ServerMessage{
@@ -379,15 +896,30 @@ func (c *WebSocketClient) sendSystemMessage(message, topic string) {
 		infoMessage.Topic = topic
 	}
 
-	select {
-	case c.SendChan <- &infoMessage:
-		// System message sent successfully
-	default:
+	if !c.enqueue(&infoMessage) {
 		// Channel is full, log error
 		c.Handler.logger.Warnf("Failed to send system message to client %s: channel full", c.ID)
 	}
 }
 
+// sendSchemaViolation sends a SCHEMA_VIOLATION error listing the failing payload paths
+func (c *WebSocketClient) sendSchemaViolation(err *models.SchemaError, requestID string) {
+	errorMessage := models.ServerMessage{
+		Type:      "error",
+		RequestID: requestID,
+		Error: &models.Error{
+			Code:       "SCHEMA_VIOLATION",
+			Message:    "Payload does not match the topic schema",
+			Violations: err.Violations,
+		},
+		TS: time.Now().Format(time.RFC3339),
+	}
+
+	if !c.enqueue(&errorMessage) {
+		c.Handler.logger.Warnf("Failed to send error message to client %s: channel full", c.ID)
+	}
+}
+
 // sendErrorMessage sends an error message to the client
 func (c *WebSocketClient) sendErrorMessage(message, code, details, requestID string) {
 	errorMessage := models.ServerMessage{
@@ -400,39 +932,77 @@ func (c *WebSocketClient) sendErrorMessage(message, code, details, requestID str
 		TS: time.Now().Format(time.RFC3339),
 	}
 
-	select {
-	case c.SendChan <- &errorMessage:
-		// Error message sent successfully
-	default:
+	if !c.enqueue(&errorMessage) {
 		// Channel is full, log error
 		c.Handler.logger.Warnf("Failed to send error message to client %s: channel full", c.ID)
 	}
 }
 
-// removeClient removes a client from the handler
-func (h *WebSocketHandler) removeClient(clientID string) {
-	h.mutex.Lock()
-	client, exists := h.clients[clientID]
-	if exists {
-		topicsCount := len(client.Topics)
-		delete(h.clients, clientID)
-		h.mutex.Unlock()
+// enqueue adds a message to the client's send queue without blocking and
+// records the queue high-water mark
+func (c *WebSocketClient) enqueue(message *models.ServerMessage) bool {
+	select {
+	case c.SendChan <- message:
+		c.recordDepth()
+		return true
+	default:
+		return false
+	}
+}
 
-		// Remove all subscriptions for this client
-		for topicName, subscriberID := range client.Topics {
-			h.logger.Debugf("Removing subscription %s from topic %s", subscriberID, topicName)
-			h.pubsub.RemoveSubscriber(subscriberID)
+// recordDepth updates the send queue high-water mark after an enqueue
+func (c *WebSocketClient) recordDepth() {
+	depth := int64(len(c.SendChan))
+	for {
+		current := atomic.LoadInt64(&c.highMark)
+		if depth <= current || atomic.CompareAndSwapInt64(&c.highMark, current, depth) {
+			return
 		}
+	}
+}
 
-		h.logger.Infof("WebSocket client disconnected: client_id=%s, topics_subscribed=%d", clientID, topicsCount)
-	} else {
-		delete(h.clients, clientID)
+// queueStats returns the current state of the client's send queue
+func (c *WebSocketClient) queueStats() models.QueueStats {
+	return models.QueueStats{
+		Capacity:      cap(c.SendChan),
+		Depth:         len(c.SendChan),
+		HighWaterMark: int(atomic.LoadInt64(&c.highMark)),
+	}
+}
+
+// removeClient removes a client from the handler. The subscriptions of a client with
+// a session are kept for the grace period instead, so that the session can be resumed.
+func (h *WebSocketHandler) removeClient(client *WebSocketClient) {
+	h.mutex.Lock()
+	if h.clients[client.ID] != client {
+		// A resuming connection took over the client's session
+		h.mutex.Unlock()
+		return
+	}
+	delete(h.clients, client.ID)
+	if client.session != "" && !h.closing {
+		h.parkClient(client)
 		h.mutex.Unlock()
-		// Remove client from pub-sub system as fallback
-		h.pubsub.RemoveSubscriber(clientID)
+		return
+	}
+	h.mutex.Unlock()
+
+	client.stopDispatching()
+	topicsCount := len(client.Topics)
+
+	// Rate limits keyed by the connection itself end with it
+	if client.publisher.RateKey == client.ID {
+		h.messageService.ForgetClient(client.publisher.RateKey)
+	}
+	h.quotaService.ReleaseConnection(client.publisher.QuotaKey, topicsCount)
 
-		h.logger.Infof("WebSocket client disconnected: client_id=%s, topics_subscribed=0", clientID)
+	// Remove all subscriptions for this client
+	for topicName, subscriberID := range client.Topics {
+		h.logger.Debugf("Removing subscription %s from topic %s", subscriberID, topicName)
+		h.pubsub.RemoveSubscriber(subscriberID)
 	}
+
+	h.logger.Infof("WebSocket client disconnected: client_id=%s, topics_subscribed=%d", client.ID, topicsCount)
 }
 
 // GetActiveClients returns details of all active WebSocket clients
@@ -440,28 +1010,68 @@ func (h *WebSocketHandler) GetActiveClients() []models.ClientInfo {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
-	clients := make([]models.ClientInfo, 0, len(h.clients))
+	clients := make([]models.ClientInfo, 0, len(h.clients)+len(h.sessions))
 	for _, client := range h.clients {
 		client.mutex.RLock()
-		topics := make([]string, 0, len(client.Topics))
-		for topicName := range client.Topics {
-			topics = append(topics, topicName)
-		}
+		topics, subscriberQueues := h.subscriptionInfo(client.Topics)
+		name := client.name
 		client.mutex.RUnlock()
 
 		clientInfo := models.ClientInfo{
-			ID:          client.ID,
-			RemoteAddr:  client.Conn.RemoteAddr().String(),
-			Topics:      topics,
-			ConnectedAt: client.ConnectedAt,
-			IsConnected: true,
+			ID:               client.ID,
+			Protocol:         client.protocol(),
+			RemoteAddr:       client.Conn.RemoteAddr().String(),
+			Topics:           topics,
+			ConnectedAt:      client.ConnectedAt,
+			IsConnected:      true,
+			SendQueue:        client.queueStats(),
+			SubscriberQueues: subscriberQueues,
+			Name:             name,
 		}
 		clients = append(clients, clientInfo)
 	}
 
+	// Sessions awaiting resumption are listed as disconnected clients
+	for _, session := range h.sessions {
+		topics, subscriberQueues := h.subscriptionInfo(session.topics)
+		clients = append(clients, models.ClientInfo{
+			ID:               session.clientID,
+			Protocol:         "websocket",
+			RemoteAddr:       session.remoteAddr,
+			Topics:           topics,
+			ConnectedAt:      session.connectedAt,
+			SubscriberQueues: subscriberQueues,
+		})
+	}
+
 	return clients
 }
 
+// subscriptionInfo returns the topics of a client's subscriptions and the queue state of
+// their subscribers
+func (h *WebSocketHandler) subscriptionInfo(subscriptions map[string]string) ([]string, map[string]models.QueueStats) {
+	topics := make([]string, 0, len(subscriptions))
+	subscriberQueues := make(map[string]models.QueueStats)
+	for topicName, subscriberID := range subscriptions {
+		topics = append(topics, topicName)
+		if _, seen := subscriberQueues[subscriberID]; seen {
+			continue
+		}
+		if subscriber := h.pubsub.GetSubscriber(subscriberID); subscriber != nil {
+			subscriberQueues[subscriberID] = subscriber.QueueStats()
+		}
+	}
+	return topics, subscriberQueues
+}
+
+// protocol returns the protocol reported for the client in /clients
+func (c *WebSocketClient) protocol() string {
+	if c.stomp != nil {
+		return "stomp"
+	}
+	return "websocket"
+}
+
 // generateClientID generates a unique client identifier
 func generateClientID() string {
 	return utils.GenerateClientID()
@@ -471,18 +1081,29 @@ func generateClientID() string {
 func (h *WebSocketHandler) Shutdown(ctx context.Context) {
 	h.logger.Info("Shutting down WebSocket handler...")
 
-	// Get all clients and close their connections
-	h.mutex.RLock()
+	// Get all clients and close their connections. Sessions are no longer kept.
+	h.mutex.Lock()
+	h.closing = true
 	clients := make([]*WebSocketClient, 0, len(h.clients))
 	for _, client := range h.clients {
 		clients = append(clients, client)
 	}
-	h.mutex.RUnlock()
+	sessions := make([]*wsSession, 0, len(h.sessions))
+	for token, session := range h.sessions {
+		session.expiry.Stop()
+		delete(h.sessions, token)
+		sessions = append(sessions, session)
+	}
+	h.mutex.Unlock()
+
+	for _, session := range sessions {
+		h.discardSession(session)
+	}
 
 	// Close all client connections
 	for _, client := range clients {
-		// Stop message forwarding goroutines
-		close(client.stopChan)
+		// Stop dispatch loops
+		client.stopDispatching()
 
 		// Close WebSocket connection
 		client.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down"))
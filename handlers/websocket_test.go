@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pub-sub/codec"
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"pub-sub/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fanOutConnections opens n WebSocket connections to a test server and returns the
+// server-side clients. The remote ends discard everything they receive.
+func fanOutConnections(b *testing.B, n int) []*WebSocketClient {
+	b.Helper()
+
+	upgrader := websocket.Upgrader{}
+	serverConns := make(chan *websocket.Conn, n)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		serverConns <- conn
+	}))
+	b.Cleanup(server.Close)
+
+	handler := &WebSocketHandler{
+		config:      &config.Config{CompressionThreshold: 1024},
+		compression: metrics.NewCompression(),
+	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	clients := make([]*WebSocketClient, 0, n)
+	for i := 0; i < n; i++ {
+		remote, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		go func() {
+			for {
+				if _, _, err := remote.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		b.Cleanup(func() { remote.Close() })
+
+		conn := <-serverConns
+		b.Cleanup(func() { conn.Close() })
+		clients = append(clients, &WebSocketClient{Conn: conn, Handler: handler, codec: codec.Default})
+	}
+	return clients
+}
+
+// BenchmarkFanOut compares encoding an event per subscriber with encoding it once
+// and sharing the prepared frame across all subscriber connections
+func BenchmarkFanOut(b *testing.B) {
+	const subscribers = 100
+	clients := fanOutConnections(b, subscribers)
+
+	newEvent := func(frames *models.EncodedFrames) *models.ServerMessage {
+		return &models.ServerMessage{
+			Type:  "event",
+			Topic: "orders",
+			Message: &models.Message{
+				ID:      "550e8400-e29b-41d4-a716-446655440000",
+				Payload: map[string]interface{}{"order_id": "ORD-123", "amount": 99.5, "currency": "USD"},
+			},
+			TS:     time.Now().Format(time.RFC3339),
+			Frames: frames,
+		}
+	}
+
+	b.Run("per_subscriber", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, client := range clients {
+				if err := client.writeServerMessage(newEvent(nil)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("shared_frame", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			event := newEvent(&models.EncodedFrames{})
+			for _, client := range clients {
+				if err := client.writeServerMessage(event); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// readServerMessage reads the next JSON message from a test WebSocket connection
+func readServerMessage(t *testing.T, conn *websocket.Conn) *models.ServerMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message models.ServerMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return &message
+}
+
+// newTestWebSocketServer serves a WebSocket handler backed by a fresh pub-sub system
+// and returns the handler, the pub-sub system and the WebSocket URL
+func newTestWebSocketServer(t *testing.T, gracePeriod int) (*WebSocketHandler, *pubsub.PubSub, string) {
+	t.Helper()
+	cfg := &config.Config{
+		MaxMessagesPerTopic:  100,
+		MaxPublishRate:       1000,
+		MaxClientPublishRate: 1000,
+		MaxBatchSize:         10,
+		MaxMessageSize:       1024,
+		MaxFrameSize:         4096,
+		DefaultQueueSize:     100,
+		MaxQueueSize:         100,
+		WSSessionGracePeriod: gracePeriod,
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	rejections := metrics.NewRejections()
+	schemas := services.NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	quotas := services.NewQuotaService(ps, cfg, log)
+	messages := services.NewMessageService(ps, quotas, schemas, rejections, cfg, log)
+	handler := NewWebSocketHandler(ps, messages, quotas, schemas, metrics.NewCompression(), rejections, cfg, log)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.HandleWebSocket))
+	t.Cleanup(server.Close)
+	return handler, ps, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestWebSocketMultipleSubscriptions(t *testing.T) {
+	_, ps, url := newTestWebSocketServer(t, 0)
+	for _, topic := range []string{"orders", "payments"} {
+		if err := ps.CreateTopic(topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	readServerMessage(t, conn)
+
+	request := func(message models.ClientMessage) {
+		t.Helper()
+		conn.WriteJSON(message)
+		if ack := readServerMessage(t, conn); ack.Type != "ack" || ack.RequestID != message.RequestID {
+			t.Fatalf("Expected ack for %s, got %+v", message.RequestID, ack)
+		}
+	}
+	publish := func(n int, topics ...string) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			for _, topic := range topics {
+				if err := ps.PublishMessage(topic, &models.Message{ID: fmt.Sprintf("%s-%d", topic, i), Payload: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	// receive reads n events, returning their IDs by topic
+	receive := func(n int) map[string][]string {
+		t.Helper()
+		events := make(map[string][]string)
+		for i := 0; i < n; i++ {
+			message := readServerMessage(t, conn)
+			if message.Type != "event" {
+				t.Fatalf("Expected an event, got %+v", message)
+			}
+			events[message.Topic] = append(events[message.Topic], message.Message.ID)
+		}
+		return events
+	}
+	expectEvents := func(events map[string][]string, n int, topics ...string) {
+		t.Helper()
+		if len(events) != len(topics) {
+			t.Errorf("Expected events for %v, got %v", topics, events)
+		}
+		for _, topic := range topics {
+			if len(events[topic]) != n {
+				t.Fatalf("Expected %d %s events, got %v", n, topic, events[topic])
+			}
+			for i, id := range events[topic] {
+				if id != fmt.Sprintf("%s-%d", topic, i) {
+					t.Errorf("Expected %s events in publish order, got %v", topic, events[topic])
+					break
+				}
+			}
+		}
+	}
+
+	// Both subscriptions share the connection's subscriber queue and get every event
+	request(models.ClientMessage{Type: "subscribe", Topic: "orders", RequestID: "s-1"})
+	request(models.ClientMessage{Type: "subscribe", Topic: "payments", RequestID: "s-2"})
+	publish(20, "orders", "payments")
+	expectEvents(receive(40), 20, "orders", "payments")
+
+	// Unsubscribing from one topic leaves delivery of the other intact. Payments are
+	// published first, so a leaked one would be read before the last order.
+	request(models.ClientMessage{Type: "unsubscribe", Topic: "payments", RequestID: "u-1"})
+	publish(5, "payments", "orders")
+	expectEvents(receive(5), 5, "orders")
+
+	// Subscriptions under another subscriber ID are delivered alongside
+	request(models.ClientMessage{Type: "subscribe", Topic: "payments", ClientID: "billing", RequestID: "s-3"})
+	publish(5, "orders", "payments")
+	expectEvents(receive(10), 5, "orders", "payments")
+}
+
+func TestWebSocketHello(t *testing.T) {
+	handler, ps, url := newTestWebSocketServer(t, 30)
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// The welcome message describes the connection before any hello
+	welcome := readServerMessage(t, conn)
+	if welcome.Type != "welcome" || welcome.Version != protocolVersion || welcome.Capabilities == nil {
+		t.Fatalf("Expected a welcome message, got %+v", welcome)
+	}
+	capabilities := welcome.Capabilities
+	if !capabilities.Acks || capabilities.Encoding != "json" || !capabilities.Sessions ||
+		capabilities.Limits.MaxMessageSize != 1024 || capabilities.Limits.QueueSize != 100 || capabilities.Limits.SessionGracePeriod != 30 {
+		t.Errorf("Unexpected capabilities: %+v", capabilities)
+	}
+
+	// Unsupported versions are rejected
+	conn.WriteJSON(models.ClientMessage{Type: "hello", Version: -1, RequestID: "h-0"})
+	if rejected := readServerMessage(t, conn); rejected.Type != "error" || rejected.Error.Code != "UNSUPPORTED_VERSION" {
+		t.Fatalf("Expected UNSUPPORTED_VERSION, got %+v", rejected)
+	}
+
+	// Newer clients are answered with the server's version; compression cannot be turned
+	// on when it was not negotiated on connect
+	acks, compression := false, true
+	conn.WriteJSON(models.ClientMessage{
+		Type:       "hello",
+		Version:    protocolVersion + 1,
+		ClientName: "orders-service/1.0",
+		Features:   &models.Features{Acks: &acks, Compression: &compression, Encoding: "msgpack"},
+		RequestID:  "h-1",
+	})
+	reply := readServerMessage(t, conn)
+	if reply.Type != "welcome" || reply.RequestID != "h-1" || reply.Version != protocolVersion || reply.Session != welcome.Session {
+		t.Fatalf("Expected a welcome reply to hello, got %+v", reply)
+	}
+	if reply.Capabilities.Acks || reply.Capabilities.Compression || reply.Capabilities.Encoding != "json" {
+		t.Errorf("Unexpected negotiated capabilities: %+v", reply.Capabilities)
+	}
+	if clients := handler.GetActiveClients(); len(clients) != 1 || clients[0].Name != "orders-service/1.0" {
+		t.Errorf("Expected the client name in /clients, got %+v", clients)
+	}
+
+	// Without acks the first message after subscribing is the event
+	conn.WriteJSON(models.ClientMessage{Type: "subscribe", Topic: "orders", RequestID: "s-1"})
+	conn.WriteJSON(models.ClientMessage{Type: "publish", Topic: "orders", Message: &models.Message{ID: "m-1", Payload: "one"}, RequestID: "p-1"})
+	if event := readServerMessage(t, conn); event.Type != "event" || event.Message.ID != "m-1" {
+		t.Errorf("Expected the event without acks, got %+v", event)
+	}
+}
+
+func TestWebSocketSessionResume(t *testing.T) {
+	handler, ps, url := newTestWebSocketServer(t, 30)
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	welcome := readServerMessage(t, conn)
+	if welcome.Type != "welcome" || welcome.Session == "" {
+		t.Fatalf("Expected a welcome message with a session token, got %+v", welcome)
+	}
+	conn.WriteJSON(models.ClientMessage{Type: "subscribe", Topic: "orders", RequestID: "s-1"})
+	if ack := readServerMessage(t, conn); ack.Type != "ack" || ack.RequestID != "s-1" {
+		t.Fatalf("Expected subscribe ack, got %+v", ack)
+	}
+
+	// Messages published while the client is away are kept for the session
+	conn.Close()
+	waitForSession := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			handler.mutex.RLock()
+			_, parked := handler.sessions[welcome.Session]
+			handler.mutex.RUnlock()
+			if parked {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for the session to be kept")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitForSession()
+	for _, id := range []string{"m-1", "m-2"} {
+		if err := ps.PublishMessage("orders", &models.Message{ID: id, Payload: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clients := handler.GetActiveClients()
+	if len(clients) != 1 || clients[0].IsConnected {
+		t.Fatalf("Expected the session to be listed as a disconnected client, got %+v", clients)
+	}
+	clientID := clients[0].ID
+
+	resumed, _, err := websocket.DefaultDialer.Dial(url+"?session="+welcome.Session, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer resumed.Close()
+	if info := readServerMessage(t, resumed); info.Msg != "Session resumed" || info.Session != welcome.Session {
+		t.Fatalf("Expected the session to be resumed, got %+v", info)
+	}
+	for _, id := range []string{"m-1", "m-2"} {
+		if event := readServerMessage(t, resumed); event.Type != "event" || event.Message.ID != id {
+			t.Fatalf("Expected missed event %s, got %+v", id, event)
+		}
+	}
+
+	// The resumed connection keeps the client ID, so its subscriptions stay addressable
+	if clients := handler.GetActiveClients(); len(clients) != 1 || clients[0].ID != clientID || !clients[0].IsConnected {
+		t.Errorf("Expected client %s to be connected again, got %+v", clientID, clients)
+	}
+
+	// A session ends when its grace period does
+	resumed.Close()
+	waitForSession()
+	handler.mutex.RLock()
+	session := handler.sessions[welcome.Session]
+	handler.mutex.RUnlock()
+	handler.expireSession(session)
+	if stats, _ := ps.GetTopicStats("orders"); stats.Subscribers != 0 {
+		t.Errorf("Expected the expired session's subscription to be removed, got %d subscribers", stats.Subscribers)
+	}
+
+	expired, _, err := websocket.DefaultDialer.Dial(url+"?session="+welcome.Session, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer expired.Close()
+	if info := readServerMessage(t, expired); info.Session == "" || info.Session == welcome.Session {
+		t.Errorf("Expected a new session, got %+v", info)
+	}
+	if notFound := readServerMessage(t, expired); notFound.Type != "error" || notFound.Error.Code != "SESSION_NOT_FOUND" {
+		t.Errorf("Expected SESSION_NOT_FOUND, got %+v", notFound)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"pub-sub/bench"
 	"pub-sub/config"
 	"pub-sub/logger"
 	"pub-sub/pubsub"
@@ -14,6 +15,15 @@ import (
 )
 
 func main() {
+	// Run the load generator instead of the server when requested
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := bench.Run(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Benchmark failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Load configuration
 	cfg := config.LoadConfig()
 
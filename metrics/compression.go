@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"pub-sub/models"
+	"sync/atomic"
+)
+
+// Compression collects compression effectiveness counters for WebSocket and REST traffic
+type Compression struct {
+	websocket compressionCounters
+	requests  compressionCounters
+	responses compressionCounters
+}
+
+// compressionCounters accumulates uncompressed and on-the-wire byte counts
+type compressionCounters struct {
+	messages   atomic.Int64
+	compressed atomic.Int64
+	rawBytes   atomic.Int64
+	wireBytes  atomic.Int64
+}
+
+// NewCompression creates an empty set of compression counters
+func NewCompression() *Compression {
+	return &Compression{}
+}
+
+// RecordWebSocketMessage records an outbound WebSocket data message of raw bytes
+func (c *Compression) RecordWebSocketMessage(raw int, compressed bool) {
+	c.websocket.messages.Add(1)
+	c.websocket.rawBytes.Add(int64(raw))
+	if compressed {
+		c.websocket.compressed.Add(1)
+	}
+}
+
+// RecordWebSocketWire records bytes written to WebSocket connections after the handshake,
+// including frame headers and control frames
+func (c *Compression) RecordWebSocketWire(n int) {
+	c.websocket.wireBytes.Add(int64(n))
+}
+
+// RecordRequest records a gzip-encoded REST request body
+func (c *Compression) RecordRequest(raw, wire int64) {
+	c.requests.record(raw, wire, true)
+}
+
+// RecordResponse records a REST response sent to a client that accepts gzip
+func (c *Compression) RecordResponse(raw, wire int64, compressed bool) {
+	c.responses.record(raw, wire, compressed)
+}
+
+// Snapshot returns the current counters
+func (c *Compression) Snapshot() *models.CompressionStats {
+	return &models.CompressionStats{
+		WebSocket:     c.websocket.snapshot(),
+		RESTRequests:  c.requests.snapshot(),
+		RESTResponses: c.responses.snapshot(),
+	}
+}
+
+// record adds one message to the counters
+func (c *compressionCounters) record(raw, wire int64, compressed bool) {
+	c.messages.Add(1)
+	c.rawBytes.Add(raw)
+	c.wireBytes.Add(wire)
+	if compressed {
+		c.compressed.Add(1)
+	}
+}
+
+// snapshot converts the counters to their reported form
+func (c *compressionCounters) snapshot() models.CompressionCounters {
+	counters := models.CompressionCounters{
+		Messages:   c.messages.Load(),
+		Compressed: c.compressed.Load(),
+		RawBytes:   c.rawBytes.Load(),
+		WireBytes:  c.wireBytes.Load(),
+	}
+	if counters.RawBytes > 0 {
+		counters.Ratio = float64(counters.WireBytes) / float64(counters.RawBytes)
+	}
+	return counters
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"pub-sub/models"
+	"sync/atomic"
+)
+
+// Rejections counts input rejected by size limits across all transports
+type Rejections struct {
+	messages atomic.Int64
+	frames   atomic.Int64
+}
+
+// NewRejections creates an empty set of rejection counters
+func NewRejections() *Rejections {
+	return &Rejections{}
+}
+
+// RecordMessage records a published message over the message size limit
+func (r *Rejections) RecordMessage() {
+	r.messages.Add(1)
+}
+
+// RecordFrame records a WebSocket frame or REST request body over the frame size limit
+func (r *Rejections) RecordFrame() {
+	r.frames.Add(1)
+}
+
+// Snapshot returns the current counters
+func (r *Rejections) Snapshot() *models.RejectionStats {
+	return &models.RejectionStats{
+		MessagesTooLarge: r.messages.Load(),
+		FramesTooLarge:   r.frames.Load(),
+	}
+}
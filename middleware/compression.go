@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+)
+
+// CompressionMiddleware decodes gzip request bodies and gzips responses for clients that
+// accept it, leaving responses below the configured threshold uncompressed
+func CompressionMiddleware(cfg *config.Config, compression *metrics.Compression, log logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// WebSocket connections negotiate their own compression
+			if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Decode gzip request bodies
+			if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+				wire := &countingReader{reader: r.Body}
+				reader, err := gzip.NewReader(wire)
+				if err != nil {
+					log.Warnf("Invalid gzip request body: %v", err)
+					writeError(w, http.StatusBadRequest, "Invalid gzip request body", "INVALID_ENCODING")
+					return
+				}
+				raw := &countingReader{reader: reader}
+				r.Body = io.NopCloser(raw)
+				r.Header.Del("Content-Encoding")
+				r.ContentLength = -1
+				defer func() {
+					compression.RecordRequest(raw.count, wire.count)
+				}()
+			}
+
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, config: cfg, status: http.StatusOK}
+			w.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(gw, r)
+			if err := gw.finish(); err != nil {
+				log.Errorf("Failed to write compressed response: %v", err)
+			}
+			compression.RecordResponse(gw.rawBytes, gw.wireBytes(), gw.gzip != nil)
+		})
+	}
+}
+
+// writeError writes a JSON error response in the format used by the REST handlers
+func writeError(w http.ResponseWriter, statusCode int, message, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	errorResponse := struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Timestamp string `json:"timestamp"`
+	}{
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	errorResponse.Error.Code = code
+	errorResponse.Error.Message = message
+	json.NewEncoder(w).Encode(errorResponse)
+}
+
+// acceptsGzip reports whether the client accepts gzip-encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers a response until it reaches the compression threshold,
+// then switches to gzip; smaller responses are written uncompressed
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	config      *config.Config
+	status      int
+	wroteHeader bool
+	buffer      bytes.Buffer
+	gzip        *gzip.Writer
+	streaming   bool // Flushed before reaching the threshold; written uncompressed
+	wire        *countingWriter
+	rawBytes    int64
+}
+
+// WriteHeader records the status until the encoding is decided
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+// Write buffers data until the threshold is reached, then compresses
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	w.rawBytes += int64(len(p))
+
+	if w.gzip != nil {
+		return w.gzip.Write(p)
+	}
+	if w.streaming {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buffer.Write(p)
+	if w.buffer.Len() < w.config.CompressionThreshold {
+		return len(p), nil
+	}
+	if err := w.startGzip(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// startGzip sends the headers for a gzip response and compresses the buffered data
+func (w *gzipResponseWriter) startGzip() error {
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.wire = &countingWriter{writer: w.ResponseWriter}
+	gz, err := gzip.NewWriterLevel(w.wire, w.config.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	w.gzip = gz
+	_, err = w.gzip.Write(w.buffer.Bytes())
+	w.buffer.Reset()
+	return err
+}
+
+// Flush sends buffered data to the client. A streaming response flushed before reaching
+// the threshold, such as an event stream, continues uncompressed.
+func (w *gzipResponseWriter) Flush() {
+	if w.gzip != nil {
+		w.gzip.Flush()
+	} else if !w.streaming {
+		w.streaming = true
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish flushes the response, uncompressed if it stayed below the threshold
+func (w *gzipResponseWriter) finish() error {
+	if w.gzip != nil {
+		return w.gzip.Close()
+	}
+	if w.streaming {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buffer.Bytes())
+	return err
+}
+
+// wireBytes returns the bytes written to the client
+func (w *gzipResponseWriter) wireBytes() int64 {
+	if w.wire != nil {
+		return w.wire.count
+	}
+	return w.rawBytes
+}
+
+// countingReader counts bytes read from a reader
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+// Read reads from the underlying reader and counts the bytes
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// countingWriter counts bytes written to a writer
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+// Write writes to the underlying writer and counts the bytes
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"pub-sub/config"
+	"pub-sub/metrics"
+)
+
+// BodyLimitMiddleware caps REST request bodies at the configured frame size. Bodies that
+// declare a larger length are rejected up front; others fail with *http.MaxBytesError
+// once the limit is read past, which the handlers report as MESSAGE_TOO_LARGE. It must
+// run after CompressionMiddleware so decoded bodies are limited.
+func BodyLimitMiddleware(cfg *config.Config, rejections *metrics.Rejections) func(http.Handler) http.Handler {
+	limit := int64(cfg.MaxFrameSize)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// WebSocket frames are limited by the connection's read limit
+			if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				rejections.RecordFrame()
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", limit), "MESSAGE_TOO_LARGE")
+				return
+			}
+
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), rejections: rejections}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody records a rejection the first time a request body exceeds its limit
+type limitedBody struct {
+	io.ReadCloser
+	rejections *metrics.Rejections
+	exceeded   bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if err != nil && !b.exceeded && errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+		b.rejections.RecordFrame()
+	}
+	return n, err
+}
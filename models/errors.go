@@ -1,21 +1,121 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // Custom error types for better error handling
 var (
-	ErrTopicNotFound    = errors.New("TOPIC_NOT_FOUND")
-	ErrTopicExists      = errors.New("TOPIC_EXISTS")
-	ErrInvalidRequest   = errors.New("INVALID_REQUEST")
-	ErrMessageRequired  = errors.New("MESSAGE_REQUIRED")
-	ErrTopicRequired    = errors.New("TOPIC_REQUIRED")
-	ErrMessageIDRequired = errors.New("MESSAGE_ID_REQUIRED")
-	ErrSubscriberNotFound = errors.New("SUBSCRIBER_NOT_FOUND")
-	ErrChannelOverflow   = errors.New("CHANNEL_OVERFLOW")
-	ErrSlowConsumer      = errors.New("SLOW_CONSUMER")
+	ErrTopicNotFound         = errors.New("TOPIC_NOT_FOUND")
+	ErrTopicExists           = errors.New("TOPIC_EXISTS")
+	ErrInvalidRequest        = errors.New("INVALID_REQUEST")
+	ErrMessageRequired       = errors.New("MESSAGE_REQUIRED")
+	ErrTopicRequired         = errors.New("TOPIC_REQUIRED")
+	ErrMessageIDRequired     = errors.New("MESSAGE_ID_REQUIRED")
+	ErrSubscriberNotFound    = errors.New("SUBSCRIBER_NOT_FOUND")
+	ErrChannelOverflow       = errors.New("CHANNEL_OVERFLOW")
+	ErrSlowConsumer          = errors.New("SLOW_CONSUMER")
+	ErrBatchEmpty            = errors.New("BATCH_EMPTY")
+	ErrBatchTooLarge         = errors.New("BATCH_TOO_LARGE")
+	ErrRateLimited           = errors.New("RATE_LIMITED")
+	ErrQuotaExceeded         = errors.New("QUOTA_EXCEEDED")
+	ErrCreditModeRequired    = errors.New("CREDIT_MODE_REQUIRED")
+	ErrInvalidPriority       = errors.New("INVALID_PRIORITY")
+	ErrSchemaViolation       = errors.New("SCHEMA_VIOLATION")
+	ErrInvalidSchema         = errors.New("INVALID_SCHEMA")
+	ErrSchemaNotFound        = errors.New("SCHEMA_NOT_FOUND")
+	ErrMessageTooLarge       = errors.New("MESSAGE_TOO_LARGE")
+	ErrSchemaIncompatible    = errors.New("SCHEMA_INCOMPATIBLE")
+	ErrInvalidCompatibility  = errors.New("INVALID_COMPATIBILITY")
+	ErrSchemaVersionNotFound = errors.New("SCHEMA_VERSION_NOT_FOUND")
+	ErrInvalidCursor         = errors.New("INVALID_CURSOR")
+	ErrWebhookNotFound       = errors.New("WEBHOOK_NOT_FOUND")
+	ErrInvalidWebhook        = errors.New("INVALID_WEBHOOK")
 )
 
+// RateLimitError reports a publish rejected by rate limiting
+type RateLimitError struct {
+	Scope      string        // What was limited: topic or client
+	RetryAfter time.Duration // How long until a publish may succeed
+}
+
+// Error returns the error code
+func (e *RateLimitError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+// Is allows errors.Is(err, ErrRateLimited) to match
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
 // IsErrorType checks if an error is of a specific type
 func IsErrorType(err error, target error) bool {
 	return errors.Is(err, target)
 }
+
+// QuotaError reports an operation rejected by a client quota
+type QuotaError struct {
+	Resource   string        // Exceeded quota: connections, subscriptions, webhooks, publish_bytes or retained_bytes
+	Limit      int           // Configured limit
+	RetryAfter time.Duration // How long until the quota may allow the operation, if known
+}
+
+// Error returns the error code
+func (e *QuotaError) Error() string {
+	return ErrQuotaExceeded.Error()
+}
+
+// Is allows errors.Is(err, ErrQuotaExceeded) to match
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// MessageSizeError reports a message rejected by a size limit
+type MessageSizeError struct {
+	Size  int // Encoded message size in bytes
+	Limit int // Largest allowed size in bytes
+}
+
+// Error returns the error code
+func (e *MessageSizeError) Error() string {
+	return ErrMessageTooLarge.Error()
+}
+
+// Is allows errors.Is(err, ErrMessageTooLarge) to match
+func (e *MessageSizeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+// SchemaError reports a payload rejected by its topic schema
+type SchemaError struct {
+	Violations []SchemaViolation // Failing paths in the payload
+}
+
+// Error returns the error code
+func (e *SchemaError) Error() string {
+	return ErrSchemaViolation.Error()
+}
+
+// Is allows errors.Is(err, ErrSchemaViolation) to match
+func (e *SchemaError) Is(target error) bool {
+	return target == ErrSchemaViolation
+}
+
+// CompatibilityError reports a schema rejected by its topic's compatibility mode
+type CompatibilityError struct {
+	Compatibility string            // Compatibility mode that was checked
+	Version       int               // Existing version the schema is incompatible with
+	Issues        []SchemaViolation // Schema paths that break compatibility
+}
+
+// Error returns the error code
+func (e *CompatibilityError) Error() string {
+	return ErrSchemaIncompatible.Error()
+}
+
+// Is allows errors.Is(err, ErrSchemaIncompatible) to match
+func (e *CompatibilityError) Is(target error) bool {
+	return target == ErrSchemaIncompatible
+}
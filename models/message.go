@@ -1,22 +1,64 @@
 package models
 
 import (
+	"encoding/json"
+	"sync"
 	"time"
 )
 
 // ClientMessage represents messages sent from client to server
 type ClientMessage struct {
-	Type      string   `json:"type"`       // subscribe, unsubscribe, publish, ping
+	Type      string   `json:"type"`       // hello, subscribe, unsubscribe, publish, ping
 	Topic     string   `json:"topic"`      // required for subscribe/unsubscribe/publish
 	Message   *Message `json:"message"`    // required for publish
 	ClientID  string   `json:"client_id"`  // required for subscribe/unsubscribe
 	LastN     int      `json:"last_n"`     // optional: number of historical messages to replay
+	QueueSize int      `json:"queue_size"` // optional: requested subscriber queue size
+	Flow      string   `json:"flow"`       // optional: "credit" for credit-based flow control on subscribe
+	Credits   int      `json:"credits"`    // initial credits on subscribe, or credits granted by a credit message
 	RequestID string   `json:"request_id"` // optional: correlation id
+
+	SchemaVersion int `json:"schema_version,omitempty"` // optional: schema version the subscriber reads on subscribe
+
+	Messages []BatchPublishEntry `json:"messages,omitempty"` // required for publish_batch
+
+	Version    int       `json:"version,omitempty"`     // optional: protocol version spoken by the client on hello
+	ClientName string    `json:"client_name,omitempty"` // optional: client name reported in /clients on hello
+	Features   *Features `json:"features,omitempty"`    // optional: features requested on hello
+}
+
+// Features lists the protocol features a client requests in a hello message. Omitted
+// features keep their current setting.
+type Features struct {
+	Acks        *bool  `json:"acks,omitempty"`        // send acks for successful operations
+	Compression *bool  `json:"compression,omitempty"` // compress server messages, if negotiated on connect
+	Encoding    string `json:"encoding,omitempty"`    // wire encoding, fixed by the subprotocol on connect
+}
+
+// Capabilities describes the protocol features and limits in effect for a WebSocket
+// connection, sent in welcome messages
+type Capabilities struct {
+	Acks        bool   `json:"acks"`        // Acks are sent for successful operations
+	Compression bool   `json:"compression"` // Server messages are compressed with permessage-deflate
+	Encoding    string `json:"encoding"`    // Wire encoding: json, msgpack or cbor
+	Sessions    bool   `json:"sessions"`    // The session can be resumed after the connection drops
+	Limits      Limits `json:"limits"`      // Limits applied to the connection
+}
+
+// Limits lists the limits applied to a WebSocket connection
+type Limits struct {
+	MaxMessageSize     int `json:"max_message_size"`     // Default largest published message in bytes
+	MaxFrameSize       int `json:"max_frame_size"`       // Largest frame in bytes
+	MaxBatchSize       int `json:"max_batch_size"`       // Most messages in a publish_batch
+	PublishRate        int `json:"publish_rate"`         // Publishes per second allowed per client
+	QueueSize          int `json:"queue_size"`           // Connection send queue size
+	MaxQueueSize       int `json:"max_queue_size"`       // Largest subscription queue size
+	SessionGracePeriod int `json:"session_grace_period"` // Seconds a dropped session is kept
 }
 
 // ServerMessage represents messages sent from server to client
 type ServerMessage struct {
-	Type      string   `json:"type"`       // ack, event, error, pong, info
+	Type      string   `json:"type"`       // welcome, ack, event, error, pong, info
 	RequestID string   `json:"request_id"` // echoed if provided
 	Topic     string   `json:"topic"`      // topic name
 	Message   *Message `json:"message"`    // message data for events
@@ -24,18 +66,115 @@ type ServerMessage struct {
 	Status    string   `json:"status"`     // status for ack messages
 	Msg       string   `json:"msg"`        // info message
 	TS        string   `json:"ts"`         // server timestamp
+
+	Results []BatchPublishResult `json:"results,omitempty"` // per-message results for publish_batch acks
+	Session string               `json:"session,omitempty"` // token for resuming the session, sent in welcome messages
+
+	Version      int           `json:"version,omitempty"`      // negotiated protocol version, in welcome messages
+	Capabilities *Capabilities `json:"capabilities,omitempty"` // negotiated features and limits, in welcome messages
+
+	Frames *EncodedFrames `json:"-"` // encoded forms shared by every recipient of a fan-out message
+}
+
+// EncodedFrames caches the encoded forms of a server message delivered to many
+// recipients, keyed by wire format, so each format is encoded once per publish
+type EncodedFrames struct {
+	frames map[string]any
+	mutex  sync.Mutex
+}
+
+// Get returns the frame for a format, encoding it on first use
+func (f *EncodedFrames) Get(format string, encode func() (any, error)) (any, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if frame, exists := f.frames[format]; exists {
+		return frame, nil
+	}
+	frame, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	if f.frames == nil {
+		f.frames = make(map[string]any)
+	}
+	f.frames[format] = frame
+	return frame, nil
 }
 
 // Message represents a message published to a topic
 type Message struct {
-	ID      string      `json:"id"`      // Message identifier (UUID)
-	Payload interface{} `json:"payload"` // Message payload
+	ID       string      `json:"id"`                 // Message identifier (UUID)
+	Payload  interface{} `json:"payload"`            // Message payload
+	Priority string      `json:"priority,omitempty"` // Delivery priority: low, normal (default) or high
+
+	Headers map[string]string `json:"headers,omitempty"` // Message metadata, such as the schema version
+
+	Publisher  string `json:"-"` // Quota identity of the publishing client
+	Size       int    `json:"-"` // Encoded message size in bytes
+	BestEffort bool   `json:"-"` // Published at MQTT QoS 0; delivered to MQTT subscribers at QoS 0
+}
+
+// HeaderSchemaVersion is the message header carrying the version of the topic schema the
+// payload was validated against
+const HeaderSchemaVersion = "schema-version"
+
+// Message priorities, ordered from lowest to highest
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+
+	// PriorityLevels is the number of distinct priority levels
+	PriorityLevels = 3
+)
+
+// PriorityLevel maps a priority name to its level (0 is lowest). An empty priority is normal.
+func PriorityLevel(priority string) (int, bool) {
+	switch priority {
+	case PriorityLow:
+		return 0, true
+	case "", PriorityNormal:
+		return 1, true
+	case PriorityHigh:
+		return 2, true
+	default:
+		return 1, false
+	}
 }
 
 // Error represents error details
 type Error struct {
-	Code    string `json:"code"`    // Error code
-	Message string `json:"message"` // Error message
+	Code       string            `json:"code"`                 // Error code
+	Message    string            `json:"message"`              // Error message
+	Violations []SchemaViolation `json:"violations,omitempty"` // failing paths for SCHEMA_VIOLATION
+}
+
+// SchemaViolation describes one place where a payload does not match its topic schema
+type SchemaViolation struct {
+	Path    string `json:"path"`    // JSON pointer into the payload
+	Message string `json:"message"` // What the schema requires
+}
+
+// TopicSchema represents a registered version of a topic's JSON Schema
+type TopicSchema struct {
+	Topic     string          `json:"topic"`
+	Version   int             `json:"version"`
+	Schema    json.RawMessage `json:"schema"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SchemaVersionList lists the registered schema versions of a topic
+type SchemaVersionList struct {
+	Topic         string `json:"topic"`
+	Compatibility string `json:"compatibility"`
+	Versions      []int  `json:"versions"`
+}
+
+// SchemaCompatibility is the compatibility mode checked when registering a topic's schemas
+type SchemaCompatibility struct {
+	Topic         string `json:"topic,omitempty"`
+	Compatibility string `json:"compatibility"`
 }
 
 // Topic represents a topic in the pub-sub system
@@ -49,13 +188,38 @@ type Topic struct {
 
 // Stats represents system statistics
 type Stats struct {
-	TotalTopics       int                   `json:"total_topics"`
-	TotalMessages     int                   `json:"total_messages"`
-	TotalSubscribers  int                   `json:"total_subscribers"`
-	ActiveConnections int                   `json:"active_connections"`
-	UptimeSeconds     int                   `json:"uptime_seconds"`
-	Topics            map[string]TopicStats `json:"topics"`
-	GeneratedAt       string                `json:"generated_at"`
+	TotalTopics       int                        `json:"total_topics"`
+	TotalMessages     int                        `json:"total_messages"`
+	TotalSubscribers  int                        `json:"total_subscribers"`
+	ActiveConnections int                        `json:"active_connections"`
+	UptimeSeconds     int                        `json:"uptime_seconds"`
+	Topics            map[string]TopicStats      `json:"topics"`
+	Compression       *CompressionStats          `json:"compression,omitempty"`
+	Rejected          *RejectionStats            `json:"rejected,omitempty"`
+	Webhooks          map[string]WebhookDelivery `json:"webhooks,omitempty"` // Delivery status keyed by webhook ID
+	GeneratedAt       string                     `json:"generated_at"`
+}
+
+// RejectionStats counts input rejected by size limits
+type RejectionStats struct {
+	MessagesTooLarge int64 `json:"messages_too_large"` // Published messages over the message size limit
+	FramesTooLarge   int64 `json:"frames_too_large"`   // WebSocket frames or REST bodies over the frame size limit
+}
+
+// CompressionStats reports compression effectiveness per transport
+type CompressionStats struct {
+	WebSocket     CompressionCounters `json:"websocket"`      // Outbound WebSocket data messages
+	RESTRequests  CompressionCounters `json:"rest_requests"`  // Gzip-encoded REST request bodies
+	RESTResponses CompressionCounters `json:"rest_responses"` // REST responses to gzip-capable clients
+}
+
+// CompressionCounters compares uncompressed bytes with bytes on the wire
+type CompressionCounters struct {
+	Messages   int64   `json:"messages"`   // Messages or bodies observed
+	Compressed int64   `json:"compressed"` // Of which were compressed
+	RawBytes   int64   `json:"raw_bytes"`  // Uncompressed size
+	WireBytes  int64   `json:"wire_bytes"` // Size as transferred
+	Ratio      float64 `json:"ratio"`      // wire_bytes / raw_bytes (lower is better)
 }
 
 // TopicStats represents statistics for a specific topic
@@ -97,13 +261,71 @@ type PublishResponse struct {
 	Topic  string `json:"topic"`
 }
 
-// ClientInfo represents information about a WebSocket client
+// BatchPublishRequest represents a batch publish request
+type BatchPublishRequest struct {
+	Messages []BatchPublishEntry `json:"messages"`
+}
+
+// BatchPublishEntry represents a single message within a batch publish
+type BatchPublishEntry struct {
+	Topic   string   `json:"topic"`
+	Message *Message `json:"message"`
+}
+
+// BatchPublishResult represents the outcome of publishing one message of a batch
+type BatchPublishResult struct {
+	Index     int    `json:"index"`                // Position of the message in the batch
+	Topic     string `json:"topic"`                // Target topic
+	MessageID string `json:"message_id,omitempty"` // Message identifier, if provided
+	Status    string `json:"status"`               // published or failed
+	Error     *Error `json:"error,omitempty"`      // Failure details
+}
+
+// BatchPublishResponse represents batch publishing responses
+type BatchPublishResponse struct {
+	Status    string               `json:"status"` // published, partial or failed
+	Published int                  `json:"published"`
+	Failed    int                  `json:"failed"`
+	Results   []BatchPublishResult `json:"results"`
+}
+
+// PullRequest represents a request to read retained messages from a topic
+type PullRequest struct {
+	Cursor      int `json:"cursor"`                 // Sequence number of the last consumed message, 0 to start from the oldest
+	MaxMessages int `json:"max_messages,omitempty"` // Most messages to return, capped by the server
+	WaitMs      int `json:"wait_ms,omitempty"`      // How long to wait for a message when none is available
+}
+
+// PullResponse represents a page of messages read from a topic
+type PullResponse struct {
+	Topic      string     `json:"topic"`
+	Messages   []*Message `json:"messages"`
+	NextCursor int        `json:"next_cursor"`       // Cursor to send with the next pull
+	Skipped    int        `json:"skipped,omitempty"` // Messages evicted before they could be read
+	More       bool       `json:"more"`              // Whether more messages are available right away
+}
+
+// ClientInfo represents information about a WebSocket, STOMP, MQTT or Redis client
 type ClientInfo struct {
 	ID          string    `json:"id"`           // Unique client identifier
+	Protocol    string    `json:"protocol"`     // Client protocol: websocket, stomp, mqtt or redis
 	RemoteAddr  string    `json:"remote_addr"`  // Client's remote address
 	Topics      []string  `json:"topics"`       // List of subscribed topics
 	ConnectedAt time.Time `json:"connected_at"` // When the client connected
 	IsConnected bool      `json:"is_connected"` // Current connection status
+
+	SendQueue        QueueStats            `json:"send_queue"`        // Outbound WebSocket queue (empty for MQTT clients)
+	SubscriberQueues map[string]QueueStats `json:"subscriber_queues"` // Pub-sub queues keyed by subscriber ID
+
+	Name string `json:"name,omitempty"` // Client name announced in a WebSocket hello
+}
+
+// QueueStats represents the state of a bounded message queue
+type QueueStats struct {
+	Capacity      int `json:"capacity"`        // Negotiated queue size
+	Depth         int `json:"depth"`           // Messages currently queued
+	HighWaterMark int `json:"high_water_mark"` // Largest depth observed since creation
+	Evicted       int `json:"evicted"`         // Lower-priority messages dropped to make room
 }
 
 // ClientList represents a list of WebSocket clients
@@ -112,7 +334,83 @@ type ClientList struct {
 	Total   int          `json:"total"` // Total number of clients
 }
 
-// WebSocketClientProvider interface for getting WebSocket client information
-type WebSocketClientProvider interface {
+// QuotaLimits represents the configured per-client quotas (0 means unlimited)
+type QuotaLimits struct {
+	MaxConnections        int `json:"max_connections"`
+	MaxSubscriptions      int `json:"max_subscriptions"`
+	MaxPublishBytesPerSec int `json:"max_publish_bytes_per_sec"`
+	MaxRetainedBytes      int `json:"max_retained_bytes"`
+	MaxWebhooks           int `json:"max_webhooks"`
+}
+
+// QuotaUsage represents the current quota usage of one client identity
+type QuotaUsage struct {
+	Client                string `json:"client"`                  // API key or remote IP identity
+	Connections           int    `json:"connections"`             // Open WebSocket connections
+	Subscriptions         int    `json:"subscriptions"`           // Active subscriptions
+	Webhooks              int    `json:"webhooks"`                // Registered webhooks
+	PublishBytesAvailable int    `json:"publish_bytes_available"` // Remaining publish byte budget
+	PublishedBytes        int64  `json:"published_bytes"`         // Total bytes published
+	RetainedBytes         int    `json:"retained_bytes"`          // Bytes of retained messages owned
+}
+
+// QuotaReport represents the response of the quotas endpoint
+type QuotaReport struct {
+	Limits  QuotaLimits  `json:"limits"`
+	Clients []QuotaUsage `json:"clients"`
+	Total   int          `json:"total"`
+}
+
+// WebhookRequest represents a request to register a webhook push subscription
+type WebhookRequest struct {
+	Topic   string            `json:"topic"`             // Topic whose messages are pushed
+	URL     string            `json:"url"`               // http or https endpoint receiving a POST per message
+	Headers map[string]string `json:"headers,omitempty"` // Extra request headers, such as an Authorization token
+	Secret  string            `json:"secret,omitempty"`  // Optional HMAC key signing each request
+}
+
+// Webhook represents a registered webhook push subscription. The secret and header values
+// are never returned.
+type Webhook struct {
+	ID          string          `json:"id"`
+	Topic       string          `json:"topic"`
+	URL         string          `json:"url"`
+	HeaderNames []string        `json:"header_names,omitempty"` // Names of the extra request headers
+	Signed      bool            `json:"signed"`                 // Whether requests carry an HMAC signature
+	CreatedAt   time.Time       `json:"created_at"`
+	Delivery    WebhookDelivery `json:"delivery"`
+}
+
+// WebhookDelivery reports the delivery status of a webhook
+type WebhookDelivery struct {
+	Topic               string     `json:"topic"`
+	Circuit             string     `json:"circuit"`                    // Circuit breaker state: closed, open or half_open
+	Delivered           int64      `json:"delivered"`                  // Messages the endpoint accepted
+	Failed              int64      `json:"failed"`                     // Messages dropped after their last attempt failed
+	Retries             int64      `json:"retries"`                    // Retry attempts made
+	Overruns            int64      `json:"overruns"`                   // Times delivery fell behind the topic's retained messages and skipped some
+	ConsecutiveFailures int        `json:"consecutive_failures"`       // Current run of failed messages
+	LastStatusCode      int        `json:"last_status_code,omitempty"` // HTTP status of the last attempt
+	LastError           string     `json:"last_error,omitempty"`       // Why the last attempt failed
+	LastAttemptAt       *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// WebhookList represents a list of webhooks
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Total    int       `json:"total"`
+}
+
+// WebhookEvent is the JSON body POSTed to a webhook for each message
+type WebhookEvent struct {
+	WebhookID string   `json:"webhook_id"`
+	Topic     string   `json:"topic"`
+	Message   *Message `json:"message"`
+	TS        string   `json:"ts"` // Server timestamp of the delivery
+}
+
+// ClientProvider interface for getting information about the connected clients of a protocol frontend
+type ClientProvider interface {
 	GetActiveClients() []ClientInfo
 }
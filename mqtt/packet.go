@@ -0,0 +1,534 @@
+// Package mqtt implements the MQTT 3.1.1 control packets and topic filters used by the
+// MQTT frontend. Only the packets of QoS 0 and QoS 1 flows are supported.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types
+const (
+	TypeConnect     byte = 1
+	TypeConnack     byte = 2
+	TypePublish     byte = 3
+	TypePuback      byte = 4
+	TypePubrec      byte = 5
+	TypePubrel      byte = 6
+	TypePubcomp     byte = 7
+	TypeSubscribe   byte = 8
+	TypeSuback      byte = 9
+	TypeUnsubscribe byte = 10
+	TypeUnsuback    byte = 11
+	TypePingreq     byte = 12
+	TypePingresp    byte = 13
+	TypeDisconnect  byte = 14
+)
+
+// CONNACK return codes
+const (
+	Accepted                   byte = 0
+	RefusedProtocolVersion     byte = 1
+	RefusedIdentifierRejected  byte = 2
+	RefusedServerUnavailable   byte = 3
+	RefusedBadUsernamePassword byte = 4
+	RefusedNotAuthorized       byte = 5
+)
+
+const (
+	// ProtocolLevel is the CONNECT protocol level of MQTT 3.1.1
+	ProtocolLevel byte = 4
+	// SubscribeFailure is the SUBACK return code of a rejected filter
+	SubscribeFailure byte = 0x80
+)
+
+var (
+	// ErrMalformed reports a packet that violates the MQTT 3.1.1 encoding
+	ErrMalformed = errors.New("malformed MQTT packet")
+	// ErrPacketTooLarge reports a packet whose remaining length exceeds the read limit
+	ErrPacketTooLarge = errors.New("MQTT packet too large")
+	// ErrUnsupported reports a valid packet type the frontend does not handle, such as QoS 2 flows
+	ErrUnsupported = errors.New("unsupported MQTT packet")
+)
+
+// Packet is an MQTT control packet
+type Packet interface {
+	// Encode returns the packet in wire format
+	Encode() []byte
+}
+
+// Connect is sent by a client to open a session
+type Connect struct {
+	ProtocolName  string
+	ProtocolLevel byte
+	CleanSession  bool
+	KeepAlive     uint16 // Seconds; 0 disables the keep-alive timeout
+	ClientID      string
+	Will          *Publish // Last will, published if the connection ends without DISCONNECT
+	Username      *string
+	Password      []byte
+}
+
+// Connack acknowledges a CONNECT
+type Connack struct {
+	SessionPresent bool
+	ReturnCode     byte
+}
+
+// Publish carries an application message
+type Publish struct {
+	Dup      bool
+	QoS      byte
+	Retain   bool
+	Topic    string
+	PacketID uint16 // Set for QoS 1
+	Payload  []byte
+}
+
+// Puback acknowledges a QoS 1 PUBLISH
+type Puback struct {
+	PacketID uint16
+}
+
+// Subscription is a topic filter with its requested QoS
+type Subscription struct {
+	Filter string
+	QoS    byte
+}
+
+// Subscribe requests subscriptions
+type Subscribe struct {
+	PacketID      uint16
+	Subscriptions []Subscription
+}
+
+// Suback acknowledges a SUBSCRIBE with the granted QoS, or SubscribeFailure, per filter
+type Suback struct {
+	PacketID    uint16
+	ReturnCodes []byte
+}
+
+// Unsubscribe removes subscriptions
+type Unsubscribe struct {
+	PacketID uint16
+	Filters  []string
+}
+
+// Unsuback acknowledges an UNSUBSCRIBE
+type Unsuback struct {
+	PacketID uint16
+}
+
+// Pingreq is a client keep-alive ping
+type Pingreq struct{}
+
+// Pingresp answers a PINGREQ
+type Pingresp struct{}
+
+// Disconnect closes a session cleanly, discarding the last will
+type Disconnect struct{}
+
+// ReadPacket reads one control packet, rejecting packets whose remaining length exceeds
+// maxSize bytes
+func ReadPacket(r *bufio.Reader, maxSize int) (Packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := readRemainingLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxSize {
+		return nil, ErrPacketTooLarge
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return decode(header, body)
+}
+
+// WritePacket writes a control packet
+func WritePacket(w io.Writer, packet Packet) error {
+	_, err := w.Write(packet.Encode())
+	return err
+}
+
+// readRemainingLength decodes the variable-length remaining length of the fixed header
+func readRemainingLength(r io.ByteReader) (int, error) {
+	length, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+	return 0, ErrMalformed
+}
+
+// decode parses a packet from its fixed header byte and body
+func decode(header byte, body []byte) (Packet, error) {
+	packetType, flags := header>>4, header&0x0f
+	d := &decoder{data: body}
+
+	switch packetType {
+	case TypeConnect:
+		return decodeConnect(d)
+	case TypePublish:
+		return decodePublish(d, flags)
+	case TypePuback:
+		id := d.uint16()
+		return &Puback{PacketID: id}, d.finish()
+	case TypeSubscribe:
+		if flags != 0x02 {
+			return nil, ErrMalformed
+		}
+		return decodeSubscribe(d)
+	case TypeUnsubscribe:
+		if flags != 0x02 {
+			return nil, ErrMalformed
+		}
+		return decodeUnsubscribe(d)
+	case TypeConnack:
+		acknowledgeFlags, code := d.byte(), d.byte()
+		return &Connack{SessionPresent: acknowledgeFlags&0x01 != 0, ReturnCode: code}, d.finish()
+	case TypeSuback:
+		id := d.uint16()
+		codes := d.rest()
+		return &Suback{PacketID: id, ReturnCodes: codes}, d.err
+	case TypeUnsuback:
+		id := d.uint16()
+		return &Unsuback{PacketID: id}, d.finish()
+	case TypePingreq:
+		return &Pingreq{}, d.finish()
+	case TypePingresp:
+		return &Pingresp{}, d.finish()
+	case TypeDisconnect:
+		return &Disconnect{}, d.finish()
+	case TypePubrec, TypePubrel, TypePubcomp:
+		return nil, ErrUnsupported
+	}
+	return nil, fmt.Errorf("%w: unknown packet type %d", ErrMalformed, packetType)
+}
+
+func decodeConnect(d *decoder) (Packet, error) {
+	connect := &Connect{
+		ProtocolName:  d.string(),
+		ProtocolLevel: d.byte(),
+	}
+	flags := d.byte()
+	connect.KeepAlive = d.uint16()
+	if d.err != nil || flags&0x01 != 0 {
+		return nil, ErrMalformed
+	}
+	connect.CleanSession = flags&0x02 != 0
+
+	connect.ClientID = d.string()
+	if flags&0x04 != 0 {
+		connect.Will = &Publish{
+			QoS:    (flags >> 3) & 0x03,
+			Retain: flags&0x20 != 0,
+			Topic:  d.string(),
+		}
+		connect.Will.Payload = d.bytes()
+		if connect.Will.QoS > 2 {
+			return nil, ErrMalformed
+		}
+	} else if flags&0x38 != 0 {
+		return nil, ErrMalformed
+	}
+	if flags&0x80 != 0 {
+		username := d.string()
+		connect.Username = &username
+	}
+	if flags&0x40 != 0 {
+		connect.Password = d.bytes()
+	}
+	return connect, d.finish()
+}
+
+func decodePublish(d *decoder, flags byte) (Packet, error) {
+	publish := &Publish{
+		Dup:    flags&0x08 != 0,
+		QoS:    (flags >> 1) & 0x03,
+		Retain: flags&0x01 != 0,
+		Topic:  d.string(),
+	}
+	if publish.QoS == 3 {
+		return nil, ErrMalformed
+	}
+	if publish.QoS > 0 {
+		publish.PacketID = d.uint16()
+	}
+	publish.Payload = d.rest()
+	return publish, d.err
+}
+
+func decodeSubscribe(d *decoder) (Packet, error) {
+	subscribe := &Subscribe{PacketID: d.uint16()}
+	for d.err == nil && d.remaining() > 0 {
+		filter := d.string()
+		qos := d.byte()
+		if qos > 2 {
+			return nil, ErrMalformed
+		}
+		subscribe.Subscriptions = append(subscribe.Subscriptions, Subscription{Filter: filter, QoS: qos})
+	}
+	if d.err != nil || len(subscribe.Subscriptions) == 0 {
+		return nil, ErrMalformed
+	}
+	return subscribe, nil
+}
+
+func decodeUnsubscribe(d *decoder) (Packet, error) {
+	unsubscribe := &Unsubscribe{PacketID: d.uint16()}
+	for d.err == nil && d.remaining() > 0 {
+		unsubscribe.Filters = append(unsubscribe.Filters, d.string())
+	}
+	if d.err != nil || len(unsubscribe.Filters) == 0 {
+		return nil, ErrMalformed
+	}
+	return unsubscribe, nil
+}
+
+// Encode returns the CONNECT packet in wire format
+func (p *Connect) Encode() []byte {
+	e := &encoder{}
+	e.string(p.ProtocolName)
+	e.byte(p.ProtocolLevel)
+
+	var flags byte
+	if p.CleanSession {
+		flags |= 0x02
+	}
+	if p.Will != nil {
+		flags |= 0x04 | p.Will.QoS<<3
+		if p.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if p.Password != nil {
+		flags |= 0x40
+	}
+	if p.Username != nil {
+		flags |= 0x80
+	}
+	e.byte(flags)
+	e.uint16(p.KeepAlive)
+
+	e.string(p.ClientID)
+	if p.Will != nil {
+		e.string(p.Will.Topic)
+		e.bytes(p.Will.Payload)
+	}
+	if p.Username != nil {
+		e.string(*p.Username)
+	}
+	if p.Password != nil {
+		e.bytes(p.Password)
+	}
+	return e.packet(TypeConnect<<4, nil)
+}
+
+// Encode returns the CONNACK packet in wire format
+func (p *Connack) Encode() []byte {
+	var flags byte
+	if p.SessionPresent {
+		flags = 0x01
+	}
+	return (&encoder{}).packet(TypeConnack<<4, []byte{flags, p.ReturnCode})
+}
+
+// Encode returns the PUBLISH packet in wire format
+func (p *Publish) Encode() []byte {
+	header := TypePublish<<4 | p.QoS<<1
+	if p.Dup {
+		header |= 0x08
+	}
+	if p.Retain {
+		header |= 0x01
+	}
+
+	e := &encoder{}
+	e.string(p.Topic)
+	if p.QoS > 0 {
+		e.uint16(p.PacketID)
+	}
+	e.buffer = append(e.buffer, p.Payload...)
+	return e.packet(header, nil)
+}
+
+// Encode returns the PUBACK packet in wire format
+func (p *Puback) Encode() []byte {
+	return packetWithID(TypePuback<<4, p.PacketID)
+}
+
+// Encode returns the SUBSCRIBE packet in wire format
+func (p *Subscribe) Encode() []byte {
+	e := &encoder{}
+	e.uint16(p.PacketID)
+	for _, subscription := range p.Subscriptions {
+		e.string(subscription.Filter)
+		e.byte(subscription.QoS)
+	}
+	return e.packet(TypeSubscribe<<4|0x02, nil)
+}
+
+// Encode returns the SUBACK packet in wire format
+func (p *Suback) Encode() []byte {
+	e := &encoder{}
+	e.uint16(p.PacketID)
+	e.buffer = append(e.buffer, p.ReturnCodes...)
+	return e.packet(TypeSuback<<4, nil)
+}
+
+// Encode returns the UNSUBSCRIBE packet in wire format
+func (p *Unsubscribe) Encode() []byte {
+	e := &encoder{}
+	e.uint16(p.PacketID)
+	for _, filter := range p.Filters {
+		e.string(filter)
+	}
+	return e.packet(TypeUnsubscribe<<4|0x02, nil)
+}
+
+// Encode returns the UNSUBACK packet in wire format
+func (p *Unsuback) Encode() []byte {
+	return packetWithID(TypeUnsuback<<4, p.PacketID)
+}
+
+// Encode returns the PINGREQ packet in wire format
+func (p *Pingreq) Encode() []byte {
+	return []byte{TypePingreq << 4, 0}
+}
+
+// Encode returns the PINGRESP packet in wire format
+func (p *Pingresp) Encode() []byte {
+	return []byte{TypePingresp << 4, 0}
+}
+
+// Encode returns the DISCONNECT packet in wire format
+func (p *Disconnect) Encode() []byte {
+	return []byte{TypeDisconnect << 4, 0}
+}
+
+// packetWithID encodes a packet whose body is only a packet identifier
+func packetWithID(header byte, id uint16) []byte {
+	return []byte{header, 2, byte(id >> 8), byte(id)}
+}
+
+// decoder reads the fields of a packet body, recording the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.data)
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = ErrMalformed
+		return nil
+	}
+	value := d.data[:n]
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *decoder) byte() byte {
+	if value := d.take(1); value != nil {
+		return value[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if value := d.take(2); value != nil {
+		return binary.BigEndian.Uint16(value)
+	}
+	return 0
+}
+
+func (d *decoder) bytes() []byte {
+	length := d.uint16()
+	return append([]byte(nil), d.take(int(length))...)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) rest() []byte {
+	value := d.data
+	d.data = nil
+	return value
+}
+
+// finish fails packets with trailing bytes
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = ErrMalformed
+	}
+	return d.err
+}
+
+// encoder builds a packet body
+type encoder struct {
+	buffer []byte
+}
+
+func (e *encoder) byte(value byte) {
+	e.buffer = append(e.buffer, value)
+}
+
+func (e *encoder) uint16(value uint16) {
+	e.buffer = binary.BigEndian.AppendUint16(e.buffer, value)
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.uint16(uint16(len(value)))
+	e.buffer = append(e.buffer, value...)
+}
+
+func (e *encoder) string(value string) {
+	e.bytes([]byte(value))
+}
+
+// packet prefixes the body, or the encoder's buffer if body is nil, with the fixed header
+func (e *encoder) packet(header byte, body []byte) []byte {
+	if body == nil {
+		body = e.buffer
+	}
+
+	packet := make([]byte, 0, len(body)+5)
+	packet = append(packet, header)
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
@@ -0,0 +1,88 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	username := "sensor"
+	packets := []Packet{
+		&Connect{
+			ProtocolName:  "MQTT",
+			ProtocolLevel: ProtocolLevel,
+			CleanSession:  true,
+			KeepAlive:     30,
+			ClientID:      "client-1",
+			Will:          &Publish{QoS: 1, Retain: true, Topic: "status/client-1", Payload: []byte("offline")},
+			Username:      &username,
+			Password:      []byte("secret"),
+		},
+		&Connack{SessionPresent: false, ReturnCode: RefusedNotAuthorized},
+		&Publish{QoS: 1, Retain: true, Topic: "sensors/room1/temp", PacketID: 7, Payload: []byte(`{"c":21.5}`)},
+		&Publish{Topic: "sensors/room1/temp", Payload: []byte{}},
+		&Puback{PacketID: 7},
+		&Subscribe{PacketID: 8, Subscriptions: []Subscription{{Filter: "sensors/+/temp", QoS: 1}, {Filter: "#", QoS: 0}}},
+		&Suback{PacketID: 8, ReturnCodes: []byte{1, SubscribeFailure}},
+		&Unsubscribe{PacketID: 9, Filters: []string{"sensors/+/temp"}},
+		&Unsuback{PacketID: 9},
+		&Pingreq{},
+		&Pingresp{},
+		&Disconnect{},
+	}
+
+	for _, packet := range packets {
+		decoded, err := ReadPacket(bufio.NewReader(bytes.NewReader(packet.Encode())), 1024)
+		if err != nil {
+			t.Fatalf("Failed to decode %T: %v", packet, err)
+		}
+		if !reflect.DeepEqual(decoded, packet) {
+			t.Errorf("Round trip mismatch: got %+v, want %+v", decoded, packet)
+		}
+	}
+
+	large := &Publish{Topic: "t", Payload: make([]byte, 200)}
+	if _, err := ReadPacket(bufio.NewReader(bytes.NewReader(large.Encode())), 100); !errors.Is(err, ErrPacketTooLarge) {
+		t.Errorf("Expected ErrPacketTooLarge, got %v", err)
+	}
+
+	pubrec := []byte{TypePubrec << 4, 2, 0, 1}
+	if _, err := ReadPacket(bufio.NewReader(bytes.NewReader(pubrec)), 100); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for PUBREC, got %v", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		name   string
+		match  bool
+	}{
+		{"sensors/room1/temp", "sensors/room1/temp", true},
+		{"sensors/+/temp", "sensors/room1/temp", true},
+		{"sensors/+/temp", "sensors/room1/humidity", false},
+		{"sensors/+", "sensors/room1/temp", false},
+		{"sensors/#", "sensors/room1/temp", true},
+		{"sensors/#", "sensors", true},
+		{"#", "sensors/room1/temp", true},
+		{"+/+", "/finance", true},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+
+	for _, test := range tests {
+		if got := Match(test.filter, test.name); got != test.match {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.filter, test.name, got, test.match)
+		}
+	}
+
+	for filter, valid := range map[string]bool{"a/+/b": true, "a/#": true, "a/#/b": false, "a+/b": false, "": false} {
+		if ValidFilter(filter) != valid {
+			t.Errorf("ValidFilter(%q) = %v, want %v", filter, !valid, valid)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package mqtt
+
+import "strings"
+
+// ValidTopicName reports whether name may be published to: non-empty and free of
+// wildcards and NUL characters
+func ValidTopicName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "+#\x00")
+}
+
+// ValidFilter reports whether filter is a well-formed topic filter: '+' must occupy a
+// whole level and '#' must be the whole last level
+func ValidFilter(filter string) bool {
+	if filter == "" || strings.ContainsRune(filter, 0) {
+		return false
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether a topic name matches a topic filter. Wildcards at the first
+// level do not match names starting with '$'.
+func Match(filter, name string) bool {
+	if strings.HasPrefix(name, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	nameLevels := strings.Split(name, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			// Matches the parent level and any number of child levels
+			return true
+		}
+		if i >= len(nameLevels) {
+			return false
+		}
+		if level != "+" && level != nameLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(nameLevels)
+}
@@ -0,0 +1,170 @@
+package pubsub
+
+import (
+	"pub-sub/logger"
+	"pub-sub/models"
+	"time"
+)
+
+// creditState tracks a credit-mode subscription: events are only delivered while the
+// client has granted credits, the rest stay in the topic's retained log until then
+type creditState struct {
+	topic   *Topic // Topic instance the cursor refers to
+	credits int    // Remaining event credits
+	nextSeq int    // Sequence number of the next message to deliver
+}
+
+// SubscribeOptions controls how a subscription is created
+type SubscribeOptions struct {
+	LastN      int  // Number of historical messages to replay
+	QueueSize  int  // Requested queue size, applied when the subscriber is created
+	CreditMode bool // Deliver events only against credits granted by the client
+	Credits    int  // Initial credits for credit mode
+
+	// Streams that track their position replay history oldest first, from just after the
+	// last message they saw when resuming
+	OldestFirst bool   // Replay the LastN messages oldest first instead of newest first
+	ResumeAfter string // Replay the retained messages after this message ID, oldest first
+}
+
+// GrantCredits adds event credits to a credit-mode subscription and delivers any
+// retained messages the new credits allow
+func (ps *PubSub) GrantCredits(subscriberID, topicName string, credits int) error {
+	if credits <= 0 {
+		return models.ErrInvalidRequest
+	}
+
+	topic, topicExists := ps.getTopic(topicName)
+	subscriber, subscriberExists := ps.getSubscriber(subscriberID)
+
+	if !topicExists {
+		return models.ErrTopicNotFound
+	}
+	if !subscriberExists {
+		return models.ErrSubscriberNotFound
+	}
+
+	subscriber.creditMutex.Lock()
+	state, exists := subscriber.credits[topicName]
+	if !exists || state.topic != topic {
+		subscriber.creditMutex.Unlock()
+		return models.ErrCreditModeRequired
+	}
+	state.credits += credits
+	subscriber.creditMutex.Unlock()
+
+	ps.deliverCredited(subscriber, topic)
+
+	ps.logger.WithFields(logger.Fields{
+		"subscriber_id": subscriberID,
+		"topic":         topicName,
+		"action":        "grant_credits",
+		"credits":       credits,
+	}).Debug("Credits granted")
+	return nil
+}
+
+// startCreditMode registers a credit-mode subscription and adds the subscriber to the
+// topic. The cursor starts lastN messages back in the retained log.
+func (ps *PubSub) startCreditMode(subscriber *Subscriber, topic *Topic, lastN, credits int) error {
+	subscriber.creditMutex.Lock()
+	topic.mutex.Lock()
+	if topic.deleted {
+		topic.mutex.Unlock()
+		subscriber.creditMutex.Unlock()
+		return models.ErrTopicNotFound
+	}
+	subscriber.mutex.Lock()
+	subscriber.Topics[topic.Name] = true
+	subscriber.mutex.Unlock()
+	topic.Subscribers[subscriber.ID] = subscriber
+	replay := lastN
+	if replay > topic.messages.len() {
+		replay = topic.messages.len()
+	}
+	if replay < 0 {
+		replay = 0
+	}
+	subscriber.credits[topic.Name] = &creditState{
+		topic:   topic,
+		credits: credits,
+		nextSeq: topic.MessageCount + 1 - replay,
+	}
+	topic.mutex.Unlock()
+	subscriber.creditMutex.Unlock()
+
+	ps.deliverCredited(subscriber, topic)
+	return nil
+}
+
+// stopCreditMode drops the credit state of a subscription
+func (s *Subscriber) stopCreditMode(topicName string) {
+	s.creditMutex.Lock()
+	delete(s.credits, topicName)
+	s.creditMutex.Unlock()
+}
+
+// inCreditMode reports whether the subscriber receives events from topic against credits
+func (s *Subscriber) inCreditMode(topic *Topic) bool {
+	s.creditMutex.Lock()
+	defer s.creditMutex.Unlock()
+
+	state, exists := s.credits[topic.Name]
+	return exists && state.topic == topic
+}
+
+// deliverCredited sends retained messages from the subscription cursor while credits
+// and queue space remain. Undelivered messages stay in the retained log.
+func (ps *PubSub) deliverCredited(subscriber *Subscriber, topic *Topic) {
+	subscriber.creditMutex.Lock()
+	defer subscriber.creditMutex.Unlock()
+
+	state, exists := subscriber.credits[topic.Name]
+	if !exists || state.topic != topic || state.credits <= 0 {
+		return
+	}
+
+	// Collect the messages the current credits allow
+	topic.mutex.RLock()
+	oldestSeq := topic.MessageCount - topic.messages.len() + 1
+	skipped := 0
+	if state.nextSeq < oldestSeq {
+		skipped = oldestSeq - state.nextSeq
+		state.nextSeq = oldestSeq
+	}
+	start := state.nextSeq - oldestSeq
+	pending, indices, end := topic.messages.collect(start, state.credits)
+	topic.mutex.RUnlock()
+
+	if skipped > 0 {
+		ps.logger.WithFields(logger.Fields{
+			"subscriber_id": subscriber.ID,
+			"topic":         topic.Name,
+			"action":        "credit_cursor_skipped",
+			"skipped":       skipped,
+		}).Warn("Credit-mode cursor fell behind the retained log")
+		subscriber.trySend(&models.ServerMessage{
+			Type:  "info",
+			Topic: topic.Name,
+			Msg:   "messages_skipped",
+			TS:    time.Now().Format(time.RFC3339),
+		})
+	}
+
+	for i, message := range pending {
+		serverMessage := &models.ServerMessage{
+			Type:    "event",
+			Topic:   topic.Name,
+			Message: message,
+			TS:      time.Now().Format(time.RFC3339),
+		}
+		if !subscriber.trySend(serverMessage) {
+			// Queue is full, keep the rest in the retained log
+			return
+		}
+		state.nextSeq = oldestSeq + indices[i] + 1
+		state.credits--
+	}
+	// Dropped messages after the last one delivered need no credit
+	state.nextSeq = oldestSeq + end
+}
@@ -10,211 +10,397 @@ import (
 
 // PubSub represents the main pub-sub system
 type PubSub struct {
-	topics      map[string]*Topic      // Map of topic names to Topic instances
-	subscribers map[string]*Subscriber // Map of subscriber IDs to Subscriber instances
-	config      *config.Config         // System configuration
-	mutex       sync.RWMutex           // Read-write mutex for thread safety
-	startTime   time.Time              // System start time for uptime calculation
-	logger      logger.Logger          // Logger instance
+	topicShards      []*topicShard                               // Sharded map of topic names to Topic instances
+	subscriberShards []*subscriberShard                          // Sharded map of subscriber IDs to Subscriber instances
+	config           *config.Config                              // System configuration
+	startTime        time.Time                                   // System start time for uptime calculation
+	logger           logger.Logger                               // Logger instance
+	onRelease        func(topic string, message *models.Message) // Called when a retained message is dropped
+	onTopic          []func(topic string, created bool)          // Called after a topic is created or deleted
 }
 
 // Topic represents a topic with its messages and subscribers
 type Topic struct {
 	Name          string                 // Topic name
-	Messages      []*models.Message      // Circular buffer of messages
+	messages      *messageRing           // Ring buffer of retained messages
 	Subscribers   map[string]*Subscriber // Map of subscriber IDs to Subscriber instances
 	MessageCount  int                    // Total messages published
 	CreatedAt     time.Time              // When topic was created
 	LastMessageAt time.Time              // When last message was published
 	mutex         sync.RWMutex           // Topic-level mutex for thread safety
+	deleted       bool                   // Set under mutex once the topic is removed from the registry
+	published     chan struct{}          // Closed on the next publish to wake long polls, nil without waiters
 }
 
 // Subscriber represents a WebSocket connection that can receive messages
 type Subscriber struct {
 	ID       string                     // Unique subscriber identifier
 	Topics   map[string]bool            // Set of subscribed topics
-	SendChan chan *models.ServerMessage // Channel to send messages to this subscriber
+	SendChan chan *models.ServerMessage // Channel to send messages to this subscriber, fed from queue
 	conn     interface{}                // WebSocket connection (will be set by WebSocket handler)
 	mutex    sync.RWMutex               // Subscriber-level mutex
+	queue    *deliveryQueue             // Priority-aware bounded queue behind SendChan
+	done     chan struct{}              // Closed when the subscriber is removed
+
+	credits     map[string]*creditState // Credit-mode subscriptions keyed by topic name
+	creditMutex sync.Mutex              // Protects credits; acquired before any topic lock
+}
+
+// newSubscriber creates a subscriber and starts its delivery goroutine
+func newSubscriber(id string, queueSize int) *Subscriber {
+	subscriber := &Subscriber{
+		ID:       id,
+		Topics:   make(map[string]bool),
+		SendChan: make(chan *models.ServerMessage),
+		queue:    newDeliveryQueue(queueSize),
+		done:     make(chan struct{}),
+		credits:  make(map[string]*creditState),
+	}
+	go subscriber.pump()
+	return subscriber
+}
+
+// trySend enqueues a message without blocking. A full queue evicts a lower-priority
+// message to make room; if there is none the message is rejected.
+func (s *Subscriber) trySend(message *models.ServerMessage) bool {
+	ok, _ := s.queue.push(message)
+	return ok
+}
+
+// pump moves messages from the priority queue to SendChan until the subscriber is closed
+func (s *Subscriber) pump() {
+	defer close(s.SendChan)
+
+	for {
+		message, ok := s.queue.next()
+		if !ok {
+			return
+		}
+
+		select {
+		case s.SendChan <- message:
+			s.queue.delivered()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close stops delivery and closes SendChan once the delivery goroutine exits
+func (s *Subscriber) close() {
+	close(s.done)
+	s.queue.close()
+}
+
+// QueueStats returns the current capacity, depth and high-water mark of the subscriber queue
+func (s *Subscriber) QueueStats() models.QueueStats {
+	return s.queue.stats()
 }
 
 // NewPubSub creates a new pub-sub system instance
 func NewPubSub(cfg *config.Config, log logger.Logger) *PubSub {
 	return &PubSub{
-		topics:      make(map[string]*Topic),
-		subscribers: make(map[string]*Subscriber),
-		config:      cfg,
-		startTime:   time.Now(),
-		logger:      log,
+		topicShards:      newTopicShards(),
+		subscriberShards: newSubscriberShards(),
+		config:           cfg,
+		startTime:        time.Now(),
+		logger:           log,
 	}
 }
 
+// SetReleaseHandler registers a callback invoked whenever a retained message leaves a
+// topic's buffer, either evicted by a newer message or dropped with its topic. The
+// callback runs under the topic lock and must not call back into the PubSub.
+// It must be registered before the system starts serving requests.
+func (ps *PubSub) SetReleaseHandler(handler func(topic string, message *models.Message)) {
+	ps.onRelease = handler
+}
+
+// AddTopicHandler registers a callback invoked after a topic is created or deleted,
+// outside all locks. Handlers must be registered before the system starts serving requests.
+func (ps *PubSub) AddTopicHandler(handler func(topic string, created bool)) {
+	ps.onTopic = append(ps.onTopic, handler)
+}
+
+// topicChanged runs the topic handlers
+func (ps *PubSub) topicChanged(name string, created bool) {
+	for _, handler := range ps.onTopic {
+		handler(name, created)
+	}
+}
+
+// release reports a retained message leaving a topic buffer
+func (ps *PubSub) release(topic string, message *models.Message) {
+	if ps.onRelease != nil && message != nil {
+		ps.onRelease(topic, message)
+	}
+}
+
+// DropPublished drops retained messages of a publisher, oldest first within each topic,
+// until at least size bytes have been released or none are left, and returns the bytes
+// released. Each dropped message is reported to the release handler. Readers pass over
+// dropped messages, so sequence numbers and cursors are unaffected.
+func (ps *PubSub) DropPublished(publisher string, size int) int {
+	released := 0
+	ps.forEachTopic(func(topic *Topic) {
+		if released >= size {
+			return
+		}
+		topic.mutex.Lock()
+		defer topic.mutex.Unlock()
+		for i := 0; i < topic.messages.len() && released < size; i++ {
+			if message := topic.messages.at(i); message != nil && message.Publisher == publisher {
+				topic.messages.drop(i)
+				released += message.Size
+				ps.release(topic.Name, message)
+			}
+		}
+	})
+	return released
+}
+
 // CreateTopic creates a new topic if it doesn't exist
 func (ps *PubSub) CreateTopic(name string) error {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
+	shard := ps.topicShard(name)
+	shard.mutex.Lock()
 
 	// Check if topic already exists
-	if _, exists := ps.topics[name]; exists {
+	if _, exists := shard.topics[name]; exists {
+		shard.mutex.Unlock()
 		return models.ErrTopicExists
 	}
 
 	// Create new topic with circular buffer for messages
 	topic := &Topic{
 		Name:        name,
-		Messages:    make([]*models.Message, 0, ps.config.MaxMessagesPerTopic),
+		messages:    newMessageRing(ps.config.MaxMessagesPerTopic),
 		Subscribers: make(map[string]*Subscriber),
 		CreatedAt:   time.Now(),
 	}
 
-	ps.topics[name] = topic
+	shard.topics[name] = topic
+	shard.mutex.Unlock()
+
 	ps.logger.WithFields(logger.Fields{
 		"topic":  name,
 		"action": "create",
 	}).Info("Topic created successfully")
+
+	ps.topicChanged(name, true)
 	return nil
 }
 
 // DeleteTopic deletes a topic and notifies all subscribers
 func (ps *PubSub) DeleteTopic(name string) error {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
+	// Remove the topic from the registry first so no new operations can find it
+	shard := ps.topicShard(name)
+	shard.mutex.Lock()
+	topic, exists := shard.topics[name]
+	if exists {
+		delete(shard.topics, name)
+	}
+	shard.mutex.Unlock()
 
-	topic, exists := ps.topics[name]
 	if !exists {
 		return models.ErrTopicNotFound
 	}
 
 	// Notify all subscribers that topic is being deleted
 	topic.mutex.Lock()
+	topic.deleted = true
+	subscribersAffected := len(topic.Subscribers)
 	for _, subscriber := range topic.Subscribers {
-		// Send deletion notification
-		select {
-		case subscriber.SendChan <- &models.ServerMessage{
+		// Send deletion notification, skipped if the channel is full
+		subscriber.trySend(&models.ServerMessage{
 			Type:  "info",
 			Topic: name,
 			Msg:   "topic_deleted",
 			TS:    time.Now().Format(time.RFC3339),
-		}:
-		default:
-			// Channel is full, skip
-		}
+		})
 
 		// Remove topic from subscriber's topic list
 		subscriber.mutex.Lock()
 		delete(subscriber.Topics, name)
 		subscriber.mutex.Unlock()
 	}
-	topic.mutex.Unlock()
 
-	// Remove topic from all subscribers
-	for _, subscriber := range ps.subscribers {
-		subscriber.mutex.Lock()
-		delete(subscriber.Topics, name)
-		subscriber.mutex.Unlock()
+	// Wake long polls, which then find the topic gone
+	topic.wakePullers()
+
+	// Release retained messages
+	for _, message := range topic.messages.drain() {
+		ps.release(name, message)
 	}
+	topic.mutex.Unlock()
 
-	// Delete the topic
-	delete(ps.topics, name)
 	ps.logger.WithFields(logger.Fields{
 		"topic":                name,
 		"action":               "delete",
-		"subscribers_affected": len(topic.Subscribers),
+		"subscribers_affected": subscribersAffected,
 	}).Info("Topic deleted successfully")
+
+	ps.topicChanged(name, false)
 	return nil
 }
 
 // PublishMessage publishes a message to a topic
 func (ps *PubSub) PublishMessage(topicName string, message *models.Message) error {
-	ps.mutex.RLock()
-	topic, exists := ps.topics[topicName]
-	ps.mutex.RUnlock()
-
+	topic, exists := ps.getTopic(topicName)
 	if !exists {
 		return models.ErrTopicNotFound
 	}
 
 	// Add message to topic with circular buffer logic
 	topic.mutex.Lock()
-
-	// Add new message
-	topic.Messages = append(topic.Messages, message)
-
-	// Maintain circular buffer size
-	if len(topic.Messages) > ps.config.MaxMessagesPerTopic {
-		topic.Messages = topic.Messages[1:] // Remove oldest message
+	if topic.deleted {
+		topic.mutex.Unlock()
+		return models.ErrTopicNotFound
 	}
-
-	topic.MessageCount++
-	topic.LastMessageAt = time.Now()
+	ps.release(topicName, topic.appendMessage(message))
 	topic.mutex.Unlock()
 
 	// Notify all subscribers
-	ps.notifySubscribers(topicName, message)
+	subscribersCount := ps.notifySubscribers(topic, message)
 
 	ps.logger.WithFields(logger.Fields{
 		"topic":             topicName,
 		"message_id":        message.ID,
 		"action":            "publish",
-		"subscribers_count": len(topic.Subscribers),
+		"subscribers_count": subscribersCount,
 	}).Info("Message published successfully")
 	return nil
 }
 
-// Subscribe adds a subscriber to a topic
-func (ps *PubSub) Subscribe(subscriberID, topicName string, lastN int) error {
-	ps.mutex.RLock()
-	topic, exists := ps.topics[topicName]
-	ps.mutex.RUnlock()
-
+// PublishMessages publishes several messages to a topic in order, acquiring the
+// topic lock once for the whole batch
+func (ps *PubSub) PublishMessages(topicName string, messages []*models.Message) error {
+	topic, exists := ps.getTopic(topicName)
 	if !exists {
 		return models.ErrTopicNotFound
 	}
 
-	// Get or create subscriber
-	ps.mutex.Lock()
-	subscriber, exists := ps.subscribers[subscriberID]
-	if !exists {
-		subscriber = &Subscriber{
-			ID:       subscriberID,
-			Topics:   make(map[string]bool),
-			SendChan: make(chan *models.ServerMessage, 100), // Buffer for messages
-		}
-		ps.subscribers[subscriberID] = subscriber
+	topic.mutex.Lock()
+	if topic.deleted {
+		topic.mutex.Unlock()
+		return models.ErrTopicNotFound
+	}
+	for _, message := range messages {
+		ps.release(topicName, topic.appendMessage(message))
 	}
-	ps.mutex.Unlock()
+	topic.mutex.Unlock()
+
+	// Notify subscribers in publish order
+	subscribersCount := 0
+	for _, message := range messages {
+		subscribersCount = ps.notifySubscribers(topic, message)
+	}
+
+	ps.logger.WithFields(logger.Fields{
+		"topic":             topicName,
+		"action":            "publish_batch",
+		"messages_count":    len(messages),
+		"subscribers_count": subscribersCount,
+	}).Info("Message batch published successfully")
+	return nil
+}
+
+// appendMessage adds a message to the topic's ring buffer and returns the evicted
+// message, if any. Caller must hold the topic lock.
+func (t *Topic) appendMessage(message *models.Message) *models.Message {
+	evicted := t.messages.push(message)
+
+	t.MessageCount++
+	t.LastMessageAt = time.Now()
+	t.wakePullers()
+	return evicted
+}
+
+// addSubscriber links a subscriber and the topic, failing if the topic has been deleted
+func (t *Topic) addSubscriber(subscriber *Subscriber) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.deleted {
+		return models.ErrTopicNotFound
+	}
+	t.Subscribers[subscriber.ID] = subscriber
 
-	// Add topic to subscriber
 	subscriber.mutex.Lock()
-	subscriber.Topics[topicName] = true
+	subscriber.Topics[t.Name] = true
 	subscriber.mutex.Unlock()
+	return nil
+}
 
-	// Add subscriber to topic
-	topic.mutex.Lock()
-	topic.Subscribers[subscriberID] = subscriber
-	topic.mutex.Unlock()
+// subscriberCount returns the number of subscribers of the topic
+func (t *Topic) subscriberCount() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.Subscribers)
+}
 
-	// Send historical messages if requested
-	if lastN > 0 {
-		ps.sendHistoricalMessages(subscriber, topic, lastN)
+// Subscribe adds a subscriber to a topic using the default queue size
+func (ps *PubSub) Subscribe(subscriberID, topicName string, lastN int) error {
+	return ps.SubscribeWithOptions(subscriberID, topicName, SubscribeOptions{LastN: lastN})
+}
+
+// SubscribeWithOptions adds a subscriber to a topic. The queue size only applies when
+// the subscriber is first created and is bounded by the configured maximum.
+func (ps *PubSub) SubscribeWithOptions(subscriberID, topicName string, opts SubscribeOptions) error {
+	topic, exists := ps.getTopic(topicName)
+	if !exists {
+		return models.ErrTopicNotFound
+	}
+
+	// Get or create subscriber, removing it again if it was created for a failed subscription
+	subscriber, created := ps.getOrCreateSubscriber(subscriberID, ps.config.QueueSize(opts.QueueSize))
+	if err := ps.addSubscription(subscriber, topic, opts); err != nil {
+		if created {
+			ps.discardSubscriber(subscriber)
+		}
+		return err
 	}
 
 	ps.logger.WithFields(logger.Fields{
 		"subscriber_id":       subscriberID,
 		"topic":               topicName,
 		"action":              "subscribe",
-		"historical_messages": lastN,
-		"total_subscribers":   len(topic.Subscribers),
+		"historical_messages": opts.LastN,
+		"credit_mode":         opts.CreditMode,
+		"queue_size":          subscriber.queue.capacity,
+		"total_subscribers":   topic.subscriberCount(),
 	}).Info("Subscriber subscribed successfully")
 	return nil
 }
 
+// addSubscription subscribes a subscriber to a topic, failing if the topic has been
+// deleted since it was looked up
+func (ps *PubSub) addSubscription(subscriber *Subscriber, topic *Topic, opts SubscribeOptions) error {
+	if opts.CreditMode {
+		// Credit mode replays history through the credit cursor
+		return ps.startCreditMode(subscriber, topic, opts.LastN, opts.Credits)
+	}
+	subscriber.stopCreditMode(topic.Name)
+
+	if opts.OldestFirst || opts.ResumeAfter != "" {
+		// Replay in publish order, queued before any live message
+		return ps.addSubscriberWithReplay(subscriber, topic, opts)
+	}
+
+	// Add subscriber to topic, unless it was deleted since the lookup
+	if err := topic.addSubscriber(subscriber); err != nil {
+		return err
+	}
+
+	// Send historical messages if requested
+	if opts.LastN > 0 {
+		ps.sendHistoricalMessages(subscriber, topic, opts.LastN)
+	}
+	return nil
+}
+
 // Unsubscribe removes a subscriber from a topic
 func (ps *PubSub) Unsubscribe(subscriberID, topicName string) error {
-	ps.mutex.RLock()
-	topic, exists := ps.topics[topicName]
-	ps.mutex.RUnlock()
-
+	topic, exists := ps.getTopic(topicName)
 	if !exists {
 		return models.ErrTopicNotFound
 	}
@@ -222,53 +408,44 @@ func (ps *PubSub) Unsubscribe(subscriberID, topicName string) error {
 	// Remove subscriber from topic
 	topic.mutex.Lock()
 	delete(topic.Subscribers, subscriberID)
+	remainingSubscribers := len(topic.Subscribers)
 	topic.mutex.Unlock()
 
 	// Remove topic from subscriber
-	ps.mutex.RLock()
-	subscriber, exists := ps.subscribers[subscriberID]
-	ps.mutex.RUnlock()
-
-	if exists {
+	if subscriber, exists := ps.getSubscriber(subscriberID); exists {
 		subscriber.mutex.Lock()
 		delete(subscriber.Topics, topicName)
 		subscriber.mutex.Unlock()
+		subscriber.stopCreditMode(topicName)
 	}
 
 	ps.logger.WithFields(logger.Fields{
 		"subscriber_id":         subscriberID,
 		"topic":                 topicName,
 		"action":                "unsubscribe",
-		"remaining_subscribers": len(topic.Subscribers),
+		"remaining_subscribers": remainingSubscribers,
 	}).Info("Subscriber unsubscribed successfully")
 	return nil
 }
 
 // GetTopics returns a list of all topics
 func (ps *PubSub) GetTopics() []models.TopicInfo {
-	ps.mutex.RLock()
-	defer ps.mutex.RUnlock()
-
-	topics := make([]models.TopicInfo, 0, len(ps.topics))
-	for _, topic := range ps.topics {
+	topics := make([]models.TopicInfo, 0)
+	ps.forEachTopic(func(topic *Topic) {
 		topic.mutex.RLock()
 		topics = append(topics, models.TopicInfo{
 			Name:        topic.Name,
 			Subscribers: len(topic.Subscribers),
 		})
 		topic.mutex.RUnlock()
-	}
+	})
 
 	return topics
 }
 
 // GetStats returns system statistics
 func (ps *PubSub) GetStats() models.Stats {
-	ps.mutex.RLock()
-	defer ps.mutex.RUnlock()
-
 	stats := models.Stats{
-		TotalTopics:   len(ps.topics),
 		Topics:        make(map[string]models.TopicStats),
 		UptimeSeconds: int(time.Since(ps.startTime).Seconds()),
 		GeneratedAt:   time.Now().Format(time.RFC3339),
@@ -278,7 +455,7 @@ func (ps *PubSub) GetStats() models.Stats {
 	totalMessages := 0
 	totalSubscribers := 0
 
-	for topicName, topic := range ps.topics {
+	ps.forEachTopic(func(topic *Topic) {
 		topic.mutex.RLock()
 
 		// Create topic stats
@@ -290,15 +467,16 @@ func (ps *PubSub) GetStats() models.Stats {
 			LastMessageAt: topic.LastMessageAt,
 		}
 
-		stats.Topics[topicName] = topicStats
+		stats.Topics[topic.Name] = topicStats
 
 		// Accumulate totals
 		totalMessages += topic.MessageCount
 		totalSubscribers += len(topic.Subscribers)
 
 		topic.mutex.RUnlock()
-	}
+	})
 
+	stats.TotalTopics = len(stats.Topics)
 	stats.TotalMessages = totalMessages
 	stats.TotalSubscribers = totalSubscribers
 	// ActiveConnections will be set by the system service using WebSocket client count
@@ -307,12 +485,15 @@ func (ps *PubSub) GetStats() models.Stats {
 	return stats
 }
 
+// HasTopic reports whether a topic exists
+func (ps *PubSub) HasTopic(topicName string) bool {
+	_, exists := ps.getTopic(topicName)
+	return exists
+}
+
 // GetTopicStats returns statistics for a specific topic
 func (ps *PubSub) GetTopicStats(topicName string) (*models.TopicStats, error) {
-	ps.mutex.RLock()
-	defer ps.mutex.RUnlock()
-
-	topic, exists := ps.topics[topicName]
+	topic, exists := ps.getTopic(topicName)
 	if !exists {
 		return nil, models.ErrTopicNotFound
 	}
@@ -333,29 +514,31 @@ func (ps *PubSub) GetTopicStats(topicName string) (*models.TopicStats, error) {
 
 // GetHealth returns system health status
 func (ps *PubSub) GetHealth() models.Health {
-	ps.mutex.RLock()
-	defer ps.mutex.RUnlock()
-
 	totalSubscribers := 0
-	for _, subscriber := range ps.subscribers {
+	ps.forEachSubscriber(func(subscriber *Subscriber) {
 		subscriber.mutex.RLock()
 		totalSubscribers += len(subscriber.Topics)
 		subscriber.mutex.RUnlock()
-	}
+	})
 
 	return models.Health{
 		UptimeSec:   int(time.Since(ps.startTime).Seconds()),
-		Topics:      len(ps.topics),
+		Topics:      ps.topicCount(),
 		Subscribers: totalSubscribers,
 	}
 }
 
 // RemoveSubscriber removes a subscriber from all topics and the system
 func (ps *PubSub) RemoveSubscriber(subscriberID string) {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
+	// Remove subscriber from the registry first so concurrent removals run once
+	shard := ps.subscriberShard(subscriberID)
+	shard.mutex.Lock()
+	subscriber, exists := shard.subscribers[subscriberID]
+	if exists {
+		delete(shard.subscribers, subscriberID)
+	}
+	shard.mutex.Unlock()
 
-	subscriber, exists := ps.subscribers[subscriberID]
 	if !exists {
 		return
 	}
@@ -369,36 +552,27 @@ func (ps *PubSub) RemoveSubscriber(subscriberID string) {
 	subscriber.mutex.RUnlock()
 
 	for _, topicName := range topics {
-		if topic, exists := ps.topics[topicName]; exists {
+		if topic, exists := ps.getTopic(topicName); exists {
 			topic.mutex.Lock()
 			delete(topic.Subscribers, subscriberID)
 			topic.mutex.Unlock()
 		}
 	}
 
-	// Close subscriber's message channel
-	close(subscriber.SendChan)
-
-	// Remove subscriber from system
-	delete(ps.subscribers, subscriberID)
+	// Stop delivery, which closes the subscriber's message channel
+	subscriber.close()
 
 	ps.logger.WithFields(logger.Fields{
-		"subscriber_id":         subscriberID,
-		"action":                "remove",
-		"topics_subscribed":     len(subscriber.Topics),
-		"remaining_subscribers": len(ps.subscribers),
+		"subscriber_id":     subscriberID,
+		"action":            "remove",
+		"topics_subscribed": len(topics),
 	}).Info("Subscriber removed successfully")
 }
 
-// notifySubscribers sends a message to all subscribers of a topic
-func (ps *PubSub) notifySubscribers(topicName string, message *models.Message) {
-	ps.mutex.RLock()
-	topic, exists := ps.topics[topicName]
-	ps.mutex.RUnlock()
-
-	if !exists {
-		return
-	}
+// notifySubscribers sends a message to all subscribers of a topic and returns how many
+// subscribers it was offered to
+func (ps *PubSub) notifySubscribers(topic *Topic, message *models.Message) int {
+	topicName := topic.Name
 
 	topic.mutex.RLock()
 	subscribers := make([]*Subscriber, 0, len(topic.Subscribers))
@@ -407,19 +581,24 @@ func (ps *PubSub) notifySubscribers(topicName string, message *models.Message) {
 	}
 	topic.mutex.RUnlock()
 
+	// Build the event once and share it, so it is encoded once for all subscribers
+	serverMessage := &models.ServerMessage{
+		Type:    "event",
+		Topic:   topicName,
+		Message: message,
+		TS:      time.Now().Format(time.RFC3339),
+		Frames:  &models.EncodedFrames{},
+	}
+
 	// Send message to all subscribers
 	for _, subscriber := range subscribers {
-		serverMessage := &models.ServerMessage{
-			Type:    "event",
-			Topic:   topicName,
-			Message: message,
-			TS:      time.Now().Format(time.RFC3339),
+		// Credit-mode subscribers pull from the retained log instead
+		if subscriber.inCreditMode(topic) {
+			ps.deliverCredited(subscriber, topic)
+			continue
 		}
 
-		select {
-		case subscriber.SendChan <- serverMessage:
-			// Message sent successfully
-		default:
+		if !subscriber.trySend(serverMessage) {
 			// Channel is full, send SLOW_CONSUMER error
 			errorMessage := &models.ServerMessage{
 				Type: "error",
@@ -430,10 +609,7 @@ func (ps *PubSub) notifySubscribers(topicName string, message *models.Message) {
 				TS: time.Now().Format(time.RFC3339),
 			}
 
-			select {
-			case subscriber.SendChan <- errorMessage:
-				// Error sent successfully
-			default:
+			if !subscriber.trySend(errorMessage) {
 				// Even error channel is full, disconnect subscriber
 				ps.logger.WithFields(logger.Fields{
 					"subscriber_id": subscriber.ID,
@@ -445,22 +621,18 @@ func (ps *PubSub) notifySubscribers(topicName string, message *models.Message) {
 			}
 		}
 	}
+	return len(subscribers)
 }
 
 // sendHistoricalMessages sends the last N messages to a subscriber
 func (ps *PubSub) sendHistoricalMessages(subscriber *Subscriber, topic *Topic, lastN int) {
+	// Copy only the requested messages out of the ring
 	topic.mutex.RLock()
-	messages := make([]*models.Message, len(topic.Messages))
-	copy(messages, topic.Messages)
+	messages := topic.messages.last(lastN)
 	topic.mutex.RUnlock()
 
 	// Send last N messages in reverse order (newest first)
-	start := len(messages) - lastN
-	if start < 0 {
-		start = 0
-	}
-
-	for i := len(messages) - 1; i >= start; i-- {
+	for i := len(messages) - 1; i >= 0; i-- {
 		serverMessage := &models.ServerMessage{
 			Type:    "event",
 			Topic:   topic.Name,
@@ -468,29 +640,68 @@ func (ps *PubSub) sendHistoricalMessages(subscriber *Subscriber, topic *Topic, l
 			TS:      time.Now().Format(time.RFC3339),
 		}
 
-		select {
-		case subscriber.SendChan <- serverMessage:
-			// Historical message sent successfully
-		default:
+		if !subscriber.trySend(serverMessage) {
 			// Channel is full, stop sending historical messages
 			ps.logger.WithFields(logger.Fields{
 				"subscriber_id": subscriber.ID,
 				"topic":         topic.Name,
 				"action":        "historical_replay_stopped",
 				"reason":        "channel_full",
-				"messages_sent": i,
+				"messages_sent": len(messages) - 1 - i,
 			}).Warn("Historical message replay stopped due to full channel")
 			return
 		}
 	}
 }
 
+// addSubscriberWithReplay adds a subscriber to a topic and queues retained history oldest
+// first while holding the topic lock, so that no message published concurrently is missed
+// or delivered ahead of the replay
+func (ps *PubSub) addSubscriberWithReplay(subscriber *Subscriber, topic *Topic, opts SubscribeOptions) error {
+	topic.mutex.Lock()
+	defer topic.mutex.Unlock()
+
+	if topic.deleted {
+		return models.ErrTopicNotFound
+	}
+	topic.Subscribers[subscriber.ID] = subscriber
+
+	subscriber.mutex.Lock()
+	subscriber.Topics[topic.Name] = true
+	subscriber.mutex.Unlock()
+
+	var messages []*models.Message
+	if opts.ResumeAfter != "" {
+		messages = topic.messages.after(opts.ResumeAfter)
+	} else if opts.LastN > 0 {
+		messages = topic.messages.last(opts.LastN)
+	}
+
+	for i, message := range messages {
+		serverMessage := &models.ServerMessage{
+			Type:    "event",
+			Topic:   topic.Name,
+			Message: message,
+			TS:      time.Now().Format(time.RFC3339),
+		}
+
+		if !subscriber.trySend(serverMessage) {
+			ps.logger.WithFields(logger.Fields{
+				"subscriber_id": subscriber.ID,
+				"topic":         topic.Name,
+				"action":        "historical_replay_stopped",
+				"reason":        "channel_full",
+				"messages_sent": i,
+			}).Warn("Historical message replay stopped due to full channel")
+			break
+		}
+	}
+	return nil
+}
+
 // GetSubscriber returns a subscriber by ID
 func (ps *PubSub) GetSubscriber(subscriberID string) *Subscriber {
-	ps.mutex.RLock()
-	defer ps.mutex.RUnlock()
-
-	if subscriber, exists := ps.subscribers[subscriberID]; exists {
+	if subscriber, exists := ps.getSubscriber(subscriberID); exists {
 		return subscriber
 	}
 	return nil
@@ -1,10 +1,13 @@
 package pubsub
 
 import (
+	"fmt"
 	"pub-sub/config"
 	"pub-sub/logger"
 	"pub-sub/models"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // MockLogger implements logger.Logger for testing
@@ -30,6 +33,19 @@ func (m *MockLogger) WithError(err error) logger.Logger {
 	return m
 }
 
+// waitForDepth waits briefly for a subscriber queue to settle at the expected depth,
+// since the delivery goroutine releases in-flight messages asynchronously
+func waitForDepth(subscriber *Subscriber, expected int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		depth := subscriber.QueueStats().Depth
+		if depth == expected || time.Now().After(deadline) {
+			return depth
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestNewPubSub(t *testing.T) {
 	cfg := &config.Config{
 		MaxMessagesPerTopic: 100,
@@ -47,11 +63,11 @@ func TestNewPubSub(t *testing.T) {
 		t.Error("Config not properly set")
 	}
 
-	if len(ps.topics) != 0 {
+	if ps.topicCount() != 0 {
 		t.Error("Topics map should be empty initially")
 	}
 
-	if len(ps.subscribers) != 0 {
+	if ps.subscriberCount() != 0 {
 		t.Error("Subscribers map should be empty initially")
 	}
 }
@@ -78,11 +94,11 @@ func TestCreateTopic(t *testing.T) {
 	}
 
 	// Verify topic was created
-	if len(ps.topics) != 1 {
+	if ps.topicCount() != 1 {
 		t.Error("Topic count should be 1")
 	}
 
-	if _, exists := ps.topics["test-topic"]; !exists {
+	if _, exists := ps.getTopic("test-topic"); !exists {
 		t.Error("Topic should exist in topics map")
 	}
 }
@@ -112,7 +128,7 @@ func TestDeleteTopic(t *testing.T) {
 	}
 
 	// Verify topic was deleted
-	if len(ps.topics) != 0 {
+	if ps.topicCount() != 0 {
 		t.Error("Topic count should be 0")
 	}
 }
@@ -147,12 +163,12 @@ func TestPublishMessage(t *testing.T) {
 	}
 
 	// Verify message was published
-	topic := ps.topics["test-topic"]
+	topic, _ := ps.getTopic("test-topic")
 	if topic.MessageCount != 1 {
 		t.Error("Message count should be 1")
 	}
 
-	if len(topic.Messages) != 1 {
+	if topic.messages.len() != 1 {
 		t.Error("Messages slice should have 1 message")
 	}
 }
@@ -188,12 +204,45 @@ func TestSubscribeUnsubscribe(t *testing.T) {
 	}
 
 	// Verify subscriber was removed
-	topic := ps.topics["test-topic"]
+	topic, _ := ps.getTopic("test-topic")
 	if len(topic.Subscribers) != 0 {
 		t.Error("Subscriber count should be 0")
 	}
 }
 
+func TestSubscribeDeletedTopic(t *testing.T) {
+	ps := NewPubSub(&config.Config{MaxMessagesPerTopic: 100, MaxPublishRate: 50}, &MockLogger{})
+	ps.CreateTopic("live")
+	ps.CreateTopic("deleted")
+	if err := ps.Subscribe("subscriber-1", "live", 0); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// The topic is deleted between the lookup and adding the subscriber
+	topic, _ := ps.getTopic("deleted")
+	topic.mutex.Lock()
+	topic.deleted = true
+	topic.mutex.Unlock()
+
+	// A subscriber created for the failed subscription is removed, in every mode
+	for _, opts := range []SubscribeOptions{{}, {OldestFirst: true}, {CreditMode: true, Credits: 1}} {
+		if err := ps.SubscribeWithOptions("subscriber-2", "deleted", opts); !models.IsErrorType(err, models.ErrTopicNotFound) {
+			t.Errorf("Expected ErrTopicNotFound for %+v, got %v", opts, err)
+		}
+		if ps.GetSubscriber("subscriber-2") != nil {
+			t.Errorf("Expected no subscriber left after a failed subscription with %+v", opts)
+		}
+	}
+
+	// An existing subscriber keeps its other subscriptions
+	if err := ps.Subscribe("subscriber-1", "deleted", 0); err == nil {
+		t.Error("Expected subscribing to the deleted topic to fail")
+	}
+	if ps.GetSubscriber("subscriber-1") == nil || ps.subscriberCount() != 1 {
+		t.Error("Expected the existing subscriber to be kept")
+	}
+}
+
 func TestGetTopics(t *testing.T) {
 	cfg := &config.Config{
 		MaxMessagesPerTopic: 100,
@@ -283,3 +332,476 @@ func TestGetHealth(t *testing.T) {
 		t.Error("Uptime should be non-negative")
 	}
 }
+
+func TestSubscribeQueueSize(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 100,
+		MaxPublishRate:      50,
+		DefaultQueueSize:    10,
+		MaxQueueSize:        20,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+	ps.CreateTopic("test-topic")
+
+	// Requested size within bounds is honoured
+	ps.SubscribeWithOptions("subscriber-1", "test-topic", SubscribeOptions{QueueSize: 15})
+	if got := ps.GetSubscriber("subscriber-1").QueueStats().Capacity; got != 15 {
+		t.Errorf("Expected queue capacity 15, got %d", got)
+	}
+
+	// Requested size above the maximum is capped
+	ps.SubscribeWithOptions("subscriber-2", "test-topic", SubscribeOptions{QueueSize: 500})
+	if got := ps.GetSubscriber("subscriber-2").QueueStats().Capacity; got != 20 {
+		t.Errorf("Expected queue capacity capped at 20, got %d", got)
+	}
+
+	// Default size is used when none is requested
+	ps.Subscribe("subscriber-3", "test-topic", 0)
+	if got := ps.GetSubscriber("subscriber-3").QueueStats().Capacity; got != 10 {
+		t.Errorf("Expected default queue capacity 10, got %d", got)
+	}
+
+	// High-water mark tracks the deepest queue observed
+	for i := 0; i < 3; i++ {
+		ps.PublishMessage("test-topic", &models.Message{ID: "m", Payload: i})
+	}
+
+	stats := ps.GetSubscriber("subscriber-1").QueueStats()
+	if stats.Depth != 3 {
+		t.Errorf("Expected queue depth 3, got %d", stats.Depth)
+	}
+	if stats.HighWaterMark != 3 {
+		t.Errorf("Expected high-water mark 3, got %d", stats.HighWaterMark)
+	}
+}
+
+func TestSubscribeResume(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 100,
+		MaxPublishRate:      50,
+		DefaultQueueSize:    10,
+		MaxQueueSize:        20,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+	ps.CreateTopic("test-topic")
+	for i := 1; i <= 4; i++ {
+		ps.PublishMessage("test-topic", &models.Message{ID: fmt.Sprintf("m-%d", i), Payload: i})
+	}
+
+	receive := func(subscriberID string, count int) []string {
+		channel := ps.GetSubscriberChannel(subscriberID)
+		var ids []string
+		for len(ids) < count {
+			select {
+			case message := <-channel:
+				ids = append(ids, message.Message.ID)
+			case <-time.After(time.Second):
+				return ids
+			}
+		}
+		return ids
+	}
+
+	// Oldest-first replay delivers history in publish order
+	ps.SubscribeWithOptions("subscriber-1", "test-topic", SubscribeOptions{LastN: 2, OldestFirst: true})
+	if ids := receive("subscriber-1", 2); fmt.Sprint(ids) != "[m-3 m-4]" {
+		t.Errorf("Expected m-3 and m-4 oldest first, got %v", ids)
+	}
+
+	// Resuming replays everything after the given message
+	ps.SubscribeWithOptions("subscriber-2", "test-topic", SubscribeOptions{ResumeAfter: "m-2"})
+	if ids := receive("subscriber-2", 2); fmt.Sprint(ids) != "[m-3 m-4]" {
+		t.Errorf("Expected resume after m-2 to replay m-3 and m-4, got %v", ids)
+	}
+
+	// Live messages follow the replayed history
+	ps.PublishMessage("test-topic", &models.Message{ID: "m-5", Payload: 5})
+	if ids := receive("subscriber-2", 1); fmt.Sprint(ids) != "[m-5]" {
+		t.Errorf("Expected live message m-5 after replay, got %v", ids)
+	}
+}
+
+func TestPull(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 3,
+		MaxPublishRate:      50,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+	ps.CreateTopic("test-topic")
+	for i := 1; i <= 2; i++ {
+		ps.PublishMessage("test-topic", &models.Message{ID: fmt.Sprintf("m-%d", i), Payload: i})
+	}
+
+	result, err := ps.Pull("test-topic", 0, 1)
+	if err != nil || len(result.Messages) != 1 || result.Messages[0].ID != "m-1" || result.Cursor != 1 {
+		t.Fatalf("Expected m-1 and cursor 1, got %+v %v", result, err)
+	}
+	if result.Head != 2 || result.Published != nil {
+		t.Errorf("Expected head 2 and no wait channel, got %+v", result)
+	}
+
+	// Caught up: a wait channel is returned and closed by the next publish
+	result, _ = ps.Pull("test-topic", 2, 10)
+	if len(result.Messages) != 0 || result.Cursor != 2 || result.Published == nil {
+		t.Fatalf("Expected an empty page with a wait channel, got %+v", result)
+	}
+	for i := 3; i <= 5; i++ {
+		ps.PublishMessage("test-topic", &models.Message{ID: fmt.Sprintf("m-%d", i), Payload: i})
+	}
+	select {
+	case <-result.Published:
+	case <-time.After(time.Second):
+		t.Fatal("Expected publishing to close the wait channel")
+	}
+
+	// Cursors before the oldest retained message skip the evicted messages
+	result, _ = ps.Pull("test-topic", 1, 10)
+	if result.Skipped != 1 || len(result.Messages) != 3 || result.Messages[0].ID != "m-3" || result.Cursor != 5 {
+		t.Errorf("Expected m-2 skipped and m-3 to m-5 returned, got %+v", result)
+	}
+
+	if _, err := ps.Pull("test-topic", 6, 10); err != models.ErrInvalidCursor {
+		t.Errorf("Expected INVALID_CURSOR beyond the newest message, got %v", err)
+	}
+
+	// Deleting the topic wakes waiters
+	result, _ = ps.Pull("test-topic", 5, 10)
+	ps.DeleteTopic("test-topic")
+	select {
+	case <-result.Published:
+	case <-time.After(time.Second):
+		t.Fatal("Expected topic deletion to close the wait channel")
+	}
+	if _, err := ps.Pull("test-topic", 5, 10); err != models.ErrTopicNotFound {
+		t.Errorf("Expected TOPIC_NOT_FOUND after deletion, got %v", err)
+	}
+}
+
+func TestPublishMessages(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 2,
+		MaxPublishRate:      50,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+	ps.CreateTopic("test-topic")
+	ps.Subscribe("subscriber-1", "test-topic", 0)
+
+	messages := []*models.Message{
+		{ID: "m-1", Payload: 1},
+		{ID: "m-2", Payload: 2},
+		{ID: "m-3", Payload: 3},
+	}
+
+	if err := ps.PublishMessages("test-topic", messages); err != nil {
+		t.Fatalf("Failed to publish batch: %v", err)
+	}
+
+	if err := ps.PublishMessages("non-existent", messages); err == nil {
+		t.Error("Should not allow publishing a batch to non-existent topic")
+	}
+
+	topic, _ := ps.getTopic("test-topic")
+	if topic.MessageCount != 3 {
+		t.Errorf("Expected message count 3, got %d", topic.MessageCount)
+	}
+
+	if topic.messages.len() != 2 || topic.messages.at(0).ID != "m-2" {
+		t.Error("Circular buffer should retain the two newest messages")
+	}
+
+	// Subscribers receive the batch in publish order
+	channel := ps.GetSubscriberChannel("subscriber-1")
+	for _, expected := range messages {
+		event := <-channel
+		if event.Message.ID != expected.ID {
+			t.Errorf("Expected message %s, got %s", expected.ID, event.Message.ID)
+		}
+	}
+}
+
+func TestCreditMode(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 100,
+		MaxPublishRate:      50,
+		DefaultQueueSize:    2,
+		MaxQueueSize:        2,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+	ps.CreateTopic("test-topic")
+	ps.PublishMessage("test-topic", &models.Message{ID: "m-1"})
+
+	// Replay one historical message against one initial credit
+	err := ps.SubscribeWithOptions("subscriber-1", "test-topic", SubscribeOptions{LastN: 1, CreditMode: true, Credits: 1})
+	if err != nil {
+		t.Fatalf("Failed to subscribe in credit mode: %v", err)
+	}
+
+	subscriber := ps.GetSubscriber("subscriber-1")
+	channel := ps.GetSubscriberChannel("subscriber-1")
+	if event := <-channel; event.Message.ID != "m-1" {
+		t.Errorf("Expected replayed message m-1, got %s", event.Message.ID)
+	}
+
+	// Publishing more messages than the queue holds must not trigger SLOW_CONSUMER
+	for _, id := range []string{"m-2", "m-3", "m-4", "m-5"} {
+		ps.PublishMessage("test-topic", &models.Message{ID: id})
+	}
+	if depth := waitForDepth(subscriber, 0); depth != 0 {
+		t.Fatalf("Expected no events without credits, got %d", depth)
+	}
+
+	// Credits release held messages in order, bounded by queue space
+	if err := ps.GrantCredits("subscriber-1", "test-topic", 3); err != nil {
+		t.Fatalf("Failed to grant credits: %v", err)
+	}
+	for _, expected := range []string{"m-2", "m-3"} {
+		if event := <-channel; event.Type != "event" || event.Message.ID != expected {
+			t.Errorf("Expected event %s, got %s %+v", expected, event.Type, event.Message)
+		}
+	}
+
+	// Remaining credit is used once the queue drains and delivery resumes
+	ps.PublishMessage("test-topic", &models.Message{ID: "m-6"})
+	if event := <-channel; event.Message.ID != "m-4" {
+		t.Errorf("Expected event m-4, got %s", event.Message.ID)
+	}
+	if credits := subscriber.credits["test-topic"].credits; credits != 0 {
+		t.Errorf("Expected credits to be exhausted, got %d", credits)
+	}
+
+	// Credits require a credit-mode subscription
+	ps.Subscribe("subscriber-2", "test-topic", 0)
+	if err := ps.GrantCredits("subscriber-2", "test-topic", 1); !models.IsErrorType(err, models.ErrCreditModeRequired) {
+		t.Errorf("Expected CREDIT_MODE_REQUIRED, got %v", err)
+	}
+}
+
+func TestPriorityDelivery(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 100,
+		MaxPublishRate:      50,
+		DefaultQueueSize:    3,
+		MaxQueueSize:        3,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+	ps.CreateTopic("test-topic")
+	ps.Subscribe("subscriber-1", "test-topic", 0)
+	subscriber := ps.GetSubscriber("subscriber-1")
+
+	// Fill the queue once the first message has been handed to the delivery goroutine
+	ps.PublishMessage("test-topic", &models.Message{ID: "low-1", Priority: models.PriorityLow})
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		subscriber.queue.mutex.Lock()
+		popped := subscriber.queue.inFlight == 1
+		subscriber.queue.mutex.Unlock()
+		if popped {
+			break
+		}
+	}
+	ps.PublishMessage("test-topic", &models.Message{ID: "low-2", Priority: models.PriorityLow})
+	ps.PublishMessage("test-topic", &models.Message{ID: "normal-1"})
+
+	// A high-priority message evicts the oldest queued low-priority one
+	ps.PublishMessage("test-topic", &models.Message{ID: "high-1", Priority: models.PriorityHigh})
+
+	channel := ps.GetSubscriberChannel("subscriber-1")
+	for _, expected := range []string{"low-1", "high-1", "normal-1"} {
+		event := <-channel
+		if event.Message == nil || event.Message.ID != expected {
+			t.Fatalf("Expected %s, got %+v", expected, event)
+		}
+	}
+
+	stats := subscriber.QueueStats()
+	if stats.Evicted != 1 {
+		t.Errorf("Expected 1 evicted message, got %d", stats.Evicted)
+	}
+	if depth := waitForDepth(subscriber, 0); depth != 0 {
+		t.Errorf("Expected empty queue, got depth %d", depth)
+	}
+}
+
+func TestMessageRing(t *testing.T) {
+	ring := newMessageRing(3)
+
+	// Fill past capacity so the ring wraps around
+	var evicted []string
+	for i := 1; i <= 5; i++ {
+		if message := ring.push(&models.Message{ID: fmt.Sprintf("m-%d", i)}); message != nil {
+			evicted = append(evicted, message.ID)
+		}
+	}
+
+	if len(evicted) != 2 || evicted[0] != "m-1" || evicted[1] != "m-2" {
+		t.Errorf("Expected m-1 and m-2 to be evicted, got %v", evicted)
+	}
+	if ring.len() != 3 || ring.at(0).ID != "m-3" || ring.at(2).ID != "m-5" {
+		t.Error("Ring should retain m-3 to m-5 oldest first")
+	}
+
+	last := ring.last(2)
+	if len(last) != 2 || last[0].ID != "m-4" || last[1].ID != "m-5" {
+		t.Errorf("Expected last two messages m-4 and m-5, got %d messages", len(last))
+	}
+	if len(ring.last(10)) != 3 {
+		t.Error("Last should be clamped to the retained messages")
+	}
+	if slice := ring.slice(1, 2); len(slice) != 1 || slice[0].ID != "m-4" {
+		t.Error("Slice should return only the requested range")
+	}
+	if after := ring.after("m-3"); len(after) != 2 || after[0].ID != "m-4" {
+		t.Error("After should return the messages following the given ID")
+	}
+	if len(ring.after("m-1")) != 3 {
+		t.Error("After should return all retained messages for an evicted ID")
+	}
+
+	// Dropped messages keep their slot but are skipped by reads
+	if dropped := ring.drop(1); dropped == nil || dropped.ID != "m-4" || ring.len() != 3 {
+		t.Fatal("Drop should empty the slot of m-4 and keep the ring length")
+	}
+	if last := ring.last(2); len(last) != 1 || last[0].ID != "m-5" {
+		t.Errorf("Expected only m-5 among the last two slots, got %d messages", len(last))
+	}
+	messages, indices, next := ring.collect(0, 2)
+	if len(messages) != 2 || messages[1].ID != "m-5" || indices[1] != 2 || next != 3 {
+		t.Errorf("Expected m-3 and m-5 at indices 0 and 2, got %d messages at %v, next %d", len(messages), indices, next)
+	}
+	if messages, _, next := ring.collect(1, 1); len(messages) != 1 || messages[0].ID != "m-5" || next != 3 {
+		t.Errorf("Expected collect to pass over the dropped slot, got %d messages, next %d", len(messages), next)
+	}
+	if ring.push(&models.Message{ID: "m-6"}) == nil || ring.push(&models.Message{ID: "m-7"}) != nil {
+		t.Error("Pushing over a dropped slot should return nil")
+	}
+
+	if drained := ring.drain(); len(drained) != 3 || ring.len() != 0 {
+		t.Error("Drain should return all messages and empty the ring")
+	}
+}
+
+func TestDropPublished(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 10,
+		DefaultQueueSize:    10,
+		MaxQueueSize:        10,
+	}
+	ps := NewPubSub(cfg, &MockLogger{})
+	var released []string
+	ps.SetReleaseHandler(func(topic string, message *models.Message) {
+		released = append(released, message.ID)
+	})
+
+	ps.CreateTopic("test-topic")
+	for i, publisher := range []string{"a", "b", "a", "a", "b"} {
+		ps.PublishMessage("test-topic", &models.Message{ID: fmt.Sprintf("m-%d", i+1), Publisher: publisher, Size: 10})
+	}
+
+	// The publisher's oldest messages go first, until enough bytes are released
+	if bytes := ps.DropPublished("a", 15); bytes != 20 || len(released) != 2 || released[0] != "m-1" || released[1] != "m-3" {
+		t.Fatalf("Expected m-1 and m-3 dropped for 20 bytes, got %d bytes %v", bytes, released)
+	}
+
+	// Pulls pass over dropped messages with cursors unchanged
+	result, _ := ps.Pull("test-topic", 0, 2)
+	if len(result.Messages) != 2 || result.Messages[0].ID != "m-2" || result.Messages[1].ID != "m-4" || result.Cursor != 4 {
+		t.Errorf("Expected m-2 and m-4 up to cursor 4, got %+v", result)
+	}
+
+	// Credit-mode delivery spends no credits on dropped messages
+	if err := ps.SubscribeWithOptions("subscriber-1", "test-topic", SubscribeOptions{LastN: 5, CreditMode: true, Credits: 2}); err != nil {
+		t.Fatal(err)
+	}
+	channel := ps.GetSubscriberChannel("subscriber-1")
+	for _, expected := range []string{"m-2", "m-4"} {
+		if event := <-channel; event.Message.ID != expected {
+			t.Errorf("Expected event %s, got %s", expected, event.Message.ID)
+		}
+	}
+	ps.GrantCredits("subscriber-1", "test-topic", 1)
+	if event := <-channel; event.Message.ID != "m-5" {
+		t.Errorf("Expected event m-5, got %s", event.Message.ID)
+	}
+}
+
+func TestConcurrentTopicLifecycle(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 10,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+
+	// Create, subscribe, publish and delete concurrently across many topics
+	done := make(chan struct{})
+	for worker := 0; worker < 8; worker++ {
+		go func(worker int) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 50; i++ {
+				name := fmt.Sprintf("topic-%d", i%10)
+				subscriberID := fmt.Sprintf("subscriber-%d", worker)
+				ps.CreateTopic(name)
+				ps.Subscribe(subscriberID, name, 0)
+				ps.PublishMessage(name, &models.Message{ID: fmt.Sprintf("%d-%d", worker, i)})
+				ps.DeleteTopic(name)
+				ps.GetStats()
+			}
+			ps.RemoveSubscriber(fmt.Sprintf("subscriber-%d", worker))
+		}(worker)
+	}
+	for worker := 0; worker < 8; worker++ {
+		<-done
+	}
+
+	if count := ps.subscriberCount(); count != 0 {
+		t.Errorf("Expected 0 subscribers, got %d", count)
+	}
+
+	// Topics deleted while a subscription was in flight must not stay linked
+	ps.forEachTopic(func(topic *Topic) {
+		if topic.subscriberCount() != 0 {
+			t.Errorf("Expected no subscribers on topic %s, got %d", topic.Name, topic.subscriberCount())
+		}
+	})
+}
+
+// BenchmarkPublishParallel measures publish throughput across many topics.
+// Run with -cpu 1,2,4,8 to see how it scales with cores.
+func BenchmarkPublishParallel(b *testing.B) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic: 100,
+	}
+	mockLogger := &MockLogger{}
+
+	ps := NewPubSub(cfg, mockLogger)
+
+	const topicCount = 1024
+	names := make([]string, topicCount)
+	for i := range names {
+		names[i] = fmt.Sprintf("topic-%d", i)
+		ps.CreateTopic(names[i])
+	}
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// Each goroutine starts at a different topic
+		i := int(next.Add(7919))
+		message := &models.Message{ID: "bench"}
+		for pb.Next() {
+			ps.PublishMessage(names[i%topicCount], message)
+			i++
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package pubsub
+
+import "pub-sub/models"
+
+// PullResult is a page of retained messages read from a topic by cursor
+type PullResult struct {
+	Messages []*models.Message // Messages after the requested cursor, oldest first
+	Cursor   int               // Sequence number of the last message returned, or the requested cursor if none
+	Skipped  int               // Messages after the requested cursor that had already been evicted
+	Head     int               // Sequence number of the newest published message
+	// Published is closed when the topic's next message is published or the topic is
+	// deleted. It is only set when no messages were returned.
+	Published <-chan struct{}
+}
+
+// Pull reads up to max retained messages published after cursor, the sequence number
+// of the last message the caller consumed (0 before the first message). Messages are
+// numbered from 1 in publish order, so cursors stay valid while messages are evicted.
+// Messages dropped by their publisher's retained bytes quota are passed over.
+func (ps *PubSub) Pull(topicName string, cursor, max int) (*PullResult, error) {
+	topic, exists := ps.getTopic(topicName)
+	if !exists {
+		return nil, models.ErrTopicNotFound
+	}
+
+	topic.mutex.Lock()
+	defer topic.mutex.Unlock()
+
+	if topic.deleted {
+		return nil, models.ErrTopicNotFound
+	}
+	if cursor < 0 || cursor > topic.MessageCount {
+		return nil, models.ErrInvalidCursor
+	}
+
+	result := &PullResult{Cursor: cursor, Head: topic.MessageCount}
+
+	oldestSeq := topic.MessageCount - topic.messages.len() + 1
+	if cursor+1 < oldestSeq {
+		result.Skipped = oldestSeq - cursor - 1
+		cursor = oldestSeq - 1
+	}
+	start := cursor + 1 - oldestSeq
+	messages, _, end := topic.messages.collect(start, max)
+	result.Messages = messages
+	result.Cursor = cursor + end - start
+
+	// Long polls wait on a channel shared by every waiter, created only when needed
+	// so publishing stays allocation-free without waiters
+	if len(result.Messages) == 0 {
+		if topic.published == nil {
+			topic.published = make(chan struct{})
+		}
+		result.Published = topic.published
+	}
+	return result, nil
+}
+
+// wakePullers releases long polls waiting for the topic's next message. Caller must
+// hold the topic lock.
+func (t *Topic) wakePullers() {
+	if t.published != nil {
+		close(t.published)
+		t.published = nil
+	}
+}
@@ -0,0 +1,130 @@
+package pubsub
+
+import (
+	"pub-sub/models"
+	"sync"
+)
+
+// deliveryQueue is a bounded, priority-aware subscriber queue. Messages are delivered
+// highest priority first and FIFO within a priority; when full, the oldest message of
+// the lowest queued priority is evicted to make room for a higher-priority one.
+type deliveryQueue struct {
+	levels   [models.PriorityLevels][]*models.ServerMessage // FIFO per priority level
+	size     int                                            // Messages waiting in levels
+	inFlight int                                            // Messages popped but not yet handed to the consumer
+	capacity int                                            // Maximum of size + inFlight
+	highMark int                                            // Highest observed depth
+	evicted  int                                            // Messages evicted for higher priorities
+	closed   bool                                           // Set once the queue stops accepting messages
+	mutex    sync.Mutex
+	cond     *sync.Cond
+}
+
+// newDeliveryQueue creates an empty queue holding up to capacity messages
+func newDeliveryQueue(capacity int) *deliveryQueue {
+	q := &deliveryQueue{capacity: capacity}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// push enqueues a message without blocking. When the queue is full a queued message of
+// lower priority is evicted and returned; if none exists the push fails.
+func (q *deliveryQueue) push(message *models.ServerMessage) (bool, *models.ServerMessage) {
+	level := messageLevel(message)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return false, nil
+	}
+
+	var evicted *models.ServerMessage
+	if q.size+q.inFlight >= q.capacity {
+		for lower := 0; lower < level; lower++ {
+			if len(q.levels[lower]) > 0 {
+				evicted = q.levels[lower][0]
+				q.levels[lower][0] = nil
+				q.levels[lower] = q.levels[lower][1:]
+				q.size--
+				q.evicted++
+				break
+			}
+		}
+		if evicted == nil {
+			return false, nil
+		}
+	}
+
+	q.levels[level] = append(q.levels[level], message)
+	q.size++
+	if depth := q.size + q.inFlight; depth > q.highMark {
+		q.highMark = depth
+	}
+	q.cond.Signal()
+	return true, evicted
+}
+
+// next blocks until a message is available and returns the highest-priority one.
+// It returns false once the queue is closed.
+func (q *deliveryQueue) next() (*models.ServerMessage, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for q.size == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+
+	for level := models.PriorityLevels - 1; level >= 0; level-- {
+		if len(q.levels[level]) > 0 {
+			message := q.levels[level][0]
+			q.levels[level][0] = nil
+			q.levels[level] = q.levels[level][1:]
+			q.size--
+			q.inFlight++
+			return message, true
+		}
+	}
+	return nil, false
+}
+
+// delivered marks an in-flight message as handed to the consumer
+func (q *deliveryQueue) delivered() {
+	q.mutex.Lock()
+	q.inFlight--
+	q.mutex.Unlock()
+}
+
+// close stops the queue and wakes the delivery goroutine
+func (q *deliveryQueue) close() {
+	q.mutex.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+// stats returns the current capacity, depth and high-water mark
+func (q *deliveryQueue) stats() models.QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return models.QueueStats{
+		Capacity:      q.capacity,
+		Depth:         q.size + q.inFlight,
+		HighWaterMark: q.highMark,
+		Evicted:       q.evicted,
+	}
+}
+
+// messageLevel returns the queue priority of a server message. Events use the priority
+// of their message; control messages (info, errors) are always high priority.
+func messageLevel(message *models.ServerMessage) int {
+	if message.Type == "event" && message.Message != nil {
+		level, _ := models.PriorityLevel(message.Message.Priority)
+		return level
+	}
+	return models.PriorityLevels - 1
+}
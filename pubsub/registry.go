@@ -0,0 +1,172 @@
+package pubsub
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// shardCount is the number of shards in the topic and subscriber registries
+const shardCount = 64
+
+// Lock ordering
+//
+// Registry shard locks only guard their maps and are never held while acquiring
+// another shard lock, so lookups in different shards never contend. Locks that are
+// held together are always acquired in this order:
+//
+//  1. Subscriber.creditMutex
+//  2. topicShard.mutex (only when iterating topics for stats or DropPublished)
+//  3. Topic.mutex
+//  4. Subscriber.mutex
+//
+// subscriberShard.mutex is never held while acquiring any other lock.
+
+// topicShard holds one partition of the topic registry
+type topicShard struct {
+	topics map[string]*Topic // Topics hashed to this shard
+	mutex  sync.RWMutex      // Guards topics
+}
+
+// subscriberShard holds one partition of the subscriber registry
+type subscriberShard struct {
+	subscribers map[string]*Subscriber // Subscribers hashed to this shard
+	mutex       sync.RWMutex           // Guards subscribers
+}
+
+// newTopicShards creates an empty sharded topic registry
+func newTopicShards() []*topicShard {
+	shards := make([]*topicShard, shardCount)
+	for i := range shards {
+		shards[i] = &topicShard{topics: make(map[string]*Topic)}
+	}
+	return shards
+}
+
+// newSubscriberShards creates an empty sharded subscriber registry
+func newSubscriberShards() []*subscriberShard {
+	shards := make([]*subscriberShard, shardCount)
+	for i := range shards {
+		shards[i] = &subscriberShard{subscribers: make(map[string]*Subscriber)}
+	}
+	return shards
+}
+
+// shardIndex hashes a key to a shard
+func shardIndex(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % shardCount)
+}
+
+// topicShard returns the shard holding a topic name
+func (ps *PubSub) topicShard(name string) *topicShard {
+	return ps.topicShards[shardIndex(name)]
+}
+
+// subscriberShard returns the shard holding a subscriber ID
+func (ps *PubSub) subscriberShard(id string) *subscriberShard {
+	return ps.subscriberShards[shardIndex(id)]
+}
+
+// getTopic looks up a topic by name
+func (ps *PubSub) getTopic(name string) (*Topic, bool) {
+	shard := ps.topicShard(name)
+	shard.mutex.RLock()
+	topic, exists := shard.topics[name]
+	shard.mutex.RUnlock()
+	return topic, exists
+}
+
+// getSubscriber looks up a subscriber by ID
+func (ps *PubSub) getSubscriber(id string) (*Subscriber, bool) {
+	shard := ps.subscriberShard(id)
+	shard.mutex.RLock()
+	subscriber, exists := shard.subscribers[id]
+	shard.mutex.RUnlock()
+	return subscriber, exists
+}
+
+// getOrCreateSubscriber returns an existing subscriber or registers a new one, and
+// whether it was created
+func (ps *PubSub) getOrCreateSubscriber(id string, queueSize int) (*Subscriber, bool) {
+	shard := ps.subscriberShard(id)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	subscriber, exists := shard.subscribers[id]
+	if !exists {
+		subscriber = newSubscriber(id, queueSize)
+		shard.subscribers[id] = subscriber
+	}
+	return subscriber, !exists
+}
+
+// discardSubscriber unregisters and stops a subscriber that is not subscribed to any
+// topic, such as one created for a subscription that failed. A subscriber that another
+// subscription picked up meanwhile is kept.
+func (ps *PubSub) discardSubscriber(subscriber *Subscriber) {
+	shard := ps.subscriberShard(subscriber.ID)
+	shard.mutex.Lock()
+	subscriber.mutex.RLock()
+	unused := len(subscriber.Topics) == 0
+	subscriber.mutex.RUnlock()
+	if unused && shard.subscribers[subscriber.ID] == subscriber {
+		delete(shard.subscribers, subscriber.ID)
+	} else {
+		unused = false
+	}
+	shard.mutex.Unlock()
+
+	if unused {
+		subscriber.close()
+	}
+}
+
+// topicCount returns the number of registered topics
+func (ps *PubSub) topicCount() int {
+	count := 0
+	for _, shard := range ps.topicShards {
+		shard.mutex.RLock()
+		count += len(shard.topics)
+		shard.mutex.RUnlock()
+	}
+	return count
+}
+
+// subscriberCount returns the number of registered subscribers
+func (ps *PubSub) subscriberCount() int {
+	count := 0
+	for _, shard := range ps.subscriberShards {
+		shard.mutex.RLock()
+		count += len(shard.subscribers)
+		shard.mutex.RUnlock()
+	}
+	return count
+}
+
+// forEachTopic calls fn for every topic, holding one shard read lock at a time
+func (ps *PubSub) forEachTopic(fn func(topic *Topic)) {
+	for _, shard := range ps.topicShards {
+		shard.mutex.RLock()
+		for _, topic := range shard.topics {
+			fn(topic)
+		}
+		shard.mutex.RUnlock()
+	}
+}
+
+// forEachSubscriber calls fn for a snapshot of every subscriber, without holding shard locks
+func (ps *PubSub) forEachSubscriber(fn func(subscriber *Subscriber)) {
+	for _, shard := range ps.subscriberShards {
+		shard.mutex.RLock()
+		subscribers := make([]*Subscriber, 0, len(shard.subscribers))
+		for _, subscriber := range shard.subscribers {
+			subscribers = append(subscribers, subscriber)
+		}
+		shard.mutex.RUnlock()
+
+		for _, subscriber := range subscribers {
+			fn(subscriber)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package pubsub
+
+import "pub-sub/models"
+
+// messageRing is a fixed-capacity circular buffer of retained messages. Appending is
+// O(1) and overwrites the oldest message once the ring is full. Index 0 is the oldest
+// retained message. A dropped message leaves an empty slot, so the indices of the other
+// messages do not change; reads skip empty slots. Callers must hold the owning topic's lock.
+type messageRing struct {
+	buffer []*models.Message // Backing storage, allocated once
+	start  int               // Position of the oldest message in buffer
+	count  int               // Number of retained messages
+}
+
+// newMessageRing creates an empty ring holding up to capacity messages
+func newMessageRing(capacity int) *messageRing {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &messageRing{buffer: make([]*models.Message, capacity)}
+}
+
+// push appends a message and returns the message it displaced, if any. The displaced
+// slot may have been emptied by drop, in which case nil is returned.
+func (r *messageRing) push(message *models.Message) *models.Message {
+	if len(r.buffer) == 0 {
+		return message
+	}
+
+	if r.count < len(r.buffer) {
+		r.buffer[(r.start+r.count)%len(r.buffer)] = message
+		r.count++
+		return nil
+	}
+
+	evicted := r.buffer[r.start]
+	r.buffer[r.start] = message
+	r.start = (r.start + 1) % len(r.buffer)
+	return evicted
+}
+
+// len returns the number of retained messages
+func (r *messageRing) len() int {
+	return r.count
+}
+
+// at returns the i-th retained message, oldest first, or nil if it was dropped
+func (r *messageRing) at(i int) *models.Message {
+	return r.buffer[(r.start+i)%len(r.buffer)]
+}
+
+// drop empties the i-th slot and returns the message it held, or nil if it was empty
+func (r *messageRing) drop(i int) *models.Message {
+	position := (r.start + i) % len(r.buffer)
+	message := r.buffer[position]
+	r.buffer[position] = nil
+	return message
+}
+
+// slice copies the retained messages in [from, to), oldest first, clamped to the
+// retained range
+func (r *messageRing) slice(from, to int) []*models.Message {
+	if from < 0 {
+		from = 0
+	}
+	if to > r.count {
+		to = r.count
+	}
+	if from >= to {
+		return nil
+	}
+
+	messages := make([]*models.Message, 0, to-from)
+	for i := from; i < to; i++ {
+		if message := r.at(i); message != nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// collect copies up to limit retained messages starting at index from, oldest first,
+// along with the index of each. It returns the index after the last slot read: past the
+// last message copied, or the end of the ring if fewer than limit were found.
+func (r *messageRing) collect(from, limit int) ([]*models.Message, []int, int) {
+	if from < 0 {
+		from = 0
+	}
+	var messages []*models.Message
+	var indices []int
+	i := from
+	for ; i < r.count && len(messages) < limit; i++ {
+		if message := r.at(i); message != nil {
+			messages = append(messages, message)
+			indices = append(indices, i)
+		}
+	}
+	return messages, indices, i
+}
+
+// last copies the newest n retained messages, oldest first
+func (r *messageRing) last(n int) []*models.Message {
+	return r.slice(r.count-n, r.count)
+}
+
+// after copies the retained messages published after the message with the given ID,
+// oldest first, or every retained message if that message is no longer retained
+func (r *messageRing) after(id string) []*models.Message {
+	for i := r.count - 1; i >= 0; i-- {
+		if message := r.at(i); message != nil && message.ID == id {
+			return r.slice(i+1, r.count)
+		}
+	}
+	return r.slice(0, r.count)
+}
+
+// drain removes and returns all retained messages, oldest first
+func (r *messageRing) drain() []*models.Message {
+	messages := r.slice(0, r.count)
+	clear(r.buffer)
+	r.start = 0
+	r.count = 0
+	return messages
+}
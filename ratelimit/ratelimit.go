@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket implements a token bucket that refills at a fixed rate up to its burst size
+type TokenBucket struct {
+	rate     float64   // Tokens added per second
+	burst    float64   // Maximum number of tokens
+	tokens   float64   // Currently available tokens
+	lastFill time.Time // When tokens were last refilled
+}
+
+// NewTokenBucket creates a full token bucket allowing rate events per second
+func NewTokenBucket(rate int, now time.Time) *TokenBucket {
+	return &TokenBucket{
+		rate:     float64(rate),
+		burst:    float64(rate),
+		tokens:   float64(rate),
+		lastFill: now,
+	}
+}
+
+// refill adds the tokens accumulated since the last refill
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastFill).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.lastFill = now
+	}
+}
+
+// Allow takes one token if available. When the bucket is empty it returns false and
+// how long to wait until a token becomes available.
+func (b *TokenBucket) Allow(now time.Time) (bool, time.Duration) {
+	return b.AllowN(now, 1)
+}
+
+// AllowN takes n tokens if available, otherwise returns false and how long to wait
+// until n tokens become available. Requests larger than the burst are never allowed.
+func (b *TokenBucket) AllowN(now time.Time, n int) (bool, time.Duration) {
+	b.refill(now)
+	needed := float64(n)
+	if b.tokens >= needed {
+		b.tokens -= needed
+		return true, 0
+	}
+
+	wait := (needed - b.tokens) / b.rate
+	return false, time.Duration(math.Ceil(wait*1000)) * time.Millisecond
+}
+
+// Refund returns n tokens taken for an event that did not happen, up to the burst size
+func (b *TokenBucket) Refund(n int) {
+	b.tokens = math.Min(b.burst, b.tokens+float64(n))
+}
+
+// Available returns the number of tokens currently available
+func (b *TokenBucket) Available(now time.Time) int {
+	b.refill(now)
+	return int(b.tokens)
+}
+
+// Full reports whether the bucket has refilled completely
+func (b *TokenBucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// Limiter keeps a token bucket per key, e.g. per topic or per client
+type Limiter struct {
+	rateFor   func(key string) int    // Resolves the allowed rate for a key
+	buckets   map[string]*TokenBucket // Buckets keyed by limiter key
+	lastSweep time.Time               // When idle buckets were last evicted
+	mutex     sync.Mutex              // Protects buckets
+}
+
+// NewLimiter creates a keyed limiter. rateFor returns the events per second allowed
+// for a key; a non-positive rate disables limiting for that key.
+func NewLimiter(rateFor func(key string) int) *Limiter {
+	return &Limiter{
+		rateFor:   rateFor,
+		buckets:   make(map[string]*TokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket for key, returning the retry delay when limited
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		rate := l.rateFor(key)
+		if rate <= 0 {
+			return true, 0
+		}
+		bucket = NewTokenBucket(rate, now)
+		l.buckets[key] = bucket
+	}
+
+	return bucket.Allow(now)
+}
+
+// Refund returns the token taken by Allow for an event that was rejected later
+func (l *Limiter) Refund(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if bucket, exists := l.buckets[key]; exists {
+		bucket.Refund(1)
+	}
+}
+
+// Forget drops the bucket for key, e.g. when a connection closes
+func (l *Limiter) Forget(key string) {
+	l.mutex.Lock()
+	delete(l.buckets, key)
+	l.mutex.Unlock()
+}
+
+// sweep evicts buckets that have refilled completely, since a fresh bucket is equivalent.
+// Caller must hold the limiter lock.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if bucket.Full(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
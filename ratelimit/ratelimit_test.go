@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := NewTokenBucket(2, now)
+
+	// Burst equals the rate
+	for i := 0; i < 2; i++ {
+		if ok, _ := bucket.Allow(now); !ok {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+	}
+
+	ok, retryAfter := bucket.Allow(now)
+	if ok {
+		t.Fatal("Request beyond burst should be limited")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("Expected retry after 500ms, got %v", retryAfter)
+	}
+
+	// Tokens refill over time
+	if ok, _ := bucket.Allow(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("Request should be allowed after refill")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(func(key string) int {
+		if key == "unlimited" {
+			return 0
+		}
+		return 1
+	})
+
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Error("First request should be allowed")
+	}
+	if ok, _ := limiter.Allow("a"); ok {
+		t.Error("Second request should be limited")
+	}
+
+	// Keys are limited independently
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("Other keys should not be affected")
+	}
+
+	// A refunded token can be taken again
+	limiter.Refund("b")
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("Request should be allowed after Refund")
+	}
+	if ok, _ := limiter.Allow("b"); ok {
+		t.Error("Refund should return a single token")
+	}
+
+	// Non-positive rates disable limiting
+	for i := 0; i < 10; i++ {
+		if ok, _ := limiter.Allow("unlimited"); !ok {
+			t.Fatal("Unlimited key should never be limited")
+		}
+	}
+
+	// Forgetting a key resets its bucket
+	limiter.Forget("a")
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Error("Request should be allowed after Forget")
+	}
+}
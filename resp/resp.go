@@ -0,0 +1,258 @@
+// Package resp implements the subset of the Redis serialization protocol (RESP2) used
+// by the Redis pub/sub frontend: reading commands and writing replies, plus Redis glob
+// pattern matching for PSUBSCRIBE.
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	// ErrProtocol reports input that is not a valid RESP command
+	ErrProtocol = errors.New("invalid RESP command")
+	// ErrTooLarge reports a command whose arguments exceed the read limit
+	ErrTooLarge = errors.New("RESP command too large")
+)
+
+// ReadCommand reads one command, either a RESP array of bulk strings or an inline
+// command line as typed into telnet. Commands whose arguments total more than maxSize
+// bytes are rejected. Empty inline lines yield an empty command.
+func ReadCommand(r *bufio.Reader, maxSize int) ([][]byte, error) {
+	prefix, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if prefix[0] != '*' {
+		return readInline(r, maxSize)
+	}
+
+	r.ReadByte()
+	count, err := readInteger(r)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || count > maxSize {
+		return nil, ErrProtocol
+	}
+
+	args := make([][]byte, 0, count)
+	total := 0
+	for i := 0; i < count; i++ {
+		marker, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if marker != '$' {
+			return nil, ErrProtocol
+		}
+		length, err := readInteger(r)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, ErrProtocol
+		}
+		total += length
+		if total > maxSize {
+			return nil, ErrTooLarge
+		}
+
+		arg := make([]byte, length+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, ErrProtocol
+		}
+		args = append(args, arg[:length])
+	}
+	return args, nil
+}
+
+// readInline reads a command line of space-separated arguments
+func readInline(r *bufio.Reader, maxSize int) ([][]byte, error) {
+	line, err := readLine(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Fields(line), nil
+}
+
+// readInteger reads the decimal integer ending a RESP type line
+func readInteger(r *bufio.Reader) (int, error) {
+	line, err := readLine(r, 32)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(string(line))
+	if err != nil {
+		return 0, ErrProtocol
+	}
+	return value, nil
+}
+
+// readLine reads a line ending in CRLF or LF, without the line ending
+func readLine(r *bufio.Reader, maxSize int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxSize+2 {
+			return nil, ErrTooLarge
+		}
+		line = append(line, chunk...)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+}
+
+// Writer writes RESP2 replies. Replies are buffered until Flush.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter creates a reply writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// SimpleString writes a status reply such as +OK
+func (w *Writer) SimpleString(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// Error writes an error reply. The first word of message is its error code.
+func (w *Writer) Error(message string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(message)
+	w.w.WriteString("\r\n")
+}
+
+// Integer writes an integer reply
+func (w *Writer) Integer(n int) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// Bulk writes a bulk string reply
+func (w *Writer) Bulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// BulkString writes a string as a bulk string reply
+func (w *Writer) BulkString(s string) {
+	w.Bulk([]byte(s))
+}
+
+// Null writes the null bulk string
+func (w *Writer) Null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// Array writes the header of an array reply of n elements, which must follow
+func (w *Writer) Array(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// Flush writes the buffered replies
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Match reports whether a string matches a Redis glob pattern: '*' matches any
+// sequence, '?' any one byte, '[...]' a byte class with '^' negation and ranges, and
+// '\' escapes the next byte
+func Match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if Match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest := matchClass(pattern[1:], s[0])
+			if !matched {
+				return false
+			}
+			s = s[1:]
+			pattern = rest
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass matches a byte against a class whose opening '[' was consumed, returning
+// the pattern after the closing ']'. An unterminated class runs to the end of the pattern.
+func matchClass(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			low, high := pattern[0], pattern[2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || (c >= low && c <= high)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != negate, pattern
+}
@@ -0,0 +1,98 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	input := "*3\r\n$7\r\nPUBLISH\r\n$6\r\norders\r\n$12\r\nhello\r\nworld\r\n" +
+		"SUBSCRIBE a b\r\n" +
+		"\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	expected := [][]string{
+		{"PUBLISH", "orders", "hello\r\nworld"},
+		{"SUBSCRIBE", "a", "b"},
+		{},
+	}
+	for _, want := range expected {
+		args, err := ReadCommand(r, 1024)
+		if err != nil {
+			t.Fatalf("ReadCommand failed: %v", err)
+		}
+		got := make([]string, len(args))
+		for i, arg := range args {
+			got[i] = string(arg)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+
+	for input, want := range map[string]error{
+		"*1\r\n$20\r\nshort\r\n":       ErrTooLarge,
+		"*1\r\n+OK\r\n":                ErrProtocol,
+		"*x\r\n":                       ErrProtocol,
+		"*1\r\n$2\r\nabcd":             ErrProtocol,
+		strings.Repeat("a", 20) + "\n": ErrTooLarge,
+	} {
+		if _, err := ReadCommand(bufio.NewReader(strings.NewReader(input)), 16); !errors.Is(err, want) {
+			t.Errorf("ReadCommand(%q) = %v, want %v", input, err, want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	w := NewWriter(&buffer)
+	w.Array(3)
+	w.BulkString("message")
+	w.BulkString("orders")
+	w.Bulk([]byte("hi"))
+	w.SimpleString("PONG")
+	w.Error("ERR unknown command")
+	w.Integer(2)
+	w.Null()
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "*3\r\n$7\r\nmessage\r\n$6\r\norders\r\n$2\r\nhi\r\n+PONG\r\n-ERR unknown command\r\n:2\r\n$-1\r\n"
+	if buffer.String() != want {
+		t.Errorf("Expected %q, got %q", want, buffer.String())
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"orders", "orders", true},
+		{"orders.*", "orders.eu.created", true},
+		{"orders.*", "orders", false},
+		{"*", "", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+
+	for _, test := range tests {
+		if got := Match(test.pattern, test.s); got != test.match {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.pattern, test.s, got, test.match)
+		}
+	}
+}
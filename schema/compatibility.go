@@ -0,0 +1,370 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"pub-sub/models"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// checkVersions checks a new schema document against the existing versions of a topic
+func checkVersions(versions []*Version, document interface{}, mode Mode) error {
+	if mode == ModeNone || len(versions) == 0 {
+		return nil
+	}
+
+	against := versions[len(versions)-1:]
+	if mode.transitive() {
+		against = versions
+	}
+
+	// Newest first, so the error names the most recent incompatible version
+	for i := len(against) - 1; i >= 0; i-- {
+		existing := against[i]
+		name := fmt.Sprintf("version %d", existing.Number)
+
+		var issues []models.SchemaViolation
+		if mode.backward() {
+			// Data written with the existing version must be readable with the new schema
+			issues = append(issues, compare(existing.document, document, name, "new schema")...)
+		}
+		if mode.forward() {
+			// Data written with the new schema must be readable with the existing version
+			issues = append(issues, compare(document, existing.document, "new schema", name)...)
+		}
+		if len(issues) > 0 {
+			return &models.CompatibilityError{
+				Compatibility: string(mode),
+				Version:       existing.Number,
+				Issues:        issues,
+			}
+		}
+	}
+	return nil
+}
+
+// compare reports where a value valid under the writer schema may be rejected by the
+// reader schema. The check is structural and conservative: keywords it cannot reason
+// about must be identical in both schemas.
+func compare(writer, reader interface{}, writerName, readerName string) []models.SchemaViolation {
+	c := &checker{writer: writerName, reader: readerName}
+	c.subset(writer, reader, "")
+	return c.issues
+}
+
+// annotations are keywords that do not affect validation
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// lowerBounds and upperBounds are numeric keywords a reader may relax but not tighten
+var (
+	lowerBounds = []string{"minimum", "exclusiveMinimum", "minLength", "minItems", "minProperties"}
+	upperBounds = []string{"maximum", "exclusiveMaximum", "maxLength", "maxItems", "maxProperties"}
+)
+
+// checked are the keywords compared structurally rather than by equality
+var checked = map[string]bool{
+	"type": true, "enum": true, "const": true, "required": true, "properties": true,
+	"additionalProperties": true, "items": true,
+}
+
+func init() {
+	for _, keyword := range append(append([]string{}, lowerBounds...), upperBounds...) {
+		checked[keyword] = true
+	}
+}
+
+// checker accumulates compatibility issues between a writer and a reader schema
+type checker struct {
+	writer string
+	reader string
+	issues []models.SchemaViolation
+}
+
+// reject records a kind of value the writer allows and the reader rejects
+func (c *checker) reject(path, what string) {
+	c.issues = append(c.issues, models.SchemaViolation{
+		Path:    pointer(path),
+		Message: fmt.Sprintf("%s rejects %s allowed by %s", c.reader, what, c.writer),
+	})
+}
+
+// subset checks that every value valid under the writer schema is valid under the reader schema
+func (c *checker) subset(writer, reader interface{}, path string) {
+	if writer == false || reader == true {
+		return
+	}
+	if reader == false {
+		c.reject(path, "every value")
+		return
+	}
+	w, r := asObject(writer), asObject(reader)
+
+	if values, enumerated := enumValues(w); enumerated {
+		// Enumerated values can be checked one by one against the reader's type and values
+		c.values(values, r, path)
+		return
+	}
+
+	c.types(w, r, path)
+	if readerValues, enumerated := enumValues(r); enumerated {
+		c.reject(path, fmt.Sprintf("values outside %s", formatValues(readerValues)))
+	}
+	c.bounds(w, r, path)
+	if allowsType(w, "object") {
+		c.objects(w, r, path)
+	}
+	if allowsType(w, "array") {
+		if readerItems, exists := r["items"]; exists {
+			c.subset(orTrue(w["items"]), readerItems, path+"/items")
+		}
+	}
+
+	keywords := make([]string, 0, len(r))
+	for keyword := range r {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		if checked[keyword] || annotations[keyword] {
+			continue
+		}
+		if !reflect.DeepEqual(w[keyword], r[keyword]) {
+			c.issues = append(c.issues, models.SchemaViolation{
+				Path:    pointer(path + "/" + keyword),
+				Message: fmt.Sprintf("%q differs between %s and %s and cannot be checked for compatibility", keyword, c.writer, c.reader),
+			})
+		}
+	}
+}
+
+// types checks that the reader accepts every type the writer allows
+func (c *checker) types(w, r map[string]interface{}, path string) {
+	readerTypes, constrained := typeSet(r)
+	if !constrained {
+		return
+	}
+	writerTypes, writerConstrained := typeSet(w)
+	if !writerConstrained {
+		c.reject(path, "values of any type")
+		return
+	}
+	for _, name := range sortedKeys(writerTypes) {
+		if !readerTypes[name] && !(name == "integer" && readerTypes["number"]) {
+			c.reject(path, fmt.Sprintf("type %q", name))
+		}
+	}
+}
+
+// values checks that the reader accepts each enumerated writer value
+func (c *checker) values(values []interface{}, r map[string]interface{}, path string) {
+	readerTypes, typed := typeSet(r)
+	readerValues, enumerated := enumValues(r)
+	for _, value := range values {
+		name := typeOf(value)
+		typeAllowed := !typed || readerTypes[name] || (name == "integer" && readerTypes["number"])
+		if !typeAllowed || (enumerated && !containsValue(readerValues, value)) {
+			c.reject(path, fmt.Sprintf("value %s", formatValues([]interface{}{value})))
+		}
+	}
+}
+
+// bounds checks that the reader does not tighten numeric, length or size limits
+func (c *checker) bounds(w, r map[string]interface{}, path string) {
+	for _, keyword := range lowerBounds {
+		if readerBound, exists := number(r[keyword]); exists {
+			if writerBound, limited := number(w[keyword]); !limited || writerBound < readerBound {
+				c.reject(path, fmt.Sprintf("values violating %s %v", keyword, r[keyword]))
+			}
+		}
+	}
+	for _, keyword := range upperBounds {
+		if readerBound, exists := number(r[keyword]); exists {
+			if writerBound, limited := number(w[keyword]); !limited || writerBound > readerBound {
+				c.reject(path, fmt.Sprintf("values violating %s %v", keyword, r[keyword]))
+			}
+		}
+	}
+}
+
+// objects checks required and declared properties of object schemas
+func (c *checker) objects(w, r map[string]interface{}, path string) {
+	writerRequired := stringSet(w["required"])
+	for _, name := range sortedKeys(stringSet(r["required"])) {
+		if !writerRequired[name] {
+			c.reject(path, fmt.Sprintf("objects without property %q", name))
+		}
+	}
+
+	writerProperties := asObject(w["properties"])
+	readerProperties := asObject(r["properties"])
+	writerAdditional := orTrue(w["additionalProperties"])
+	readerAdditional := orTrue(r["additionalProperties"])
+
+	for _, name := range sortedKeys(readerProperties) {
+		writerProperty, declared := writerProperties[name]
+		if !declared {
+			writerProperty = writerAdditional
+		}
+		c.subset(writerProperty, readerProperties[name], path+"/properties/"+escape(name))
+	}
+
+	for _, name := range sortedKeys(writerProperties) {
+		if _, declared := readerProperties[name]; declared {
+			continue
+		}
+		if readerAdditional == false {
+			if writerProperties[name] != false {
+				c.reject(path, fmt.Sprintf("property %q", name))
+			}
+			continue
+		}
+		c.subset(writerProperties[name], readerAdditional, path+"/properties/"+escape(name))
+	}
+
+	if readerAdditional == false && writerAdditional != false {
+		c.reject(path, "additional properties")
+	} else {
+		c.subset(writerAdditional, readerAdditional, path+"/additionalProperties")
+	}
+}
+
+// asObject returns a schema as a keyword map; the true schema and missing schemas are empty
+func asObject(schema interface{}) map[string]interface{} {
+	if object, ok := schema.(map[string]interface{}); ok {
+		return object
+	}
+	return map[string]interface{}{}
+}
+
+// orTrue returns a schema, treating a missing schema as the schema accepting everything
+func orTrue(schema interface{}) interface{} {
+	if schema == nil {
+		return true
+	}
+	return schema
+}
+
+// typeSet returns the types a schema allows, and whether it constrains the type at all
+func typeSet(schema map[string]interface{}) (map[string]bool, bool) {
+	types := make(map[string]bool)
+	switch value := schema["type"].(type) {
+	case string:
+		types[value] = true
+	case []interface{}:
+		for _, name := range value {
+			if s, ok := name.(string); ok {
+				types[s] = true
+			}
+		}
+	default:
+		return nil, false
+	}
+	return types, true
+}
+
+// allowsType reports whether values of a type may satisfy a schema
+func allowsType(schema map[string]interface{}, name string) bool {
+	if values, enumerated := enumValues(schema); enumerated {
+		for _, value := range values {
+			if typeOf(value) == name {
+				return true
+			}
+		}
+		return false
+	}
+	types, constrained := typeSet(schema)
+	return !constrained || types[name]
+}
+
+// enumValues returns the values a schema restricts to with enum or const
+func enumValues(schema map[string]interface{}) ([]interface{}, bool) {
+	if value, exists := schema["const"]; exists {
+		return []interface{}{value}, true
+	}
+	if values, ok := schema["enum"].([]interface{}); ok {
+		return values, true
+	}
+	return nil, false
+}
+
+// typeOf returns the JSON Schema type of a decoded JSON value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// containsValue reports whether a list holds a value
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatValues renders values as JSON for messages
+func formatValues(values []interface{}) string {
+	encoded, _ := json.Marshal(values)
+	if len(values) == 1 {
+		return string(encoded[1 : len(encoded)-1])
+	}
+	return string(encoded)
+}
+
+// number returns a numeric keyword value
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// stringSet returns the strings of a JSON array as a set
+func stringSet(value interface{}) map[string]bool {
+	set := make(map[string]bool)
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			set[s] = true
+		}
+	}
+	return set
+}
+
+// sortedKeys returns the keys of a map in order, so issues are reported deterministically
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape escapes a property name for use in a JSON Pointer
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
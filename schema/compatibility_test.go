@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name       string
+		writer     string
+		reader     string
+		compatible bool
+	}{
+		{"identical", `{"type": "string"}`, `{"type": "string"}`, true},
+		{"reader accepts anything", `{"type": "string"}`, `true`, true},
+		{"integer read as number", `{"type": "integer"}`, `{"type": "number"}`, true},
+		{"number read as integer", `{"type": "number"}`, `{"type": "integer"}`, false},
+		{"type narrowed", `{"type": ["string", "null"]}`, `{"type": "string"}`, false},
+		{"untyped writer", `{}`, `{"type": "string"}`, false},
+		{"enum subset", `{"enum": ["a", "b"]}`, `{"enum": ["a", "b", "c"]}`, true},
+		{"enum removed value", `{"enum": ["a", "b"]}`, `{"enum": ["a"]}`, false},
+		{"enum against type", `{"const": 3}`, `{"type": "number"}`, true},
+		{"bound relaxed", `{"type": "number", "minimum": 5}`, `{"type": "number", "minimum": 0}`, true},
+		{"bound tightened", `{"type": "string", "maxLength": 10}`, `{"type": "string", "maxLength": 5}`, false},
+		{"bound added", `{"type": "string"}`, `{"type": "string", "minLength": 1}`, false},
+		{"requirement dropped", `{"type": "object", "required": ["a"]}`, `{"type": "object"}`, true},
+		{"requirement added", `{"type": "object"}`, `{"type": "object", "required": ["a"]}`, false},
+		{
+			"property added to closed object",
+			`{"type": "object", "properties": {"a": {"type": "string"}}, "additionalProperties": false}`,
+			`{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "integer"}}}`,
+			true,
+		},
+		{
+			"property added to open object",
+			`{"type": "object", "properties": {"a": {"type": "string"}}}`,
+			`{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "integer"}}}`,
+			false,
+		},
+		{
+			"property removed from closed reader",
+			`{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "integer"}}}`,
+			`{"type": "object", "properties": {"a": {"type": "string"}}, "additionalProperties": false}`,
+			false,
+		},
+		{
+			"nested property narrowed",
+			`{"type": "object", "properties": {"items": {"type": "array", "items": {"type": "number"}}}}`,
+			`{"type": "object", "properties": {"items": {"type": "array", "items": {"type": "integer"}}}}`,
+			false,
+		},
+		{"pattern unchanged", `{"type": "string", "pattern": "^a"}`, `{"type": "string", "pattern": "^a"}`, true},
+		{"pattern changed", `{"type": "string", "pattern": "^a"}`, `{"type": "string", "pattern": "^b"}`, false},
+		{"annotations ignored", `{"type": "string", "title": "A"}`, `{"type": "string", "description": "B"}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer, err := decode([]byte(test.writer))
+			if err != nil {
+				t.Fatalf("Invalid writer schema: %v", err)
+			}
+			reader, err := decode([]byte(test.reader))
+			if err != nil {
+				t.Fatalf("Invalid reader schema: %v", err)
+			}
+
+			issues := compare(writer, reader, "writer", "reader")
+			if compatible := len(issues) == 0; compatible != test.compatible {
+				t.Errorf("Expected compatible=%t, got issues %+v", test.compatible, issues)
+			}
+		})
+	}
+}
+
+func TestRegisterModes(t *testing.T) {
+	v1 := []byte(`{"type": "object", "properties": {"a": {"type": "string"}}, "additionalProperties": false}`)
+	v2 := []byte(`{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "string"}}, "additionalProperties": false}`)
+	v3 := []byte(`{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "string"}, "c": {"type": "string"}}, "additionalProperties": false}`)
+
+	// Adding an optional property to a closed object is backward but not forward compatible
+	for mode, compatible := range map[Mode]bool{
+		ModeNone:     true,
+		ModeBackward: true,
+		ModeForward:  false,
+		ModeFull:     false,
+	} {
+		registry := NewRegistry(mode)
+		if _, _, err := registry.Register("orders", v1); err != nil {
+			t.Fatalf("%s: Register failed: %v", mode, err)
+		}
+		if _, _, err := registry.Register("orders", v2); (err == nil) != compatible {
+			t.Errorf("%s: expected compatible=%t, got %v", mode, compatible, err)
+		}
+	}
+
+	// Transitive modes check every earlier version, not only the latest
+	registry := NewRegistry(ModeNone)
+	for _, source := range [][]byte{v3, v1} {
+		if _, _, err := registry.Register("orders", source); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+	}
+	registry.SetMode("orders", ModeBackwardTransitive)
+	if _, _, err := registry.Register("orders", v2); err == nil {
+		t.Error("Expected v2 to be checked against version 1, which allows property c")
+	}
+	registry.SetMode("orders", ModeBackward)
+	if version, _, err := registry.Register("orders", v2); err != nil || version.Number != 3 {
+		t.Errorf("Expected backward compatibility with the latest version only, got %v", err)
+	}
+}
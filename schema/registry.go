@@ -0,0 +1,244 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"pub-sub/models"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Mode is the compatibility check applied when a new schema version is registered
+type Mode string
+
+// Compatibility modes. Backward compatible schemas can read data written with earlier
+// versions, forward compatible schemas write data earlier versions can read. Plain modes
+// check against the latest version, transitive modes against every version.
+const (
+	ModeNone               Mode = "NONE"
+	ModeBackward           Mode = "BACKWARD"
+	ModeBackwardTransitive Mode = "BACKWARD_TRANSITIVE"
+	ModeForward            Mode = "FORWARD"
+	ModeForwardTransitive  Mode = "FORWARD_TRANSITIVE"
+	ModeFull               Mode = "FULL"
+	ModeFullTransitive     Mode = "FULL_TRANSITIVE"
+)
+
+// ParseMode parses a compatibility mode name
+func ParseMode(name string) (Mode, bool) {
+	switch mode := Mode(name); mode {
+	case ModeNone, ModeBackward, ModeBackwardTransitive, ModeForward, ModeForwardTransitive, ModeFull, ModeFullTransitive:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+func (m Mode) backward() bool {
+	return m == ModeBackward || m == ModeBackwardTransitive || m == ModeFull || m == ModeFullTransitive
+}
+
+func (m Mode) forward() bool {
+	return m == ModeForward || m == ModeForwardTransitive || m == ModeFull || m == ModeFullTransitive
+}
+
+func (m Mode) transitive() bool {
+	return m == ModeBackwardTransitive || m == ModeForwardTransitive || m == ModeFullTransitive
+}
+
+// Version is an immutable, registered version of a topic schema
+type Version struct {
+	Number    int             // Version number, starting at 1
+	Source    json.RawMessage // Schema document as registered
+	CreatedAt time.Time       // When the version was registered
+
+	compiled *jsonschema.Schema // Compiled form used for validation
+	document interface{}        // Decoded form used for compatibility checks
+}
+
+// Info converts the version to its API representation
+func (v *Version) Info(topic string) *models.TopicSchema {
+	return &models.TopicSchema{
+		Topic:     topic,
+		Version:   v.Number,
+		Schema:    v.Source,
+		CreatedAt: v.CreatedAt,
+	}
+}
+
+// subject holds the schema versions of one topic
+type subject struct {
+	versions []*Version // Registered versions, oldest first
+	mode     Mode       // Compatibility override; empty uses the registry default
+}
+
+// Registry stores versioned JSON Schemas per topic and checks compatibility between versions
+type Registry struct {
+	subjects    map[string]*subject // Subjects keyed by topic name
+	defaultMode Mode                // Compatibility mode of topics without an override
+	mutex       sync.RWMutex        // Protects subjects
+}
+
+// NewRegistry creates a schema registry with a default compatibility mode
+func NewRegistry(defaultMode Mode) *Registry {
+	return &Registry{
+		subjects:    make(map[string]*subject),
+		defaultMode: defaultMode,
+	}
+}
+
+// Register adds a schema version to a topic after checking it against the topic's
+// compatibility mode. Registering a schema identical to the latest version returns that
+// version, and created is false.
+func (r *Registry) Register(topic string, source json.RawMessage) (version *Version, created bool, err error) {
+	var canonical bytes.Buffer
+	if err := json.Compact(&canonical, source); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", models.ErrInvalidSchema, err)
+	}
+
+	compiled, err := compile(canonical.Bytes())
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", models.ErrInvalidSchema, err)
+	}
+	document, err := decode(canonical.Bytes())
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", models.ErrInvalidSchema, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.subjects[topic]
+	if s == nil {
+		s = &subject{}
+		r.subjects[topic] = s
+	}
+
+	if latest := s.latest(); latest != nil && bytes.Equal(latest.Source, canonical.Bytes()) {
+		return latest, false, nil
+	}
+
+	if err := checkVersions(s.versions, document, r.modeOf(s)); err != nil {
+		return nil, false, err
+	}
+
+	version = &Version{
+		Number:    len(s.versions) + 1,
+		Source:    json.RawMessage(canonical.Bytes()),
+		CreatedAt: time.Now(),
+		compiled:  compiled,
+		document:  document,
+	}
+	s.versions = append(s.versions, version)
+	return version, true, nil
+}
+
+// Latest returns the latest schema version of a topic
+func (r *Registry) Latest(topic string) (*Version, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if latest := r.subjects[topic].latest(); latest != nil {
+		return latest, nil
+	}
+	return nil, models.ErrSchemaNotFound
+}
+
+// Version returns a specific schema version of a topic
+func (r *Registry) Version(topic string, number int) (*Version, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s := r.subjects[topic]
+	if s == nil || len(s.versions) == 0 {
+		return nil, models.ErrSchemaNotFound
+	}
+	if number < 1 || number > len(s.versions) {
+		return nil, models.ErrSchemaVersionNotFound
+	}
+	return s.versions[number-1], nil
+}
+
+// Versions lists the version numbers of a topic's schema together with its compatibility mode
+func (r *Registry) Versions(topic string) ([]int, Mode, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s := r.subjects[topic]
+	if s == nil || len(s.versions) == 0 {
+		return nil, "", models.ErrSchemaNotFound
+	}
+	numbers := make([]int, len(s.versions))
+	for i, version := range s.versions {
+		numbers[i] = version.Number
+	}
+	return numbers, r.modeOf(s), nil
+}
+
+// Mode returns the compatibility mode of a topic
+func (r *Registry) Mode(topic string) Mode {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.modeOf(r.subjects[topic])
+}
+
+// SetMode overrides the compatibility mode of a topic
+func (r *Registry) SetMode(topic string, mode Mode) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.subjects[topic]
+	if s == nil {
+		s = &subject{}
+		r.subjects[topic] = s
+	}
+	s.mode = mode
+}
+
+// Delete removes every schema version and the compatibility override of a topic.
+// It reports whether the topic had a schema.
+func (r *Registry) Delete(topic string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.subjects[topic]
+	delete(r.subjects, topic)
+	return s != nil && len(s.versions) > 0
+}
+
+// Validate checks a payload against a schema version of a topic; version 0 selects the
+// latest. It returns the version used, or 0 when the topic has no schema.
+func (r *Registry) Validate(topic string, number int, payload interface{}) (int, error) {
+	var version *Version
+	var err error
+	if number == 0 {
+		version, err = r.Latest(topic)
+		if err != nil {
+			return 0, nil
+		}
+	} else if version, err = r.Version(topic, number); err != nil {
+		return 0, err
+	}
+
+	return version.Number, version.Validate(payload)
+}
+
+// modeOf returns the compatibility mode of a subject. Must be called with the mutex held.
+func (r *Registry) modeOf(s *subject) Mode {
+	if s == nil || s.mode == "" {
+		return r.defaultMode
+	}
+	return s.mode
+}
+
+// latest returns the newest version of a subject, or nil
+func (s *subject) latest() *Version {
+	if s == nil || len(s.versions) == 0 {
+		return nil
+	}
+	return s.versions[len(s.versions)-1]
+}
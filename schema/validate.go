@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"pub-sub/models"
+	"sort"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Validate checks a payload against the schema version
+func (v *Version) Validate(payload interface{}) error {
+	// Normalize the payload to the JSON data model, whatever encoding it arrived in
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return &models.SchemaError{Violations: []models.SchemaViolation{{Path: "/", Message: err.Error()}}}
+	}
+	document, err := decode(encoded)
+	if err != nil {
+		return &models.SchemaError{Violations: []models.SchemaViolation{{Path: "/", Message: err.Error()}}}
+	}
+
+	if err := v.compiled.Validate(document); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if !errors.As(err, &validationErr) {
+			return err
+		}
+		return &models.SchemaError{Violations: violations(validationErr)}
+	}
+	return nil
+}
+
+// compile compiles a JSON Schema document. References to other documents are not resolved.
+func compile(source []byte) (*jsonschema.Schema, error) {
+	const resource = "schema.json"
+
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external schema references are not supported: %s", url)
+	}
+	if err := compiler.AddResource(resource, bytes.NewReader(source)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(resource)
+}
+
+// decode decodes a JSON document keeping numbers exact
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// violations flattens a validation error into its failing leaf paths
+func violations(err *jsonschema.ValidationError) []models.SchemaViolation {
+	var result []models.SchemaViolation
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			result = append(result, models.SchemaViolation{Path: pointer(e.InstanceLocation), Message: e.Message})
+			return
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(err)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// pointer returns a JSON Pointer, showing the document root as "/"
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
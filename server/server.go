@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -10,11 +11,16 @@ import (
 	"pub-sub/config"
 	"pub-sub/handlers"
 	"pub-sub/logger"
+	"pub-sub/metrics"
 	"pub-sub/middleware"
+	"pub-sub/models"
+	"pub-sub/proto/pubsubpb"
 	"pub-sub/pubsub"
+	"pub-sub/schema"
 	"pub-sub/services"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 )
 
 // Server represents the HTTP server
@@ -25,8 +31,16 @@ type Server struct {
 	httpServer *http.Server
 	router     *mux.Router
 	wsHandler  *handlers.WebSocketHandler
+	sseHandler *handlers.SSEHandler
+	grpcServer *grpc.Server
+	grpcAPI    *handlers.GRPCHandler
+	mqttAPI    *handlers.MQTTHandler
+	redisAPI   *handlers.RedisHandler
+	webhooks   *services.WebhookService
 	mu         sync.RWMutex
 	shutdown   chan struct{}
+	baseCtx    context.Context    // Parent of every request context
+	cancelBase context.CancelFunc // Cancels request contexts so long polls return on shutdown
 }
 
 // NewServer creates a new server instance
@@ -40,6 +54,7 @@ func NewServer(cfg *config.Config, log logger.Logger, pubSub *pubsub.PubSub) *Se
 
 	server.setupRouter()
 	server.setupHTTPServer()
+	server.setupGRPCServer()
 
 	return server
 }
@@ -48,16 +63,38 @@ func NewServer(cfg *config.Config, log logger.Logger, pubSub *pubsub.PubSub) *Se
 func (s *Server) setupRouter() {
 	s.router = mux.NewRouter()
 
-	// Initialize handlers first
-	s.wsHandler = handlers.NewWebSocketHandler(s.pubSub, s.config, s.logger)
+	// Initialize services shared by the WebSocket and REST handlers
+	schemaService := services.NewSchemaService(s.pubSub, schema.NewRegistry(schema.Mode(s.config.SchemaCompatibility)), s.logger)
+	topicService := services.NewTopicService(s.pubSub, schemaService, s.logger)
+	quotaService := services.NewQuotaService(s.pubSub, s.config, s.logger)
+	compression := metrics.NewCompression()
+	rejections := metrics.NewRejections()
+	messageService := services.NewMessageService(s.pubSub, quotaService, schemaService, rejections, s.config, s.logger)
+	s.webhooks = services.NewWebhookService(s.pubSub, quotaService, s.config, s.logger)
 
-	// Initialize services
-	topicService := services.NewTopicService(s.pubSub, s.logger)
-	messageService := services.NewMessageService(s.pubSub, s.logger)
-	systemService := services.NewSystemService(s.pubSub, s.logger, s.wsHandler)
+	// Initialize WebSocket, MQTT and Redis handlers before the system service, which reports their clients
+	s.wsHandler = handlers.NewWebSocketHandler(s.pubSub, messageService, quotaService, schemaService, compression, rejections, s.config, s.logger)
+	clientProviders := []models.ClientProvider{s.wsHandler}
+	if s.config.MQTTEnabled() {
+		s.mqttAPI = handlers.NewMQTTHandler(s.pubSub, topicService, messageService, quotaService, s.config, s.logger)
+		clientProviders = append(clientProviders, s.mqttAPI)
+	}
+	if s.config.RedisEnabled() {
+		s.redisAPI = handlers.NewRedisHandler(s.pubSub, topicService, messageService, quotaService, s.config, s.logger)
+		clientProviders = append(clientProviders, s.redisAPI)
+	}
+	systemService := services.NewSystemService(s.pubSub, quotaService, s.webhooks, compression, rejections, s.logger, clientProviders...)
 
 	// Initialize REST handler
-	restHandler := handlers.NewRestHandler(topicService, messageService, systemService, s.logger)
+	restHandler := handlers.NewRestHandler(topicService, messageService, schemaService, s.webhooks, systemService, quotaService, s.logger)
+
+	// Initialize Server-Sent Events handler
+	s.sseHandler = handlers.NewSSEHandler(s.pubSub, quotaService, s.config, s.logger)
+
+	// Initialize gRPC handler on the same services
+	if s.config.GRPCEnabled() {
+		s.grpcAPI = handlers.NewGRPCHandler(s.pubSub, topicService, messageService, quotaService, schemaService, systemService, s.logger)
+	}
 
 	// WebSocket endpoint
 	s.router.HandleFunc("/ws", s.wsHandler.HandleWebSocket)
@@ -67,15 +104,32 @@ func (s *Server) setupRouter() {
 	s.router.HandleFunc("/topics", restHandler.ListTopics).Methods("GET")
 	s.router.HandleFunc("/topics/{name}", restHandler.GetTopic).Methods("GET")
 	s.router.HandleFunc("/topics/{name}", restHandler.DeleteTopic).Methods("DELETE")
+	s.router.HandleFunc("/topics/{name}/events", s.sseHandler.HandleEvents).Methods("GET")
+	s.router.HandleFunc("/topics/{name}/pull", restHandler.PullMessages).Methods("POST")
+	s.router.HandleFunc("/topics/{name}/schema", restHandler.RegisterSchema).Methods("PUT")
+	s.router.HandleFunc("/topics/{name}/schema", restHandler.GetSchema).Methods("GET")
+	s.router.HandleFunc("/topics/{name}/schema", restHandler.DeleteSchema).Methods("DELETE")
+	s.router.HandleFunc("/topics/{name}/schema/versions", restHandler.ListSchemaVersions).Methods("GET")
+	s.router.HandleFunc("/topics/{name}/schema/versions/{version}", restHandler.GetSchemaVersion).Methods("GET")
+	s.router.HandleFunc("/topics/{name}/schema/compatibility", restHandler.GetSchemaCompatibility).Methods("GET")
+	s.router.HandleFunc("/topics/{name}/schema/compatibility", restHandler.SetSchemaCompatibility).Methods("PUT")
+	s.router.HandleFunc("/webhooks", restHandler.CreateWebhook).Methods("POST")
+	s.router.HandleFunc("/webhooks", restHandler.ListWebhooks).Methods("GET")
+	s.router.HandleFunc("/webhooks/{id}", restHandler.GetWebhook).Methods("GET")
+	s.router.HandleFunc("/webhooks/{id}", restHandler.DeleteWebhook).Methods("DELETE")
 	s.router.HandleFunc("/publish", restHandler.PublishMessage).Methods("POST")
+	s.router.HandleFunc("/publish/batch", restHandler.PublishBatch).Methods("POST")
 	s.router.HandleFunc("/stats", restHandler.GetStats).Methods("GET")
 	s.router.HandleFunc("/stats/{topic}", restHandler.GetTopicStats).Methods("GET")
 	s.router.HandleFunc("/clients", restHandler.GetActiveClients).Methods("GET")
+	s.router.HandleFunc("/quotas", restHandler.GetQuotas).Methods("GET")
 	s.router.HandleFunc("/health", restHandler.GetHealth).Methods("GET")
 
 	// Add middleware
 	s.router.Use(middleware.LoggingMiddleware(s.logger))
 	s.router.Use(middleware.CORSMiddleware())
+	s.router.Use(middleware.CompressionMiddleware(s.config, compression, s.logger))
+	s.router.Use(middleware.BodyLimitMiddleware(s.config, rejections))
 
 	// Add panic recovery middleware
 	s.router.Use(middleware.RecoveryMiddleware(s.logger))
@@ -83,13 +137,26 @@ func (s *Server) setupRouter() {
 
 // setupHTTPServer configures the HTTP server
 func (s *Server) setupHTTPServer() {
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", s.config.Host, s.config.Port),
 		Handler:      s.router,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return s.baseCtx
+		},
+	}
+}
+
+// setupGRPCServer configures the gRPC server, limiting received messages like WebSocket frames
+func (s *Server) setupGRPCServer() {
+	if s.grpcAPI == nil {
+		return
 	}
+	s.grpcServer = grpc.NewServer(grpc.MaxRecvMsgSize(s.config.MaxFrameSize))
+	pubsubpb.RegisterPubSubServer(s.grpcServer, s.grpcAPI)
 }
 
 // Start starts the server in a goroutine
@@ -98,6 +165,45 @@ func (s *Server) Start() error {
 	s.logger.Infof("Configuration: MaxMessagesPerTopic=%d, MaxPublishRate=%d",
 		s.config.MaxMessagesPerTopic, s.config.MaxPublishRate)
 
+	if s.grpcServer != nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", s.config.Host, s.config.GRPCPort))
+		if err != nil {
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+		s.logger.Infof("Starting gRPC server on %s", listener.Addr())
+		go func() {
+			if err := s.grpcServer.Serve(listener); err != nil {
+				s.logger.Errorf("gRPC server stopped: %v", err)
+			}
+		}()
+	}
+
+	if s.mqttAPI != nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", s.config.Host, s.config.MQTTPort))
+		if err != nil {
+			return fmt.Errorf("failed to listen for MQTT: %w", err)
+		}
+		s.logger.Infof("Starting MQTT listener on %s", listener.Addr())
+		go func() {
+			if err := s.mqttAPI.Serve(listener); err != nil {
+				s.logger.Errorf("MQTT listener stopped: %v", err)
+			}
+		}()
+	}
+
+	if s.redisAPI != nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", s.config.Host, s.config.RedisPort))
+		if err != nil {
+			return fmt.Errorf("failed to listen for Redis: %w", err)
+		}
+		s.logger.Infof("Starting Redis listener on %s", listener.Addr())
+		go func() {
+			if err := s.redisAPI.Serve(listener); err != nil {
+				s.logger.Errorf("Redis listener stopped: %v", err)
+			}
+		}()
+	}
+
 	go func() {
 		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			s.logger.Fatalf("Server failed to start: %v", err)
@@ -119,6 +225,42 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.wsHandler.Shutdown(ctx)
 	}
 
+	// End Server-Sent Events streams, which never become idle
+	if s.sseHandler != nil {
+		s.sseHandler.Shutdown()
+	}
+
+	// End pending long polls
+	s.cancelBase()
+
+	// Close MQTT connections; their last wills are not published
+	if s.mqttAPI != nil {
+		s.mqttAPI.Shutdown()
+	}
+
+	// Close Redis connections
+	if s.redisAPI != nil {
+		s.redisAPI.Shutdown()
+	}
+
+	// Stop webhook deliveries, cancelling in-flight requests
+	s.webhooks.Shutdown()
+
+	// End gRPC subscribe streams, then wait for in-flight calls
+	if s.grpcServer != nil {
+		s.grpcAPI.Shutdown()
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpcServer.Stop()
+		}
+	}
+
 	// Attempt graceful shutdown
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		s.logger.Errorf("Server forced to shutdown: %v", err)
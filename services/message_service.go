@@ -1,41 +1,74 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"pub-sub/config"
 	"pub-sub/logger"
+	"pub-sub/metrics"
 	"pub-sub/models"
 	"pub-sub/pubsub"
+	"pub-sub/ratelimit"
+	"time"
 )
 
 // MessageService handles message-related business logic
 type MessageService struct {
-	pubSub *pubsub.PubSub
-	logger logger.Logger
+	pubSub        *pubsub.PubSub
+	config        *config.Config
+	logger        logger.Logger
+	quotas        *QuotaService
+	schemas       *SchemaService
+	rejections    *metrics.Rejections // Messages rejected by size limits
+	topicLimiter  *ratelimit.Limiter  // Publish rate limits per topic
+	clientLimiter *ratelimit.Limiter  // Publish rate limits per client connection or API key
+}
+
+// Publisher identifies the client on whose behalf messages are published
+type Publisher struct {
+	RateKey  string // Rate limiting key: the connection ID or API key
+	QuotaKey string // Quota identity: the API key or remote IP
 }
 
 // NewMessageService creates a new message service
-func NewMessageService(pubSub *pubsub.PubSub, log logger.Logger) *MessageService {
+func NewMessageService(pubSub *pubsub.PubSub, quotas *QuotaService, schemas *SchemaService, rejections *metrics.Rejections, cfg *config.Config, log logger.Logger) *MessageService {
 	return &MessageService{
-		pubSub: pubSub,
-		logger: log,
+		pubSub:       pubSub,
+		config:       cfg,
+		logger:       log,
+		quotas:       quotas,
+		schemas:      schemas,
+		rejections:   rejections,
+		topicLimiter: ratelimit.NewLimiter(cfg.PublishRateForTopic),
+		clientLimiter: ratelimit.NewLimiter(func(string) int {
+			return cfg.MaxClientPublishRate
+		}),
 	}
 }
 
-// PublishMessage publishes a message to a topic
-func (s *MessageService) PublishMessage(topic string, message *models.Message) (*models.PublishResponse, error) {
-	if topic == "" {
-		return nil, models.ErrTopicRequired
+// PublishMessage publishes a message to a topic on behalf of a client
+func (s *MessageService) PublishMessage(publisher Publisher, topic string, message *models.Message) (*models.PublishResponse, error) {
+	if err := validatePublish(topic, message); err != nil {
+		return nil, err
 	}
 
-	if message == nil {
-		return nil, models.ErrMessageRequired
+	size := messageSize(message)
+	if err := s.checkSize(topic, size); err != nil {
+		return nil, err
 	}
 
-	if message.ID == "" {
-		return nil, models.ErrMessageIDRequired
+	if err := s.schemas.Validate(topic, message); err != nil {
+		return nil, err
+	}
+
+	if err := s.admit(publisher, topic, message, size); err != nil {
+		return nil, err
 	}
 
 	if err := s.pubSub.PublishMessage(topic, message); err != nil {
 		s.logger.Errorf("Failed to publish message to topic %s: %v", topic, err)
+		s.cancel(publisher, topic, message)
 		return nil, err
 	}
 
@@ -45,3 +78,235 @@ func (s *MessageService) PublishMessage(topic string, message *models.Message) (
 		Topic:  topic,
 	}, nil
 }
+
+// PublishBatch publishes a batch of messages in order on behalf of a client. Consecutive
+// messages for the same topic are published together under a single topic lock acquisition.
+func (s *MessageService) PublishBatch(publisher Publisher, entries []models.BatchPublishEntry) (*models.BatchPublishResponse, error) {
+	if len(entries) == 0 {
+		return nil, models.ErrBatchEmpty
+	}
+
+	if len(entries) > s.config.MaxBatchSize {
+		return nil, models.ErrBatchTooLarge
+	}
+
+	results := make([]models.BatchPublishResult, len(entries))
+
+	// Collect runs of valid messages for the same topic
+	runTopic := ""
+	runIndexes := make([]int, 0, len(entries))
+	flush := func() {
+		if len(runIndexes) == 0 {
+			return
+		}
+		messages := make([]*models.Message, len(runIndexes))
+		for i, index := range runIndexes {
+			messages[i] = entries[index].Message
+		}
+		err := s.pubSub.PublishMessages(runTopic, messages)
+		if err != nil {
+			s.logger.Errorf("Failed to publish batch of %d messages to topic %s: %v", len(messages), runTopic, err)
+			for _, message := range messages {
+				s.cancel(publisher, runTopic, message)
+			}
+		}
+		for _, index := range runIndexes {
+			if err != nil {
+				results[index].Status = "failed"
+				results[index].Error = &models.Error{Code: err.Error(), Message: err.Error()}
+			} else {
+				results[index].Status = "published"
+			}
+		}
+		runIndexes = runIndexes[:0]
+	}
+
+	for i, entry := range entries {
+		results[i] = models.BatchPublishResult{
+			Index: i,
+			Topic: entry.Topic,
+		}
+		if entry.Message != nil {
+			results[i].MessageID = entry.Message.ID
+		}
+
+		err := validatePublish(entry.Topic, entry.Message)
+		size := 0
+		if err == nil {
+			size = messageSize(entry.Message)
+			err = s.checkSize(entry.Topic, size)
+		}
+		if err == nil {
+			err = s.schemas.Validate(entry.Topic, entry.Message)
+		}
+		if err == nil {
+			err = s.admit(publisher, entry.Topic, entry.Message, size)
+		}
+		if err != nil {
+			results[i].Status = "failed"
+			results[i].Error = &models.Error{Code: err.Error(), Message: err.Error()}
+			var schemaErr *models.SchemaError
+			if errors.As(err, &schemaErr) {
+				results[i].Error.Violations = schemaErr.Violations
+			}
+			continue
+		}
+
+		if entry.Topic != runTopic {
+			flush()
+			runTopic = entry.Topic
+		}
+		runIndexes = append(runIndexes, i)
+	}
+	flush()
+
+	response := &models.BatchPublishResponse{Results: results}
+	for _, result := range results {
+		if result.Status == "published" {
+			response.Published++
+		} else {
+			response.Failed++
+		}
+	}
+
+	switch {
+	case response.Failed == 0:
+		response.Status = "published"
+	case response.Published == 0:
+		response.Status = "failed"
+	default:
+		response.Status = "partial"
+	}
+
+	s.logger.Infof("Batch of %d messages processed: published=%d, failed=%d", len(entries), response.Published, response.Failed)
+	return response, nil
+}
+
+// Pull reads retained messages published after the request cursor. When none are
+// available it waits up to the requested time for one to be published, returning an
+// empty page if none arrives or the context ends.
+func (s *MessageService) Pull(ctx context.Context, topic string, request *models.PullRequest) (*models.PullResponse, error) {
+	if request.MaxMessages < 0 || request.WaitMs < 0 {
+		return nil, models.ErrInvalidRequest
+	}
+
+	maxMessages := request.MaxMessages
+	if maxMessages == 0 || maxMessages > s.config.PullMaxMessages {
+		maxMessages = s.config.PullMaxMessages
+	}
+	wait := min(time.Duration(request.WaitMs)*time.Millisecond, time.Duration(s.config.PullMaxWait)*time.Second)
+
+	var expired <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		result, err := s.pubSub.Pull(topic, request.Cursor, maxMessages)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Messages) == 0 && expired != nil {
+			select {
+			case <-result.Published:
+				continue
+			case <-expired:
+			case <-ctx.Done():
+			}
+		}
+
+		if result.Skipped > 0 {
+			s.logger.Warnf("Pull from topic %s skipped %d evicted messages after cursor %d", topic, result.Skipped, request.Cursor)
+		}
+		messages := result.Messages
+		if messages == nil {
+			messages = []*models.Message{}
+		}
+		return &models.PullResponse{
+			Topic:      topic,
+			Messages:   messages,
+			NextCursor: result.Cursor,
+			Skipped:    result.Skipped,
+			More:       result.Cursor < result.Head,
+		}, nil
+	}
+}
+
+// ForgetClient releases rate limiting state for a client that has disconnected
+func (s *MessageService) ForgetClient(rateKey string) {
+	s.clientLimiter.Forget(rateKey)
+}
+
+// checkSize applies the topic's message size limit to an encoded message size
+func (s *MessageService) checkSize(topic string, size int) error {
+	limit := s.config.MessageSizeForTopic(topic)
+	if size <= limit {
+		return nil
+	}
+
+	s.rejections.RecordMessage()
+	s.logger.Warnf("Message of %d bytes exceeds the %d byte limit of topic %s", size, limit, topic)
+	return &models.MessageSizeError{Size: size, Limit: limit}
+}
+
+// admit applies the rate limits and client quotas to a message of an encoded size about to
+// be published. Tokens taken by a limit are given back if a later check rejects the message.
+func (s *MessageService) admit(publisher Publisher, topic string, message *models.Message, size int) error {
+	if ok, retryAfter := s.clientLimiter.Allow(publisher.RateKey); !ok {
+		s.logger.Warnf("Client %s exceeded publish rate limit", publisher.RateKey)
+		return &models.RateLimitError{Scope: "client", RetryAfter: retryAfter}
+	}
+
+	if ok, retryAfter := s.topicLimiter.Allow(topic); !ok {
+		s.clientLimiter.Refund(publisher.RateKey)
+		s.logger.Warnf("Topic %s exceeded publish rate limit", topic)
+		return &models.RateLimitError{Scope: "topic", RetryAfter: retryAfter}
+	}
+
+	if err := s.quotas.ReservePublish(publisher.QuotaKey, message, size); err != nil {
+		s.clientLimiter.Refund(publisher.RateKey)
+		s.topicLimiter.Refund(topic)
+		return err
+	}
+	return nil
+}
+
+// cancel gives back the rate limit tokens and quota reserved for an admitted message
+// that could not be published
+func (s *MessageService) cancel(publisher Publisher, topic string, message *models.Message) {
+	s.clientLimiter.Refund(publisher.RateKey)
+	s.topicLimiter.Refund(topic)
+	s.quotas.CancelPublish(message)
+}
+
+// messageSize returns the JSON-encoded size of a message in bytes
+func messageSize(message *models.Message) int {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+// validatePublish checks the required fields of a publish request
+func validatePublish(topic string, message *models.Message) error {
+	if topic == "" {
+		return models.ErrTopicRequired
+	}
+
+	if message == nil {
+		return models.ErrMessageRequired
+	}
+
+	if message.ID == "" {
+		return models.ErrMessageIDRequired
+	}
+
+	if _, ok := models.PriorityLevel(message.Priority); !ok {
+		return models.ErrInvalidPriority
+	}
+
+	return nil
+}
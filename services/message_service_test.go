@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"strings"
+	"testing"
+)
+
+func TestMessageSizeLimits(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:  10,
+		MaxPublishRate:       1000,
+		MaxClientPublishRate: 1000,
+		MaxBatchSize:         10,
+		MaxMessageSize:       256,
+		TopicMessageSizes:    map[string]int{"large": 1024},
+		MaxFrameSize:         4096,
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	rejections := metrics.NewRejections()
+	schemas := NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	messages := NewMessageService(ps, NewQuotaService(ps, cfg, log), schemas, rejections, cfg, log)
+	publisher := Publisher{RateKey: "c1", QuotaKey: "c1"}
+
+	for _, topic := range []string{"small", "large"} {
+		if err := ps.CreateTopic(topic); err != nil {
+			t.Fatalf("CreateTopic failed: %v", err)
+		}
+	}
+
+	payload := strings.Repeat("x", 500)
+
+	_, err := messages.PublishMessage(publisher, "small", &models.Message{ID: "m-1", Payload: payload})
+	var sizeErr *models.MessageSizeError
+	if !errors.As(err, &sizeErr) || !errors.Is(err, models.ErrMessageTooLarge) {
+		t.Fatalf("Expected MESSAGE_TOO_LARGE, got %v", err)
+	}
+	if sizeErr.Limit != 256 || sizeErr.Size <= 500 {
+		t.Errorf("Unexpected size error: %+v", sizeErr)
+	}
+
+	// Per-topic limits override the global limit
+	if _, err := messages.PublishMessage(publisher, "large", &models.Message{ID: "m-2", Payload: payload}); err != nil {
+		t.Errorf("Expected the topic override to allow the message, got %v", err)
+	}
+
+	response, err := messages.PublishBatch(publisher, []models.BatchPublishEntry{
+		{Topic: "small", Message: &models.Message{ID: "m-3", Payload: "ok"}},
+		{Topic: "small", Message: &models.Message{ID: "m-4", Payload: payload}},
+	})
+	if err != nil {
+		t.Fatalf("PublishBatch failed: %v", err)
+	}
+	if response.Status != "partial" || response.Results[1].Error == nil || response.Results[1].Error.Code != "MESSAGE_TOO_LARGE" {
+		t.Errorf("Expected the oversized batch entry to fail alone, got %+v", response)
+	}
+
+	if stats := rejections.Snapshot(); stats.MessagesTooLarge != 2 || stats.FramesTooLarge != 0 {
+		t.Errorf("Expected 2 rejected messages, got %+v", stats)
+	}
+}
+
+func TestRejectedPublishKeepsRateBudget(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:       10,
+		MaxPublishRate:            1000,
+		MaxClientPublishRate:      1,
+		MaxBatchSize:              10,
+		MaxMessageSize:            1024,
+		MaxFrameSize:              4096,
+		MaxRetainedBytesPerClient: 100,
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	schemas := NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	messages := NewMessageService(ps, NewQuotaService(ps, cfg, log), schemas, metrics.NewRejections(), cfg, log)
+	publisher := Publisher{RateKey: "c1", QuotaKey: "c1"}
+
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+
+	// Rejections by the quota or a missing topic leave the client's single token unspent
+	if _, err := messages.PublishMessage(publisher, "orders", &models.Message{ID: "m-1", Payload: strings.Repeat("x", 200)}); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Fatalf("Expected QUOTA_EXCEEDED, got %v", err)
+	}
+	if _, err := messages.PublishMessage(publisher, "missing", &models.Message{ID: "m-2", Payload: "ok"}); !errors.Is(err, models.ErrTopicNotFound) {
+		t.Fatalf("Expected TOPIC_NOT_FOUND, got %v", err)
+	}
+	if _, err := messages.PublishMessage(publisher, "orders", &models.Message{ID: "m-3", Payload: "ok"}); err != nil {
+		t.Fatalf("Expected the client's token to be unspent, got %v", err)
+	}
+	if _, err := messages.PublishMessage(publisher, "orders", &models.Message{ID: "m-4", Payload: "ok"}); !errors.Is(err, models.ErrRateLimited) {
+		t.Errorf("Expected the next publish to be rate limited, got %v", err)
+	}
+}
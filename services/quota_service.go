@@ -0,0 +1,354 @@
+package services
+
+import (
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/ratelimit"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaService enforces per-client quotas on connections, subscriptions, webhooks,
+// publish throughput and retained message bytes
+type QuotaService struct {
+	pubSub   *pubsub.PubSub
+	config   *config.Config
+	logger   logger.Logger
+	apiKeys  map[string]bool         // API keys accepted as client identities
+	clients  map[string]*clientQuota // Usage keyed by client identity
+	droppers []RetainedDropper       // Drop retained messages kept outside topic buffers
+	mutex    sync.Mutex              // Protects clients, their usage and droppers
+}
+
+// RetainedDropper drops at least size bytes of a client's oldest retained messages
+// where it can, releasing them with ReleaseRetained, and returns the bytes dropped
+type RetainedDropper func(client string, size int) int
+
+// clientQuota tracks the usage of one client identity
+type clientQuota struct {
+	connections    int
+	subscriptions  int
+	webhooks       int
+	retainedBytes  int
+	publishedBytes int64
+	publishBudget  *ratelimit.TokenBucket // Publish bytes per second
+}
+
+// NewQuotaService creates a new quota service and starts tracking retained message ownership
+func NewQuotaService(pubSub *pubsub.PubSub, cfg *config.Config, log logger.Logger) *QuotaService {
+	s := &QuotaService{
+		pubSub:  pubSub,
+		config:  cfg,
+		logger:  log,
+		apiKeys: make(map[string]bool, len(cfg.APIKeys)),
+		clients: make(map[string]*clientQuota),
+	}
+	for _, apiKey := range cfg.APIKeys {
+		s.apiKeys[apiKey] = true
+	}
+	pubSub.SetReleaseHandler(s.releaseRetained)
+	return s
+}
+
+// ClientKey returns the identity quotas and rate limits are keyed on: the API key if it is
+// one of the configured keys, otherwise the remote host. Unknown keys are ignored so a
+// client cannot escape its limits by rotating keys or spend another client's quota.
+func (s *QuotaService) ClientKey(apiKey, host string) string {
+	if apiKey != "" && s.apiKeys[apiKey] {
+		return "key:" + apiKey
+	}
+	return "ip:" + host
+}
+
+// IsAPIKey reports whether a client identity is a validated API key
+func IsAPIKey(client string) bool {
+	return strings.HasPrefix(client, "key:")
+}
+
+// maskClient hides an API key identity for reports, keeping the first characters of
+// keys long enough to stay secret without them
+func maskClient(client string) string {
+	if !IsAPIKey(client) {
+		return client
+	}
+	prefix := strings.TrimPrefix(client, "key:")
+	if len(prefix) > 8 {
+		return "key:" + prefix[:4] + "***"
+	}
+	return "key:***"
+}
+
+// AcquireConnection reserves a connection slot for a client
+func (s *QuotaService) AcquireConnection(client string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	if limit := s.config.MaxConnectionsPerClient; limit > 0 && usage.connections >= limit {
+		s.logger.Warnf("Client %s exceeded connection quota (%d)", client, limit)
+		return &models.QuotaError{Resource: "connections", Limit: limit}
+	}
+	usage.connections++
+	return nil
+}
+
+// ReleaseConnection frees a connection slot and the subscriptions it held
+func (s *QuotaService) ReleaseConnection(client string, subscriptions int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	usage.connections = max(usage.connections-1, 0)
+	usage.subscriptions = max(usage.subscriptions-subscriptions, 0)
+	s.prune(client)
+}
+
+// AcquireSubscription reserves a subscription slot for a client
+func (s *QuotaService) AcquireSubscription(client string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	if limit := s.config.MaxSubscriptionsPerClient; limit > 0 && usage.subscriptions >= limit {
+		s.logger.Warnf("Client %s exceeded subscription quota (%d)", client, limit)
+		return &models.QuotaError{Resource: "subscriptions", Limit: limit}
+	}
+	usage.subscriptions++
+	return nil
+}
+
+// ReleaseSubscription frees a subscription slot
+func (s *QuotaService) ReleaseSubscription(client string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	usage.subscriptions = max(usage.subscriptions-1, 0)
+	s.prune(client)
+}
+
+// AcquireWebhook reserves a webhook slot for a client
+func (s *QuotaService) AcquireWebhook(client string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	if limit := s.config.MaxWebhooksPerClient; limit > 0 && usage.webhooks >= limit {
+		s.logger.Warnf("Client %s exceeded webhook quota (%d)", client, limit)
+		return &models.QuotaError{Resource: "webhooks", Limit: limit}
+	}
+	usage.webhooks++
+	return nil
+}
+
+// ReleaseWebhook frees a webhook slot
+func (s *QuotaService) ReleaseWebhook(client string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	usage.webhooks = max(usage.webhooks-1, 0)
+	s.prune(client)
+}
+
+// ReservePublish charges a message against the client's publish throughput and
+// retained bytes quotas, stamping the message with its owner and size. A client over
+// its retained bytes quota has its oldest retained messages dropped to make room, so
+// it is only rejected while its own publishes in flight fill the quota.
+func (s *QuotaService) ReservePublish(client string, message *models.Message, size int) error {
+	s.makeRoom(client, size)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+
+	if limit := s.config.MaxRetainedBytesPerClient; limit > 0 && usage.retainedBytes+size > limit {
+		s.logger.Warnf("Client %s exceeded retained bytes quota (%d)", client, limit)
+		return &models.QuotaError{Resource: "retained_bytes", Limit: limit}
+	}
+
+	if usage.publishBudget != nil {
+		if ok, retryAfter := usage.publishBudget.AllowN(time.Now(), size); !ok {
+			s.logger.Warnf("Client %s exceeded publish bytes quota (%d/s)", client, s.config.MaxPublishBytesPerSec)
+			return &models.QuotaError{Resource: "publish_bytes", Limit: s.config.MaxPublishBytesPerSec, RetryAfter: retryAfter}
+		}
+	}
+
+	usage.retainedBytes += size
+	usage.publishedBytes += int64(size)
+	message.Publisher = client
+	message.Size = size
+	return nil
+}
+
+// CancelPublish gives back the publish bytes and retained bytes reserved for a message
+// that was not published
+func (s *QuotaService) CancelPublish(message *models.Message) {
+	if message.Publisher == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	if usage, exists := s.clients[message.Publisher]; exists {
+		if usage.publishBudget != nil {
+			usage.publishBudget.Refund(message.Size)
+		}
+		usage.publishedBytes = max(usage.publishedBytes-int64(message.Size), 0)
+	}
+	s.mutex.Unlock()
+
+	s.releaseRetained("", message)
+}
+
+// AddRetainedDropper registers a store of retained messages outside topic buffers, such
+// as MQTT retained messages, whose bytes are charged with ReserveRetained
+func (s *QuotaService) AddRetainedDropper(dropper RetainedDropper) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.droppers = append(s.droppers, dropper)
+}
+
+// ReserveRetained charges bytes kept outside topic buffers against the client's
+// retained bytes quota, dropping its oldest retained messages to make room
+func (s *QuotaService) ReserveRetained(client string, size int) error {
+	s.makeRoom(client, size)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := s.usage(client)
+	if limit := s.config.MaxRetainedBytesPerClient; limit > 0 && usage.retainedBytes+size > limit {
+		s.logger.Warnf("Client %s exceeded retained bytes quota (%d)", client, limit)
+		s.prune(client)
+		return &models.QuotaError{Resource: "retained_bytes", Limit: limit}
+	}
+	usage.retainedBytes += size
+	return nil
+}
+
+// ReleaseRetained credits back bytes charged with ReserveRetained
+func (s *QuotaService) ReleaseRetained(client string, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if usage, exists := s.clients[client]; exists {
+		usage.retainedBytes = max(usage.retainedBytes-size, 0)
+		s.prune(client)
+	}
+}
+
+// GetQuotas returns the configured limits and current usage per client
+func (s *QuotaService) GetQuotas() *models.QuotaReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	clients := make([]models.QuotaUsage, 0, len(s.clients))
+	for client, usage := range s.clients {
+		available := 0
+		if usage.publishBudget != nil {
+			available = usage.publishBudget.Available(now)
+		}
+		clients = append(clients, models.QuotaUsage{
+			Client:                maskClient(client),
+			Connections:           usage.connections,
+			Subscriptions:         usage.subscriptions,
+			Webhooks:              usage.webhooks,
+			PublishBytesAvailable: available,
+			PublishedBytes:        usage.publishedBytes,
+			RetainedBytes:         usage.retainedBytes,
+		})
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Client < clients[j].Client
+	})
+
+	return &models.QuotaReport{
+		Limits: models.QuotaLimits{
+			MaxConnections:        s.config.MaxConnectionsPerClient,
+			MaxSubscriptions:      s.config.MaxSubscriptionsPerClient,
+			MaxPublishBytesPerSec: s.config.MaxPublishBytesPerSec,
+			MaxRetainedBytes:      s.config.MaxRetainedBytesPerClient,
+			MaxWebhooks:           s.config.MaxWebhooksPerClient,
+		},
+		Clients: clients,
+		Total:   len(clients),
+	}
+}
+
+// releaseRetained credits back the retained bytes of a message leaving a topic buffer
+func (s *QuotaService) releaseRetained(topic string, message *models.Message) {
+	if message.Publisher == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if usage, exists := s.clients[message.Publisher]; exists {
+		usage.retainedBytes = max(usage.retainedBytes-message.Size, 0)
+		s.prune(message.Publisher)
+	}
+}
+
+// makeRoom drops a client's oldest retained messages, from topic buffers first, until
+// size more bytes fit its retained bytes quota. Dropping runs outside the service lock,
+// which releasing the dropped messages takes.
+func (s *QuotaService) makeRoom(client string, size int) {
+	limit := s.config.MaxRetainedBytesPerClient
+	if limit <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	excess := s.usage(client).retainedBytes + size - limit
+	droppers := s.droppers
+	s.mutex.Unlock()
+	if excess <= 0 {
+		return
+	}
+
+	released := s.pubSub.DropPublished(client, excess)
+	for _, dropper := range droppers {
+		if released >= excess {
+			break
+		}
+		released += dropper(client, excess-released)
+	}
+	s.logger.Debugf("Client %s over retained bytes quota, dropped %d retained bytes", client, released)
+}
+
+// usage returns the usage record for a client, creating it if needed.
+// Caller must hold the service lock.
+func (s *QuotaService) usage(client string) *clientQuota {
+	usage, exists := s.clients[client]
+	if !exists {
+		usage = &clientQuota{}
+		if s.config.MaxPublishBytesPerSec > 0 {
+			usage.publishBudget = ratelimit.NewTokenBucket(s.config.MaxPublishBytesPerSec, time.Now())
+		}
+		s.clients[client] = usage
+	}
+	return usage
+}
+
+// prune drops idle usage records whose publish budget has fully refilled.
+// Caller must hold the service lock.
+func (s *QuotaService) prune(client string) {
+	usage, exists := s.clients[client]
+	if !exists {
+		return
+	}
+	if usage.connections > 0 || usage.subscriptions > 0 || usage.webhooks > 0 || usage.retainedBytes > 0 {
+		return
+	}
+	if usage.publishBudget != nil && !usage.publishBudget.Full(time.Now()) {
+		return
+	}
+	delete(s.clients, client)
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/metrics"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"strings"
+	"testing"
+)
+
+// newTestQuotaService creates a quota service over a fresh pub-sub system
+func newTestQuotaService(cfg *config.Config) (*QuotaService, *pubsub.PubSub) {
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	return NewQuotaService(ps, cfg, log), ps
+}
+
+// expectQuotaError fails the test unless err is a quota error for the resource
+func expectQuotaError(t *testing.T, err error, resource string) *models.QuotaError {
+	t.Helper()
+	var quotaErr *models.QuotaError
+	if !errors.As(err, &quotaErr) || !errors.Is(err, models.ErrQuotaExceeded) || err.Error() != "QUOTA_EXCEEDED" {
+		t.Fatalf("Expected QUOTA_EXCEEDED for %s, got %v", resource, err)
+	}
+	if quotaErr.Resource != resource {
+		t.Fatalf("Expected the %s quota to be exceeded, got %s", resource, quotaErr.Resource)
+	}
+	return quotaErr
+}
+
+// usageOf returns the reported usage of a client, or nil if it is not tracked
+func usageOf(quotas *QuotaService, client string) *models.QuotaUsage {
+	for _, usage := range quotas.GetQuotas().Clients {
+		if usage.Client == client {
+			return &usage
+		}
+	}
+	return nil
+}
+
+func TestConnectionAndSubscriptionQuotas(t *testing.T) {
+	quotas, _ := newTestQuotaService(&config.Config{
+		MaxMessagesPerTopic:       10,
+		MaxConnectionsPerClient:   2,
+		MaxSubscriptionsPerClient: 3,
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := quotas.AcquireConnection("ip:10.0.0.1"); err != nil {
+			t.Fatalf("Connection %d within the quota was rejected: %v", i+1, err)
+		}
+	}
+	err := expectQuotaError(t, quotas.AcquireConnection("ip:10.0.0.1"), "connections")
+	if err.Limit != 2 {
+		t.Errorf("Expected limit 2, got %d", err.Limit)
+	}
+	if err := quotas.AcquireConnection("ip:10.0.0.2"); err != nil {
+		t.Errorf("Another client's connection was rejected: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := quotas.AcquireSubscription("ip:10.0.0.1"); err != nil {
+			t.Fatalf("Subscription %d within the quota was rejected: %v", i+1, err)
+		}
+	}
+	expectQuotaError(t, quotas.AcquireSubscription("ip:10.0.0.1"), "subscriptions")
+
+	report := quotas.GetQuotas()
+	if report.Limits.MaxConnections != 2 || report.Limits.MaxSubscriptions != 3 || report.Total != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if usage := usageOf(quotas, "ip:10.0.0.1"); usage == nil || usage.Connections != 2 || usage.Subscriptions != 3 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// Unsubscribing frees a subscription slot
+	quotas.ReleaseSubscription("ip:10.0.0.1")
+	if err := quotas.AcquireSubscription("ip:10.0.0.1"); err != nil {
+		t.Errorf("Subscription after unsubscribing was rejected: %v", err)
+	}
+
+	// Disconnecting frees the connection and the subscriptions it held
+	quotas.ReleaseConnection("ip:10.0.0.1", 2)
+	if usage := usageOf(quotas, "ip:10.0.0.1"); usage == nil || usage.Connections != 1 || usage.Subscriptions != 1 {
+		t.Errorf("Unexpected usage after disconnecting: %+v", usage)
+	}
+	if err := quotas.AcquireConnection("ip:10.0.0.1"); err != nil {
+		t.Errorf("Connection after disconnecting was rejected: %v", err)
+	}
+
+	// Idle clients leave the report
+	quotas.ReleaseConnection("ip:10.0.0.1", 1)
+	quotas.ReleaseConnection("ip:10.0.0.1", 0)
+	if usage := usageOf(quotas, "ip:10.0.0.1"); usage != nil {
+		t.Errorf("Expected the idle client to be dropped, got %+v", usage)
+	}
+}
+
+func TestPublishQuotas(t *testing.T) {
+	quotas, _ := newTestQuotaService(&config.Config{
+		MaxMessagesPerTopic:   10,
+		MaxPublishBytesPerSec: 100,
+	})
+
+	if err := quotas.ReservePublish("c1", &models.Message{ID: "m-1"}, 100); err != nil {
+		t.Fatalf("Publish within the byte budget was rejected: %v", err)
+	}
+	err := expectQuotaError(t, quotas.ReservePublish("c1", &models.Message{ID: "m-2"}, 10), "publish_bytes")
+	if err.Limit != 100 || err.RetryAfter <= 0 {
+		t.Errorf("Expected a retry hint with limit 100, got %+v", err)
+	}
+	if usage := usageOf(quotas, "c1"); usage == nil || usage.PublishedBytes != 100 || usage.PublishBytesAvailable != 0 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// A cancelled publish gives its bytes back to the budget
+	cancelled := &models.Message{ID: "m-3"}
+	if err := quotas.ReservePublish("c2", cancelled, 60); err != nil {
+		t.Fatalf("Publish within the byte budget was rejected: %v", err)
+	}
+	quotas.CancelPublish(cancelled)
+	if usage := usageOf(quotas, "c2"); usage != nil && (usage.PublishedBytes != 0 || usage.PublishBytesAvailable != 100) {
+		t.Errorf("Expected the cancelled bytes to be refunded, got %+v", usage)
+	}
+	if err := quotas.ReservePublish("c2", &models.Message{ID: "m-4"}, 100); err != nil {
+		t.Errorf("Publish after cancelling was rejected: %v", err)
+	}
+
+	quotas, _ = newTestQuotaService(&config.Config{
+		MaxMessagesPerTopic:       10,
+		MaxRetainedBytesPerClient: 150,
+	})
+
+	first := &models.Message{ID: "m-1"}
+	if err := quotas.ReservePublish("c1", first, 100); err != nil {
+		t.Fatalf("Publish within the retained quota was rejected: %v", err)
+	}
+	if first.Publisher != "c1" || first.Size != 100 {
+		t.Errorf("Expected the message to be stamped with its owner and size, got %q/%d", first.Publisher, first.Size)
+	}
+	err = expectQuotaError(t, quotas.ReservePublish("c1", &models.Message{ID: "m-2"}, 51), "retained_bytes")
+	if err.RetryAfter != 0 {
+		t.Errorf("Expected no retry hint for retained bytes, got %v", err.RetryAfter)
+	}
+	if err := quotas.ReservePublish("c1", &models.Message{ID: "m-3"}, 50); err != nil {
+		t.Fatalf("Publish filling the retained quota was rejected: %v", err)
+	}
+
+	// Cancelled publishes give their bytes back
+	quotas.CancelPublish(first)
+	if usage := usageOf(quotas, "c1"); usage == nil || usage.RetainedBytes != 50 {
+		t.Errorf("Expected 50 retained bytes after cancelling, got %+v", usage)
+	}
+	if err := quotas.ReservePublish("c1", &models.Message{ID: "m-4"}, 100); err != nil {
+		t.Errorf("Publish after cancelling was rejected: %v", err)
+	}
+}
+
+func TestRetainedQuotaReleasedOnEviction(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:       2,
+		MaxPublishRate:            1000,
+		MaxClientPublishRate:      1000,
+		MaxMessageSize:            1024,
+		MaxRetainedBytesPerClient: 4096,
+	}
+	quotas, ps := newTestQuotaService(cfg)
+	log := logger.NewLogger("error", "text")
+	schemas := NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	messages := NewMessageService(ps, quotas, schemas, metrics.NewRejections(), cfg, log)
+	publisher := Publisher{RateKey: "c1", QuotaKey: "c1"}
+
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+	published := []*models.Message{{ID: "m-1", Payload: "a"}, {ID: "m-2", Payload: "bb"}, {ID: "m-3", Payload: "ccc"}}
+	for i, message := range published {
+		if _, err := messages.PublishMessage(publisher, "orders", message); err != nil {
+			t.Fatalf("Publish %d failed: %v", i+1, err)
+		}
+	}
+
+	// The topic keeps two messages; the evicted one no longer counts against the publisher
+	usage := usageOf(quotas, "c1")
+	if retained := published[1].Size + published[2].Size; usage == nil || usage.RetainedBytes != retained {
+		t.Errorf("Expected %d retained bytes, got %+v", retained, usage)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	quotas, _ := newTestQuotaService(&config.Config{
+		MaxMessagesPerTopic:     10,
+		MaxConnectionsPerClient: 1,
+		APIKeys:                 []string{"secret-key-123", "short"},
+	})
+
+	if key := quotas.ClientKey("secret-key-123", "10.0.0.1"); key != "key:secret-key-123" || !IsAPIKey(key) {
+		t.Errorf("Expected the configured key to identify the client, got %s", key)
+	}
+
+	// Unknown keys cannot be rotated to escape the quota of the remote host
+	for _, apiKey := range []string{"", "made-up-1", "made-up-2"} {
+		key := quotas.ClientKey(apiKey, "10.0.0.1")
+		if key != "ip:10.0.0.1" || IsAPIKey(key) {
+			t.Fatalf("Expected key %q to fall back to the remote IP, got %s", apiKey, key)
+		}
+		if apiKey == "" {
+			if err := quotas.AcquireConnection(key); err != nil {
+				t.Fatalf("AcquireConnection failed: %v", err)
+			}
+			continue
+		}
+		expectQuotaError(t, quotas.AcquireConnection(key), "connections")
+	}
+
+	// Keys are masked in the report
+	if err := quotas.AcquireConnection(quotas.ClientKey("secret-key-123", "10.0.0.1")); err != nil {
+		t.Fatalf("AcquireConnection failed: %v", err)
+	}
+	if err := quotas.AcquireConnection(quotas.ClientKey("short", "10.0.0.1")); err != nil {
+		t.Fatalf("AcquireConnection failed: %v", err)
+	}
+	var clients []string
+	for _, usage := range quotas.GetQuotas().Clients {
+		clients = append(clients, usage.Client)
+	}
+	if len(clients) != 3 || clients[0] != "ip:10.0.0.1" || clients[1] != "key:***" || clients[2] != "key:secr***" {
+		t.Errorf("Unexpected report clients: %v", clients)
+	}
+}
+
+func TestRetainedQuotaDropsOldestMessages(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:       100,
+		MaxPublishRate:            1000,
+		MaxClientPublishRate:      1000,
+		MaxMessageSize:            1024,
+		MaxRetainedBytesPerClient: 1024,
+	}
+	quotas, ps := newTestQuotaService(cfg)
+	log := logger.NewLogger("error", "text")
+	schemas := NewSchemaService(ps, schema.NewRegistry(schema.ModeNone), log)
+	messages := NewMessageService(ps, quotas, schemas, metrics.NewRejections(), cfg, log)
+
+	for _, topic := range []string{"orders", "audit"} {
+		if err := ps.CreateTopic(topic); err != nil {
+			t.Fatalf("CreateTopic failed: %v", err)
+		}
+	}
+	if _, err := messages.PublishMessage(Publisher{RateKey: "c2", QuotaKey: "c2"}, "orders", &models.Message{ID: "other", Payload: "x"}); err != nil {
+		t.Fatalf("Publish by another client failed: %v", err)
+	}
+
+	// A client publishing far past its quota keeps being accepted
+	payload := strings.Repeat("x", 200)
+	for i := 0; i < 50; i++ {
+		topic := []string{"orders", "audit"}[i%2]
+		if _, err := messages.PublishMessage(Publisher{RateKey: "c1", QuotaKey: "c1"}, topic, &models.Message{ID: fmt.Sprintf("m-%d", i), Payload: payload}); err != nil {
+			t.Fatalf("Publish %d past the retained quota was rejected: %v", i+1, err)
+		}
+		if usage := usageOf(quotas, "c1"); usage == nil || usage.RetainedBytes > cfg.MaxRetainedBytesPerClient {
+			t.Fatalf("Expected retained bytes within the quota after publish %d, got %+v", i+1, usage)
+		}
+	}
+
+	// Only its newest messages remain; other clients' messages are kept
+	result, err := ps.Pull("orders", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Messages) < 2 || result.Messages[0].ID != "other" || result.Messages[len(result.Messages)-1].ID != "m-48" || result.Cursor != 26 {
+		t.Errorf("Expected the other client's message and c1's newest messages, got %d messages ending at cursor %d", len(result.Messages), result.Cursor)
+	}
+	if len(result.Messages) > 1+cfg.MaxRetainedBytesPerClient/200 {
+		t.Errorf("Expected c1's oldest messages to be dropped, got %d messages", len(result.Messages))
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"encoding/json"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"strconv"
+)
+
+// SchemaService manages the versioned JSON Schemas of topics and validates payloads against them
+type SchemaService struct {
+	pubSub   *pubsub.PubSub
+	registry *schema.Registry
+	logger   logger.Logger
+}
+
+// NewSchemaService creates a new schema service
+func NewSchemaService(pubSub *pubsub.PubSub, registry *schema.Registry, log logger.Logger) *SchemaService {
+	return &SchemaService{
+		pubSub:   pubSub,
+		registry: registry,
+		logger:   log,
+	}
+}
+
+// RegisterSchema registers a new version of a topic's schema. It reports whether a new
+// version was created, or the schema matched the latest version.
+func (s *SchemaService) RegisterSchema(topic string, source json.RawMessage) (*models.TopicSchema, bool, error) {
+	if topic == "" {
+		return nil, false, models.ErrTopicRequired
+	}
+
+	if _, err := s.pubSub.GetTopicStats(topic); err != nil {
+		return nil, false, err
+	}
+
+	version, created, err := s.registry.Register(topic, source)
+	if err != nil {
+		s.logger.Warnf("Schema rejected for topic %s: %v", topic, err)
+		return nil, false, err
+	}
+
+	if created {
+		s.logger.Infof("Schema version %d registered for topic %s", version.Number, topic)
+	}
+	return version.Info(topic), created, nil
+}
+
+// GetSchema returns the latest schema version of a topic
+func (s *SchemaService) GetSchema(topic string) (*models.TopicSchema, error) {
+	version, err := s.registry.Latest(topic)
+	if err != nil {
+		return nil, err
+	}
+	return version.Info(topic), nil
+}
+
+// GetSchemaVersion returns a specific schema version of a topic
+func (s *SchemaService) GetSchemaVersion(topic string, number int) (*models.TopicSchema, error) {
+	version, err := s.registry.Version(topic, number)
+	if err != nil {
+		return nil, err
+	}
+	return version.Info(topic), nil
+}
+
+// ListVersions lists the schema versions registered for a topic
+func (s *SchemaService) ListVersions(topic string) (*models.SchemaVersionList, error) {
+	versions, mode, err := s.registry.Versions(topic)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SchemaVersionList{
+		Topic:         topic,
+		Compatibility: string(mode),
+		Versions:      versions,
+	}, nil
+}
+
+// GetCompatibility returns the compatibility mode of a topic
+func (s *SchemaService) GetCompatibility(topic string) (*models.SchemaCompatibility, error) {
+	if _, err := s.pubSub.GetTopicStats(topic); err != nil {
+		return nil, err
+	}
+	return &models.SchemaCompatibility{
+		Topic:         topic,
+		Compatibility: string(s.registry.Mode(topic)),
+	}, nil
+}
+
+// SetCompatibility sets the compatibility mode checked when registering a topic's schemas
+func (s *SchemaService) SetCompatibility(topic, compatibility string) (*models.SchemaCompatibility, error) {
+	mode, ok := schema.ParseMode(compatibility)
+	if !ok {
+		return nil, models.ErrInvalidCompatibility
+	}
+
+	if _, err := s.pubSub.GetTopicStats(topic); err != nil {
+		return nil, err
+	}
+
+	s.registry.SetMode(topic, mode)
+	s.logger.Infof("Schema compatibility of topic %s set to %s", topic, mode)
+	return &models.SchemaCompatibility{
+		Topic:         topic,
+		Compatibility: string(mode),
+	}, nil
+}
+
+// DeleteSchema removes every schema version from a topic
+func (s *SchemaService) DeleteSchema(topic string) error {
+	if !s.registry.Delete(topic) {
+		return models.ErrSchemaNotFound
+	}
+
+	s.logger.Infof("Schema removed from topic %s", topic)
+	return nil
+}
+
+// RemoveTopic drops the schemas of a deleted topic so a recreated topic starts without one
+func (s *SchemaService) RemoveTopic(topic string) {
+	s.registry.Delete(topic)
+}
+
+// CheckVersion checks that a topic has a schema version, for subscribers reading it
+func (s *SchemaService) CheckVersion(topic string, number int) error {
+	_, err := s.registry.Version(topic, number)
+	return err
+}
+
+// Validate checks a message payload against the topic's schema and stamps the version
+// used into the message headers. A publisher may pin a version with the schema version
+// header; otherwise the latest version is used. Topics without a schema accept any payload.
+func (s *SchemaService) Validate(topic string, message *models.Message) error {
+	number := 0
+	if requested, exists := message.Headers[models.HeaderSchemaVersion]; exists {
+		parsed, err := strconv.Atoi(requested)
+		if err != nil || parsed < 1 {
+			return models.ErrSchemaVersionNotFound
+		}
+		number = parsed
+	}
+
+	version, err := s.registry.Validate(topic, number, message.Payload)
+	if err != nil {
+		if models.IsErrorType(err, models.ErrSchemaViolation) {
+			s.logger.Warnf("Payload rejected by schema version %d of topic %s", version, topic)
+		}
+		return err
+	}
+
+	if version > 0 {
+		if message.Headers == nil {
+			message.Headers = make(map[string]string)
+		}
+		message.Headers[models.HeaderSchemaVersion] = strconv.Itoa(version)
+	}
+	return nil
+}
+
+// Readable reports whether a subscriber reading a schema version can read a message:
+// either it was validated against that version or its payload also conforms to it
+func (s *SchemaService) Readable(topic string, number int, message *models.Message) bool {
+	if message.Headers[models.HeaderSchemaVersion] == strconv.Itoa(number) {
+		return true
+	}
+	version, err := s.registry.Version(topic, number)
+	if err != nil {
+		return false
+	}
+	return version.Validate(message.Payload) == nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/schema"
+	"testing"
+)
+
+func TestSchemaValidation(t *testing.T) {
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(&config.Config{MaxMessagesPerTopic: 10}, log)
+	schemas := NewSchemaService(ps, schema.NewRegistry(schema.ModeBackward), log)
+
+	if _, _, err := schemas.RegisterSchema("orders", json.RawMessage(`{}`)); !errors.Is(err, models.ErrTopicNotFound) {
+		t.Errorf("Expected TOPIC_NOT_FOUND for a missing topic, got %v", err)
+	}
+
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+
+	if _, _, err := schemas.RegisterSchema("orders", json.RawMessage(`{"type": 5}`)); !errors.Is(err, models.ErrInvalidSchema) {
+		t.Errorf("Expected INVALID_SCHEMA, got %v", err)
+	}
+
+	schemaV1 := `{
+		"type": "object",
+		"required": ["order_id"],
+		"properties": {
+			"amount": {"type": "number", "minimum": 0},
+			"items": {"type": "array", "items": {"type": "string"}}
+		}
+	}`
+	if _, _, err := schemas.RegisterSchema("orders", json.RawMessage(schemaV1)); err != nil {
+		t.Fatalf("RegisterSchema failed: %v", err)
+	}
+
+	valid := &models.Message{ID: "m-1", Payload: map[string]interface{}{"order_id": "ORD-1", "amount": 3}}
+	if err := schemas.Validate("orders", valid); err != nil {
+		t.Errorf("Expected valid payload to pass, got %v", err)
+	}
+	if valid.Headers[models.HeaderSchemaVersion] != "1" {
+		t.Errorf("Expected schema version 1 to be stamped, got %v", valid.Headers)
+	}
+
+	invalid := &models.Message{ID: "m-2", Payload: map[string]interface{}{"amount": -1, "items": []interface{}{"a", 2}}}
+	err := schemas.Validate("orders", invalid)
+	var schemaErr *models.SchemaError
+	if !errors.As(err, &schemaErr) || !errors.Is(err, models.ErrSchemaViolation) {
+		t.Fatalf("Expected a schema error, got %v", err)
+	}
+
+	expected := []string{"/", "/amount", "/items/1"}
+	if len(schemaErr.Violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %+v", len(expected), schemaErr.Violations)
+	}
+	for i, path := range expected {
+		if schemaErr.Violations[i].Path != path {
+			t.Errorf("Expected violation %d at %s, got %s", i, path, schemaErr.Violations[i].Path)
+		}
+	}
+
+	// Deleting the topic drops the schema
+	schemas.RemoveTopic("orders")
+	if _, err := schemas.GetSchema("orders"); !errors.Is(err, models.ErrSchemaNotFound) {
+		t.Errorf("Expected SCHEMA_NOT_FOUND after topic removal, got %v", err)
+	}
+	invalid.Headers = nil
+	if err := schemas.Validate("orders", invalid); err != nil || invalid.Headers != nil {
+		t.Errorf("Expected topics without a schema to accept any payload unstamped, got %v", err)
+	}
+}
+
+func TestSchemaVersions(t *testing.T) {
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(&config.Config{MaxMessagesPerTopic: 10}, log)
+	schemas := NewSchemaService(ps, schema.NewRegistry(schema.ModeBackward), log)
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+
+	register := func(source string) (*models.TopicSchema, bool, error) {
+		return schemas.RegisterSchema("orders", json.RawMessage(source))
+	}
+
+	v1 := `{"type": "object", "required": ["order_id"], "properties": {"order_id": {"type": "string"}, "amount": {"type": "integer"}}}`
+	if info, created, err := register(v1); err != nil || !created || info.Version != 1 {
+		t.Fatalf("Expected version 1 to be created, got %+v %v %v", info, created, err)
+	}
+
+	// Re-registering the latest schema is idempotent
+	if info, created, err := register(v1); err != nil || created || info.Version != 1 {
+		t.Errorf("Expected version 1 to be returned unchanged, got %+v %v %v", info, created, err)
+	}
+
+	// Widening a type and dropping a requirement is backward compatible
+	v2 := `{"type": "object", "properties": {"order_id": {"type": "string"}, "amount": {"type": "number"}}}`
+	if info, created, err := register(v2); err != nil || !created || info.Version != 2 {
+		t.Fatalf("Expected version 2 to be created, got %+v %v %v", info, created, err)
+	}
+
+	// Requiring a new property is not
+	v3 := `{"type": "object", "required": ["currency"], "properties": {"order_id": {"type": "string"}, "amount": {"type": "number"}}}`
+	_, _, err := register(v3)
+	var compatibilityErr *models.CompatibilityError
+	if !errors.As(err, &compatibilityErr) || compatibilityErr.Version != 2 || len(compatibilityErr.Issues) == 0 {
+		t.Fatalf("Expected an incompatibility with version 2, got %v", err)
+	}
+
+	if _, err := schemas.SetCompatibility("orders", "SIDEWAYS"); !errors.Is(err, models.ErrInvalidCompatibility) {
+		t.Errorf("Expected INVALID_COMPATIBILITY, got %v", err)
+	}
+	if _, err := schemas.SetCompatibility("orders", "NONE"); err != nil {
+		t.Fatalf("SetCompatibility failed: %v", err)
+	}
+	if info, _, err := register(v3); err != nil || info.Version != 3 {
+		t.Fatalf("Expected version 3 without compatibility checks, got %+v %v", info, err)
+	}
+
+	list, err := schemas.ListVersions("orders")
+	if err != nil || len(list.Versions) != 3 || list.Compatibility != "NONE" {
+		t.Errorf("Unexpected version list: %+v %v", list, err)
+	}
+
+	// Publishers may pin an earlier version
+	pinned := &models.Message{
+		ID:      "m-1",
+		Payload: map[string]interface{}{"order_id": "ORD-1", "amount": 2.5},
+		Headers: map[string]string{models.HeaderSchemaVersion: "1"},
+	}
+	if err := schemas.Validate("orders", pinned); !errors.Is(err, models.ErrSchemaViolation) {
+		t.Errorf("Expected version 1 to reject a fractional amount, got %v", err)
+	}
+	pinned.Headers[models.HeaderSchemaVersion] = "2"
+	if err := schemas.Validate("orders", pinned); err != nil {
+		t.Errorf("Expected version 2 to accept the payload, got %v", err)
+	}
+	pinned.Headers[models.HeaderSchemaVersion] = "9"
+	if err := schemas.Validate("orders", pinned); !errors.Is(err, models.ErrSchemaVersionNotFound) {
+		t.Errorf("Expected SCHEMA_VERSION_NOT_FOUND, got %v", err)
+	}
+
+	// Subscribers reading version 1 only receive payloads conforming to it
+	latest := &models.Message{ID: "m-2", Payload: map[string]interface{}{"order_id": "ORD-2", "amount": 2.5, "currency": "EUR"}}
+	if err := schemas.Validate("orders", latest); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if schemas.Readable("orders", 1, latest) {
+		t.Error("Expected version 1 readers to skip a fractional amount")
+	}
+	if !schemas.Readable("orders", 3, latest) || !schemas.Readable("orders", 2, latest) {
+		t.Error("Expected versions 2 and 3 to read the message")
+	}
+}
@@ -2,23 +2,39 @@ package services
 
 import (
 	"pub-sub/logger"
+	"pub-sub/metrics"
 	"pub-sub/models"
 	"pub-sub/pubsub"
 )
 
 // SystemService handles system-related operations
 type SystemService struct {
-	pubSub           *pubsub.PubSub
-	logger           logger.Logger
-	wsClientProvider models.WebSocketClientProvider
+	pubSub          *pubsub.PubSub
+	quotas          *QuotaService
+	webhooks        *WebhookService
+	compression     *metrics.Compression
+	rejections      *metrics.Rejections
+	logger          logger.Logger
+	clientProviders []models.ClientProvider // WebSocket and MQTT frontends reporting their clients
 }
 
 // NewSystemService creates a new system service
-func NewSystemService(pubSub *pubsub.PubSub, log logger.Logger, wsProvider models.WebSocketClientProvider) *SystemService {
+func NewSystemService(pubSub *pubsub.PubSub, quotas *QuotaService, webhooks *WebhookService, compression *metrics.Compression, rejections *metrics.Rejections, log logger.Logger, clientProviders ...models.ClientProvider) *SystemService {
+	providers := make([]models.ClientProvider, 0, len(clientProviders))
+	for _, provider := range clientProviders {
+		if provider != nil {
+			providers = append(providers, provider)
+		}
+	}
+
 	return &SystemService{
-		pubSub:           pubSub,
-		logger:           log,
-		wsClientProvider: wsProvider,
+		pubSub:          pubSub,
+		quotas:          quotas,
+		webhooks:        webhooks,
+		compression:     compression,
+		rejections:      rejections,
+		logger:          log,
+		clientProviders: providers,
 	}
 }
 
@@ -29,13 +45,18 @@ func (s *SystemService) GetStats() *models.Stats {
 	s.logger.Debugf("Raw stats from pubsub: TotalTopics=%d, TotalMessages=%d, TotalSubscribers=%d",
 		stats.TotalTopics, stats.TotalMessages, stats.TotalSubscribers)
 
-	// Override ActiveConnections with actual WebSocket connection count
-	if s.wsClientProvider != nil {
-		activeClients := s.wsClientProvider.GetActiveClients()
-		stats.ActiveConnections = len(activeClients)
-		s.logger.Debugf("Updated ActiveConnections to %d based on WebSocket clients", stats.ActiveConnections)
+	// Override ActiveConnections with actual WebSocket and MQTT connection count
+	if len(s.clientProviders) > 0 {
+		stats.ActiveConnections = len(s.activeClients())
+		s.logger.Debugf("Updated ActiveConnections to %d based on connected clients", stats.ActiveConnections)
 	} else {
-		s.logger.Warn("WebSocket client provider not available, using pubsub subscriber count for ActiveConnections")
+		s.logger.Warn("Client providers not available, using pubsub subscriber count for ActiveConnections")
+	}
+
+	stats.Compression = s.compression.Snapshot()
+	stats.Rejected = s.rejections.Snapshot()
+	if s.webhooks != nil {
+		stats.Webhooks = s.webhooks.DeliveryStats()
 	}
 
 	s.logger.Debugf("Final stats: TotalTopics=%d, TotalMessages=%d, TotalSubscribers=%d, ActiveConnections=%d",
@@ -62,21 +83,37 @@ func (s *SystemService) GetTopicStats(topicName string) (*models.TopicStats, err
 	return stats, nil
 }
 
-// GetActiveClients returns information about all active WebSocket clients
+// GetActiveClients returns information about all active WebSocket and MQTT clients
 func (s *SystemService) GetActiveClients() *models.ClientList {
-	if s.wsClientProvider == nil {
-		s.logger.Warn("WebSocket client provider not available")
+	if len(s.clientProviders) == 0 {
+		s.logger.Warn("Client providers not available")
 		return &models.ClientList{
 			Clients: []models.ClientInfo{},
 			Total:   0,
 		}
 	}
 
-	clients := s.wsClientProvider.GetActiveClients()
-	s.logger.Debugf("Retrieved %d active WebSocket clients", len(clients))
+	clients := s.activeClients()
+	s.logger.Debugf("Retrieved %d active clients", len(clients))
 
 	return &models.ClientList{
 		Clients: clients,
 		Total:   len(clients),
 	}
 }
+
+// activeClients collects the clients of every protocol frontend
+func (s *SystemService) activeClients() []models.ClientInfo {
+	clients := []models.ClientInfo{}
+	for _, provider := range s.clientProviders {
+		clients = append(clients, provider.GetActiveClients()...)
+	}
+	return clients
+}
+
+// GetQuotas returns the configured client quotas and current usage
+func (s *SystemService) GetQuotas() *models.QuotaReport {
+	report := s.quotas.GetQuotas()
+	s.logger.Debugf("Retrieved quota usage for %d clients", report.Total)
+	return report
+}
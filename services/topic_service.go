@@ -9,15 +9,17 @@ import (
 
 // TopicService handles topic-related business logic
 type TopicService struct {
-	pubSub *pubsub.PubSub
-	logger logger.Logger
+	pubSub  *pubsub.PubSub
+	schemas *SchemaService
+	logger  logger.Logger
 }
 
 // NewTopicService creates a new topic service
-func NewTopicService(pubSub *pubsub.PubSub, log logger.Logger) *TopicService {
+func NewTopicService(pubSub *pubsub.PubSub, schemas *SchemaService, log logger.Logger) *TopicService {
 	return &TopicService{
-		pubSub: pubSub,
-		logger: log,
+		pubSub:  pubSub,
+		schemas: schemas,
+		logger:  log,
 	}
 }
 
@@ -49,6 +51,7 @@ func (s *TopicService) DeleteTopic(name string) (*models.TopicResponse, error) {
 		s.logger.Errorf("Failed to delete topic %s: %v", name, err)
 		return nil, err
 	}
+	s.schemas.RemoveTopic(name)
 
 	s.logger.Infof("Topic %s deleted successfully", name)
 	return &models.TopicResponse{
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/utils"
+	"pub-sub/webhook"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookMaxBackoff caps the wait between retries of one message
+const webhookMaxBackoff = 30 * time.Second
+
+// WebhookService manages webhook push subscriptions. Each webhook is a credit-mode
+// subscriber granting itself one credit per finished delivery, so undelivered messages
+// wait in the topic's retained log while the endpoint is slow or its circuit is open.
+type WebhookService struct {
+	pubSub   *pubsub.PubSub
+	quotas   *QuotaService
+	guard    *webhook.Guard // Keeps deliveries away from internal addresses
+	client   *http.Client
+	config   *config.Config
+	logger   logger.Logger
+	webhooks map[string]*webhookState // Registered webhooks keyed by ID
+	mutex    sync.RWMutex             // Protects webhooks
+	wg       sync.WaitGroup           // Tracks delivery goroutines
+}
+
+// webhookState is a registered webhook and its delivery status
+type webhookState struct {
+	info         models.Webhook
+	owner        string            // Client identity charged for the webhook
+	headers      map[string]string // Extra request headers, kept out of info so they are never returned
+	secret       string
+	subscriberID string
+	ctx          context.Context    // Cancelled when the webhook is removed
+	cancel       context.CancelFunc // Stops delivery
+	breaker      *webhook.Breaker
+	delivery     models.WebhookDelivery // Counters; Circuit and ConsecutiveFailures come from the breaker
+	mutex        sync.Mutex             // Protects breaker and delivery
+}
+
+// NewWebhookService creates a new webhook service and registers it for topic changes, so
+// the webhooks of a deleted topic are removed with it
+func NewWebhookService(pubSub *pubsub.PubSub, quotas *QuotaService, cfg *config.Config, log logger.Logger) *WebhookService {
+	guard := webhook.NewGuard(cfg.WebhookAllowedHosts)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Every connection is checked after resolution, including redirects. Proxies are not
+	// used since the guard would only see the proxy's address.
+	transport.Proxy = nil
+	transport.DialContext = guard.DialContext(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+
+	s := &WebhookService{
+		pubSub:   pubSub,
+		quotas:   quotas,
+		guard:    guard,
+		client:   &http.Client{Transport: transport, Timeout: time.Duration(cfg.WebhookTimeout) * time.Second},
+		config:   cfg,
+		logger:   log,
+		webhooks: make(map[string]*webhookState),
+	}
+	pubSub.AddTopicHandler(s.topicChanged)
+	return s
+}
+
+// CreateWebhook registers a webhook owned by a client and starts pushing the topic's new
+// messages to it
+func (s *WebhookService) CreateWebhook(client string, request *models.WebhookRequest) (*models.Webhook, error) {
+	if request.Topic == "" {
+		return nil, models.ErrTopicRequired
+	}
+	if err := s.validateWebhook(request); err != nil {
+		return nil, err
+	}
+	if err := s.quotas.AcquireWebhook(client); err != nil {
+		return nil, err
+	}
+
+	headerNames := make([]string, 0, len(request.Headers))
+	for name := range request.Headers {
+		headerNames = append(headerNames, http.CanonicalHeaderKey(name))
+	}
+	sort.Strings(headerNames)
+
+	id := utils.GenerateClientID()
+	ctx, cancel := context.WithCancel(context.Background())
+	hook := &webhookState{
+		info: models.Webhook{
+			ID:          id,
+			Topic:       request.Topic,
+			URL:         request.URL,
+			HeaderNames: headerNames,
+			Signed:      request.Secret != "",
+			CreatedAt:   time.Now(),
+		},
+		owner:        client,
+		headers:      request.Headers,
+		secret:       request.Secret,
+		subscriberID: "webhook-" + id,
+		ctx:          ctx,
+		cancel:       cancel,
+		breaker:      webhook.NewBreaker(s.config.WebhookBreakerThreshold, time.Duration(s.config.WebhookBreakerCooldown)*time.Second),
+		delivery:     models.WebhookDelivery{Topic: request.Topic},
+	}
+
+	err := s.pubSub.SubscribeWithOptions(hook.subscriberID, request.Topic, pubsub.SubscribeOptions{CreditMode: true, Credits: 1})
+	if err != nil {
+		cancel()
+		s.pubSub.RemoveSubscriber(hook.subscriberID)
+		s.quotas.ReleaseWebhook(client)
+		s.logger.Errorf("Failed to subscribe webhook for topic %s: %v", request.Topic, err)
+		return nil, err
+	}
+	messages := s.pubSub.GetSubscriberChannel(hook.subscriberID)
+	if messages == nil {
+		cancel()
+		s.quotas.ReleaseWebhook(client)
+		return nil, models.ErrSubscriberNotFound
+	}
+
+	s.mutex.Lock()
+	s.webhooks[id] = hook
+	s.mutex.Unlock()
+
+	s.wg.Add(1)
+	go s.run(hook, messages)
+
+	s.logger.Infof("Webhook %s registered for topic %s", id, request.Topic)
+	return hook.snapshot(), nil
+}
+
+// validateWebhook checks the target URL and extra headers of a webhook request. Hosts
+// resolving to internal addresses are refused unless allowed.
+func (s *WebhookService) validateWebhook(request *models.WebhookRequest) error {
+	target, err := url.Parse(request.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", models.ErrInvalidWebhook)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.WebhookTimeout)*time.Second)
+	defer cancel()
+	if err := s.guard.Check(ctx, target.Hostname()); err != nil {
+		if errors.Is(err, webhook.ErrBlockedAddress) {
+			return fmt.Errorf("%w: url must not target a loopback, private or link-local address", models.ErrInvalidWebhook)
+		}
+		return fmt.Errorf("%w: url host %s does not resolve", models.ErrInvalidWebhook, target.Hostname())
+	}
+
+	for name := range request.Headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if canonical == "" || strings.HasPrefix(canonical, "X-Pubsub-") ||
+			canonical == "Content-Type" || canonical == "Content-Length" || canonical == "Host" {
+			return fmt.Errorf("%w: header %q is reserved", models.ErrInvalidWebhook, name)
+		}
+	}
+	return nil
+}
+
+// DeleteWebhook stops and removes a webhook
+func (s *WebhookService) DeleteWebhook(id string) error {
+	s.mutex.Lock()
+	hook, exists := s.webhooks[id]
+	delete(s.webhooks, id)
+	s.mutex.Unlock()
+
+	if !exists {
+		return models.ErrWebhookNotFound
+	}
+	s.stop(hook)
+	s.logger.Infof("Webhook %s deleted", id)
+	return nil
+}
+
+// GetWebhook returns a webhook with its delivery status
+func (s *WebhookService) GetWebhook(id string) (*models.Webhook, error) {
+	s.mutex.RLock()
+	hook, exists := s.webhooks[id]
+	s.mutex.RUnlock()
+
+	if !exists {
+		return nil, models.ErrWebhookNotFound
+	}
+	return hook.snapshot(), nil
+}
+
+// ListWebhooks returns all webhooks, oldest first
+func (s *WebhookService) ListWebhooks() *models.WebhookList {
+	s.mutex.RLock()
+	webhooks := make([]models.Webhook, 0, len(s.webhooks))
+	for _, hook := range s.webhooks {
+		webhooks = append(webhooks, *hook.snapshot())
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return &models.WebhookList{Webhooks: webhooks, Total: len(webhooks)}
+}
+
+// DeliveryStats returns the delivery status of every webhook keyed by ID
+func (s *WebhookService) DeliveryStats() map[string]models.WebhookDelivery {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats := make(map[string]models.WebhookDelivery, len(s.webhooks))
+	for id, hook := range s.webhooks {
+		stats[id] = hook.snapshot().Delivery
+	}
+	return stats
+}
+
+// Shutdown stops all deliveries and waits for in-flight requests to be cancelled
+func (s *WebhookService) Shutdown() {
+	s.mutex.Lock()
+	webhooks := s.webhooks
+	s.webhooks = make(map[string]*webhookState)
+	s.mutex.Unlock()
+
+	for _, hook := range webhooks {
+		s.stop(hook)
+	}
+	s.wg.Wait()
+}
+
+// stop cancels a webhook's delivery, removes its subscriber and frees its owner's quota slot
+func (s *WebhookService) stop(hook *webhookState) {
+	hook.cancel()
+	s.pubSub.RemoveSubscriber(hook.subscriberID)
+	s.quotas.ReleaseWebhook(hook.owner)
+}
+
+// topicChanged removes the webhooks of a deleted topic
+func (s *WebhookService) topicChanged(topic string, created bool) {
+	if created {
+		return
+	}
+
+	s.mutex.Lock()
+	var removed []*webhookState
+	for id, hook := range s.webhooks {
+		if hook.info.Topic == topic {
+			removed = append(removed, hook)
+			delete(s.webhooks, id)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, hook := range removed {
+		s.stop(hook)
+		s.logger.Infof("Webhook %s removed with topic %s", hook.info.ID, topic)
+	}
+}
+
+// run delivers a webhook's events one at a time, granting the next credit once each
+// delivery has succeeded or been given up
+func (s *WebhookService) run(hook *webhookState, messages <-chan *models.ServerMessage) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-hook.ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			switch message.Type {
+			case "event":
+				if message.Message == nil {
+					continue
+				}
+				if !s.deliver(hook, message) {
+					return
+				}
+				if err := s.pubSub.GrantCredits(hook.subscriberID, hook.info.Topic, 1); err != nil {
+					s.logger.Debugf("Webhook %s stopped receiving topic %s: %v", hook.info.ID, hook.info.Topic, err)
+				}
+			case "info":
+				if message.Msg == "messages_skipped" {
+					hook.mutex.Lock()
+					hook.delivery.Overruns++
+					hook.mutex.Unlock()
+					s.logger.Warnf("Webhook %s fell behind topic %s and skipped messages", hook.info.ID, hook.info.Topic)
+				}
+			}
+		}
+	}
+}
+
+// deliver POSTs one event, retrying failures with exponential backoff. A half-open
+// circuit allows a single trial attempt. It returns false if the webhook was stopped.
+func (s *WebhookService) deliver(hook *webhookState, message *models.ServerMessage) bool {
+	// An open circuit holds deliveries until its cooldown ends
+	for {
+		hook.mutex.Lock()
+		wait := hook.breaker.Wait(time.Now())
+		trial := hook.breaker.State() == webhook.StateHalfOpen
+		hook.mutex.Unlock()
+		if wait == 0 {
+			return s.attempt(hook, message, trial)
+		}
+		if !s.sleep(hook, wait) {
+			return false
+		}
+	}
+}
+
+// attempt makes the delivery attempts of one event and records the outcome. It returns
+// false if the webhook was stopped.
+func (s *WebhookService) attempt(hook *webhookState, message *models.ServerMessage, trial bool) bool {
+	body, err := json.Marshal(&models.WebhookEvent{
+		WebhookID: hook.info.ID,
+		Topic:     message.Topic,
+		Message:   message.Message,
+		TS:        message.TS,
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to encode event for webhook %s: %v", hook.info.ID, err)
+		return true
+	}
+
+	backoff := time.Duration(s.config.WebhookRetryBackoff) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		statusCode, retryAfter, err := s.post(hook, message, body, attempt)
+		if hook.ctx.Err() != nil {
+			return false
+		}
+
+		now := time.Now()
+		hook.mutex.Lock()
+		hook.delivery.LastAttemptAt = &now
+		hook.delivery.LastStatusCode = statusCode
+		if err == nil {
+			hook.delivery.Delivered++
+			hook.delivery.LastError = ""
+			hook.delivery.LastSuccessAt = &now
+			hook.breaker.Record(true, now)
+			hook.mutex.Unlock()
+			return true
+		}
+		hook.delivery.LastError = err.Error()
+
+		if trial || !retryable(statusCode) || attempt > s.config.WebhookMaxRetries {
+			hook.delivery.Failed++
+			hook.breaker.Record(false, now)
+			state := hook.breaker.State()
+			hook.mutex.Unlock()
+
+			s.logger.Warnf("Webhook %s dropped message %s after %d attempts: %v", hook.info.ID, message.Message.ID, attempt, err)
+			if state == webhook.StateOpen {
+				s.logger.Warnf("Webhook %s circuit opened for %d seconds", hook.info.ID, s.config.WebhookBreakerCooldown)
+			}
+			return true
+		}
+		hook.delivery.Retries++
+		hook.mutex.Unlock()
+
+		wait := max(webhook.Backoff(attempt, backoff, webhookMaxBackoff), min(retryAfter, webhookMaxBackoff))
+		s.logger.Debugf("Webhook %s attempt %d failed, retrying in %v: %v", hook.info.ID, attempt, wait, err)
+		if !s.sleep(hook, wait) {
+			return false
+		}
+	}
+}
+
+// post sends one delivery request. It returns the response status code, any Retry-After
+// wait the endpoint asked for, and an error unless the endpoint answered 2xx.
+func (s *WebhookService) post(hook *webhookState, message *models.ServerMessage, body []byte, attempt int) (int, time.Duration, error) {
+	request, err := http.NewRequestWithContext(hook.ctx, http.MethodPost, hook.info.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	for name, value := range hook.headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhook.HeaderID, hook.info.ID)
+	request.Header.Set(webhook.HeaderTopic, message.Topic)
+	request.Header.Set(webhook.HeaderMessageID, message.Message.ID)
+	request.Header.Set(webhook.HeaderAttempt, strconv.Itoa(attempt))
+	if hook.secret != "" {
+		timestamp := time.Now().Unix()
+		request.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		request.Header.Set(webhook.HeaderSignature, webhook.Sign(hook.secret, timestamp, body))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response.StatusCode, 0, nil
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return response.StatusCode, retryAfter, fmt.Errorf("endpoint responded %s", response.Status)
+}
+
+// retryable reports whether a failed attempt is worth retrying: network errors, timeouts,
+// rate limiting and server errors are; other client errors are not
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// sleep waits unless the webhook is stopped first, reporting whether it is still running
+func (s *WebhookService) sleep(hook *webhookState, wait time.Duration) bool {
+	if wait <= 0 {
+		return hook.ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-hook.ctx.Done():
+		return false
+	}
+}
+
+// snapshot returns the webhook with its current delivery status
+func (h *webhookState) snapshot() *models.Webhook {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	info := h.info
+	info.Delivery = h.delivery
+	info.Delivery.Circuit = h.breaker.State()
+	info.Delivery.ConsecutiveFailures = h.breaker.Failures()
+	return &info
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pub-sub/config"
+	"pub-sub/logger"
+	"pub-sub/models"
+	"pub-sub/pubsub"
+	"pub-sub/webhook"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls a condition until it holds or the test times out
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:     10,
+		DefaultQueueSize:        10,
+		MaxQueueSize:            100,
+		WebhookTimeout:          5,
+		WebhookMaxRetries:       3,
+		WebhookRetryBackoff:     1,
+		WebhookBreakerThreshold: 2,
+		WebhookBreakerCooldown:  60,
+		WebhookAllowedHosts:     []string{"127.0.0.1"},
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	webhooks := NewWebhookService(ps, NewQuotaService(ps, cfg, log), cfg, log)
+	defer webhooks.Shutdown()
+
+	// The endpoint fails the first two attempts, then records what it receives
+	var mutex sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	attempts := 0
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		if attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, r)
+		bodies = append(bodies, body)
+	}))
+	defer endpoint.Close()
+
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "orders", URL: "ftp://example.com"}); !errors.Is(err, models.ErrInvalidWebhook) {
+		t.Errorf("Expected INVALID_WEBHOOK for a non-HTTP URL, got %v", err)
+	}
+	if _, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "missing", URL: endpoint.URL}); !errors.Is(err, models.ErrTopicNotFound) {
+		t.Errorf("Expected TOPIC_NOT_FOUND, got %v", err)
+	}
+
+	hook, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{
+		Topic:   "orders",
+		URL:     endpoint.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Secret:  "secret",
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+
+	// Header values are credentials and are never returned
+	encoded, _ := json.Marshal(webhooks.ListWebhooks())
+	if strings.Contains(string(encoded), "Bearer token") || len(hook.HeaderNames) != 1 || hook.HeaderNames[0] != "Authorization" {
+		t.Errorf("Expected only the header names to be returned, got %s", encoded)
+	}
+
+	for _, id := range []string{"m-1", "m-2"} {
+		if err := ps.PublishMessage("orders", &models.Message{ID: id, Payload: map[string]interface{}{"id": id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "both messages to be delivered", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 2
+	})
+
+	// Messages arrive in order, signed and carrying the registered headers
+	mutex.Lock()
+	for i, request := range received {
+		var event models.WebhookEvent
+		if err := json.Unmarshal(bodies[i], &event); err != nil {
+			t.Fatalf("Invalid event body: %v", err)
+		}
+		if event.WebhookID != hook.ID || event.Topic != "orders" || event.Message.ID != request.Header.Get(webhook.HeaderMessageID) {
+			t.Errorf("Unexpected event %+v", event)
+		}
+		timestamp, _ := strconv.ParseInt(request.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if request.Header.Get(webhook.HeaderSignature) != webhook.Sign("secret", timestamp, bodies[i]) {
+			t.Error("Expected a valid signature")
+		}
+		if request.Header.Get("Authorization") != "Bearer token" {
+			t.Error("Expected the registered Authorization header")
+		}
+	}
+	if received[0].Header.Get(webhook.HeaderMessageID) != "m-1" || received[0].Header.Get(webhook.HeaderAttempt) != "3" {
+		t.Errorf("Expected m-1 on its third attempt first, got %s attempt %s",
+			received[0].Header.Get(webhook.HeaderMessageID), received[0].Header.Get(webhook.HeaderAttempt))
+	}
+	mutex.Unlock()
+
+	delivery := webhooks.DeliveryStats()[hook.ID]
+	if delivery.Delivered != 2 || delivery.Retries != 2 || delivery.Failed != 0 || delivery.Circuit != webhook.StateClosed {
+		t.Errorf("Unexpected delivery status: %+v", delivery)
+	}
+
+	// An endpoint rejecting every message opens the circuit after the threshold
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	broken, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "orders", URL: failing.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"m-3", "m-4", "m-5"} {
+		if err := ps.PublishMessage("orders", &models.Message{ID: id, Payload: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the circuit to open", func() bool {
+		status, _ := webhooks.GetWebhook(broken.ID)
+		return status.Delivery.Circuit == webhook.StateOpen
+	})
+	status, _ := webhooks.GetWebhook(broken.ID)
+	if status.Delivery.Failed != 2 || status.Delivery.Retries != 0 || status.Delivery.LastStatusCode != http.StatusBadRequest {
+		t.Errorf("Expected two failed messages without retries, got %+v", status.Delivery)
+	}
+
+	// Deleting the topic removes its webhooks
+	if err := ps.DeleteTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if list := webhooks.ListWebhooks(); list.Total != 0 {
+		t.Errorf("Expected webhooks to be removed with their topic, got %+v", list)
+	}
+}
+
+func TestWebhookTargetsAndQuota(t *testing.T) {
+	cfg := &config.Config{
+		MaxMessagesPerTopic:     10,
+		DefaultQueueSize:        10,
+		MaxQueueSize:            100,
+		MaxWebhooksPerClient:    1,
+		WebhookTimeout:          5,
+		WebhookMaxRetries:       0,
+		WebhookRetryBackoff:     1,
+		WebhookBreakerThreshold: 5,
+		WebhookBreakerCooldown:  60,
+		WebhookAllowedHosts:     []string{"10.1.0.0/16"},
+	}
+	log := logger.NewLogger("error", "text")
+	ps := pubsub.NewPubSub(cfg, log)
+	quotas := NewQuotaService(ps, cfg, log)
+	webhooks := NewWebhookService(ps, quotas, cfg, log)
+	defer webhooks.Shutdown()
+
+	if err := ps.CreateTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Internal addresses are refused unless allowed
+	for _, target := range []string{"http://localhost:8080/", "http://127.0.0.1/", "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/", "http://[::1]/"} {
+		if _, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "orders", URL: target}); !errors.Is(err, models.ErrInvalidWebhook) {
+			t.Errorf("Expected INVALID_WEBHOOK for %s, got %v", target, err)
+		}
+	}
+	hook, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "orders", URL: "http://10.1.2.3/hooks"})
+	if err != nil {
+		t.Fatalf("Webhook to an allowed network was rejected: %v", err)
+	}
+
+	// Each client owns a limited number of webhooks
+	_, err = webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "orders", URL: "http://10.1.2.4/hooks"})
+	if quotaErr := expectQuotaError(t, err, "webhooks"); quotaErr.Limit != 1 {
+		t.Errorf("Expected limit 1, got %d", quotaErr.Limit)
+	}
+	if usage := usageOf(quotas, "c1"); usage == nil || usage.Webhooks != 1 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+	if _, err := webhooks.CreateWebhook("c2", &models.WebhookRequest{Topic: "orders", URL: "http://10.1.2.4/hooks"}); err != nil {
+		t.Errorf("Another client's webhook was rejected: %v", err)
+	}
+
+	// Deleting a webhook frees its slot
+	if err := webhooks.DeleteWebhook(hook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := webhooks.CreateWebhook("c1", &models.WebhookRequest{Topic: "orders", URL: "http://10.1.2.4/hooks"}); err != nil {
+		t.Errorf("Webhook after deleting was rejected: %v", err)
+	}
+
+	// Delivery connections are checked after resolution as well
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer endpoint.Close()
+	request, _ := http.NewRequest(http.MethodPost, endpoint.URL, nil)
+	if _, err := webhooks.client.Do(request); !errors.Is(err, webhook.ErrBlockedAddress) {
+		t.Errorf("Expected the delivery connection to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package stomp implements STOMP 1.2 frames as carried over WebSocket by the STOMP
+// frontend. Each WebSocket message holds one or more frames.
+package stomp
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Subprotocol is the WebSocket subprotocol of STOMP 1.2
+const Subprotocol = "v12.stomp"
+
+// Client frame commands
+const (
+	CommandConnect     = "CONNECT"
+	CommandStomp       = "STOMP"
+	CommandSend        = "SEND"
+	CommandSubscribe   = "SUBSCRIBE"
+	CommandUnsubscribe = "UNSUBSCRIBE"
+	CommandAck         = "ACK"
+	CommandNack        = "NACK"
+	CommandBegin       = "BEGIN"
+	CommandCommit      = "COMMIT"
+	CommandAbort       = "ABORT"
+	CommandDisconnect  = "DISCONNECT"
+)
+
+// Server frame commands
+const (
+	CommandConnected = "CONNECTED"
+	CommandMessage   = "MESSAGE"
+	CommandReceipt   = "RECEIPT"
+	CommandError     = "ERROR"
+)
+
+// ErrMalformed reports data that is not a well-formed STOMP frame
+var ErrMalformed = errors.New("malformed STOMP frame")
+
+// Frame is a STOMP frame. Repeated headers keep their first value.
+type Frame struct {
+	Command string
+	Headers map[string]string
+	Body    []byte
+}
+
+// NewFrame creates a frame with headers given as name, value pairs
+func NewFrame(command string, headers ...string) *Frame {
+	frame := &Frame{Command: command, Headers: make(map[string]string, len(headers)/2)}
+	for i := 0; i+1 < len(headers); i += 2 {
+		frame.Headers[headers[i]] = headers[i+1]
+	}
+	return frame
+}
+
+// Parse decodes the frames of a WebSocket message. Heart-beat end-of-lines between
+// frames are skipped, so a message holding only a heart-beat yields no frames.
+func Parse(data []byte) ([]*Frame, error) {
+	var frames []*Frame
+	for {
+		data = skipEOLs(data)
+		if len(data) == 0 {
+			return frames, nil
+		}
+
+		frame, rest, err := parseFrame(data)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+		data = rest
+	}
+}
+
+// parseFrame decodes one frame and returns the data following it
+func parseFrame(data []byte) (*Frame, []byte, error) {
+	line, data, ok := cutLine(data)
+	if !ok || line == "" {
+		return nil, nil, ErrMalformed
+	}
+	frame := &Frame{Command: line, Headers: make(map[string]string)}
+
+	// CONNECT and CONNECTED headers are not escaped, for STOMP 1.0 compatibility
+	escaped := frame.Command != CommandConnect && frame.Command != CommandConnected
+	for {
+		line, data, ok = cutLine(data)
+		if !ok {
+			return nil, nil, ErrMalformed
+		}
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, nil, ErrMalformed
+		}
+		if escaped {
+			var err error
+			if name, err = unescape(name); err != nil {
+				return nil, nil, err
+			}
+			if value, err = unescape(value); err != nil {
+				return nil, nil, err
+			}
+		}
+		if _, exists := frame.Headers[name]; !exists {
+			frame.Headers[name] = value
+		}
+	}
+
+	// The body runs to content-length octets if given, otherwise to the first NUL
+	end := bytes.IndexByte(data, 0)
+	if value, exists := frame.Headers["content-length"]; exists {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 || length >= len(data) || data[length] != 0 {
+			return nil, nil, ErrMalformed
+		}
+		end = length
+	}
+	if end < 0 {
+		return nil, nil, ErrMalformed
+	}
+	frame.Body = data[:end]
+	return frame, data[end+1:], nil
+}
+
+// Encode returns the frame in wire format with a content-length header. Headers are
+// written in name order.
+func (f *Frame) Encode() []byte {
+	names := make([]string, 0, len(f.Headers))
+	for name := range f.Headers {
+		if name != "content-length" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	escaped := f.Command != CommandConnect && f.Command != CommandConnected
+	var buffer bytes.Buffer
+	buffer.WriteString(f.Command)
+	buffer.WriteByte('\n')
+	for _, name := range names {
+		value := f.Headers[name]
+		if escaped {
+			name, value = escape(name), escape(value)
+		}
+		buffer.WriteString(name)
+		buffer.WriteByte(':')
+		buffer.WriteString(value)
+		buffer.WriteByte('\n')
+	}
+	if len(f.Body) > 0 || f.Command == CommandSend || f.Command == CommandMessage {
+		buffer.WriteString("content-length:")
+		buffer.WriteString(strconv.Itoa(len(f.Body)))
+		buffer.WriteByte('\n')
+	}
+	buffer.WriteByte('\n')
+	buffer.Write(f.Body)
+	buffer.WriteByte(0)
+	return buffer.Bytes()
+}
+
+// cutLine splits off a line ending in LF or CRLF
+func cutLine(data []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return "", nil, false
+	}
+	return string(bytes.TrimSuffix(data[:i], []byte{'\r'})), data[i+1:], true
+}
+
+// skipEOLs skips heart-beat end-of-lines
+func skipEOLs(data []byte) []byte {
+	return bytes.TrimLeft(data, "\r\n")
+}
+
+var escaper = strings.NewReplacer("\\", `\\`, "\r", `\r`, "\n", `\n`, ":", `\c`)
+
+// escape encodes a header name or value
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// unescape decodes a header name or value, rejecting undefined escape sequences
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			builder.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", ErrMalformed
+		}
+		switch s[i] {
+		case 'r':
+			builder.WriteByte('\r')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'c':
+			builder.WriteByte(':')
+		case '\\':
+			builder.WriteByte('\\')
+		default:
+			return "", ErrMalformed
+		}
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,52 @@
+package stomp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frame := NewFrame(CommandSend, "destination", "/topic/orders", "note", "a:b\nc\\d")
+	frame.Body = []byte("hello\x00world")
+
+	frames, err := Parse(frame.Encode())
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("Failed to parse encoded frame: %v %v", frames, err)
+	}
+	frame.Headers["content-length"] = "11"
+	if !reflect.DeepEqual(frames[0], frame) {
+		t.Errorf("Round trip mismatch: got %+v, want %+v", frames[0], frame)
+	}
+}
+
+func TestParse(t *testing.T) {
+	// Heart-beats, CRLF line endings, repeated headers and several frames per message
+	data := []byte("\n\r\nCONNECT\r\naccept-version:1.2\r\nhost:a\\cb\r\n\r\n\x00\n" +
+		"SEND\ndestination:orders\ndestination:ignored\n\n{\"id\":1}\x00\n\n")
+	frames, err := Parse(data)
+	if err != nil || len(frames) != 2 {
+		t.Fatalf("Expected two frames, got %v %v", frames, err)
+	}
+	if frames[0].Command != CommandConnect || frames[0].Headers["host"] != `a\cb` {
+		t.Errorf("Expected unescaped CONNECT headers, got %+v", frames[0])
+	}
+	if frames[1].Headers["destination"] != "orders" || string(frames[1].Body) != `{"id":1}` {
+		t.Errorf("Unexpected SEND frame: %+v", frames[1])
+	}
+
+	if frames, err := Parse([]byte("\n")); err != nil || len(frames) != 0 {
+		t.Errorf("Expected a heart-beat to yield no frames, got %v %v", frames, err)
+	}
+
+	for _, malformed := range []string{
+		"SEND\ndestination:orders\n\nno terminator",
+		"SEND\nno-colon\n\n\x00",
+		"SEND\nbad:\\t\n\n\x00",
+		"SEND\ncontent-length:10\n\nshort\x00",
+	} {
+		if _, err := Parse([]byte(malformed)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Expected ErrMalformed for %q, got %v", malformed, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned for webhook targets on internal addresses
+var ErrBlockedAddress = errors.New("webhook target address is not allowed")
+
+// Guard keeps webhooks from reaching internal services. Loopback, private, link-local,
+// multicast and unspecified addresses are blocked unless their host name, address or
+// network is allowed.
+type Guard struct {
+	hosts    map[string]bool // Allowed host names and addresses
+	networks []*net.IPNet    // Allowed networks
+}
+
+// NewGuard creates a guard allowing the given host names, IP addresses and CIDR ranges.
+// Invalid CIDR ranges are ignored.
+func NewGuard(allowed []string) *Guard {
+	g := &Guard{hosts: make(map[string]bool)}
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				g.networks = append(g.networks, network)
+			}
+			continue
+		}
+		g.hosts[strings.ToLower(entry)] = true
+	}
+	return g
+}
+
+// Blocked reports whether an address is internal: loopback, private, link-local,
+// multicast or unspecified
+func Blocked(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// AllowedHost reports whether a host name or address is allowed regardless of the
+// addresses it resolves to
+func (g *Guard) AllowedHost(host string) bool {
+	return g.hosts[strings.ToLower(host)]
+}
+
+// CheckIP returns ErrBlockedAddress for an internal address outside the allowed networks
+func (g *Guard) CheckIP(ip net.IP) error {
+	if !Blocked(ip) || g.hosts[ip.String()] {
+		return nil
+	}
+	for _, network := range g.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+}
+
+// Check resolves a host and returns ErrBlockedAddress if any of its addresses is blocked
+func (g *Guard) Check(ctx context.Context, host string) error {
+	if g.AllowedHost(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return g.CheckIP(ip)
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if err := g.CheckIP(address.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DialContext dials like net.Dialer, refusing connections to blocked addresses. The
+// address is checked after resolution, so a host name cannot be re-pointed at an
+// internal address after the webhook was registered.
+func (g *Guard) DialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+		}
+		return g.CheckIP(ip)
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && g.AllowedHost(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
@@ -0,0 +1,106 @@
+// Package webhook implements the delivery policy of webhook push subscriptions: request
+// signing, retry backoff, a circuit breaker that pauses deliveries to failing endpoints
+// and a guard keeping deliveries away from internal addresses.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Headers set on every delivery request
+const (
+	HeaderID        = "X-PubSub-Webhook-Id"
+	HeaderTopic     = "X-PubSub-Topic"
+	HeaderMessageID = "X-PubSub-Message-Id"
+	HeaderAttempt   = "X-PubSub-Delivery-Attempt"
+	HeaderTimestamp = "X-PubSub-Timestamp"
+	HeaderSignature = "X-PubSub-Signature"
+)
+
+// Sign returns the signature header value of a request body: the hex HMAC-SHA256 of
+// the Unix timestamp, a '.' and the body, keyed with the webhook secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the wait before retry attempt n (1 for the first retry): base doubled
+// for each earlier retry, capped at max
+func Backoff(n int, base, max time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < n && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+// Circuit breaker states
+const (
+	StateClosed   = "closed"    // Deliveries flow normally
+	StateOpen     = "open"      // Deliveries are paused until the cooldown ends
+	StateHalfOpen = "half_open" // One trial delivery decides whether to close or reopen
+)
+
+// Breaker is a circuit breaker counting consecutive failed deliveries. It is not safe
+// for concurrent use.
+type Breaker struct {
+	threshold int           // Consecutive failures that open the circuit
+	cooldown  time.Duration // How long the circuit stays open
+	failures  int           // Current run of consecutive failures
+	state     string        // Current state
+	openedAt  time.Time     // When the circuit last opened
+}
+
+// NewBreaker creates a closed circuit breaker
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: StateClosed}
+}
+
+// Wait returns how long deliveries must wait for an open circuit. Once the cooldown
+// has passed the circuit becomes half-open and Wait returns zero.
+func (b *Breaker) Wait(now time.Time) time.Duration {
+	if b.state != StateOpen {
+		return 0
+	}
+	if remaining := b.openedAt.Add(b.cooldown).Sub(now); remaining > 0 {
+		return remaining
+	}
+	b.state = StateHalfOpen
+	return 0
+}
+
+// Record records the outcome of a delivery. A success closes the circuit; a failure
+// opens it from half-open, or from closed once the threshold is reached.
+func (b *Breaker) Record(success bool, now time.Time) {
+	if success {
+		b.failures = 0
+		b.state = StateClosed
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = now
+	}
+}
+
+// State returns the current state
+func (b *Breaker) State() string {
+	return b.state
+}
+
+// Failures returns the current run of consecutive failures
+func (b *Breaker) Failures() int {
+	return b.failures
+}
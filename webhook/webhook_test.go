@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"id":"1"}`))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("secret", 1700000000, []byte(`{"id":"1"}`)); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if Sign("other", 1700000000, []byte(`{"id":"1"}`)) == want {
+		t.Error("Signatures with different secrets should differ")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, want := range expected {
+		if got := Backoff(i+1, base, max); got != want*time.Millisecond {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, want*time.Millisecond)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewBreaker(2, time.Minute)
+
+	breaker.Record(false, now)
+	if breaker.State() != StateClosed || breaker.Wait(now) != 0 {
+		t.Fatal("One failure should not open the circuit")
+	}
+	breaker.Record(false, now)
+	if breaker.State() != StateOpen || breaker.Wait(now.Add(time.Second)) != 59*time.Second {
+		t.Fatalf("Two failures should open the circuit, got %s", breaker.State())
+	}
+
+	// After the cooldown one trial delivery is allowed; its failure reopens the circuit
+	if wait := breaker.Wait(now.Add(time.Minute)); wait != 0 || breaker.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open after the cooldown, got %s waiting %v", breaker.State(), wait)
+	}
+	breaker.Record(false, now.Add(time.Minute))
+	if breaker.State() != StateOpen {
+		t.Fatalf("A failed trial should reopen the circuit, got %s", breaker.State())
+	}
+
+	// A successful trial closes it
+	breaker.Wait(now.Add(2 * time.Minute))
+	breaker.Record(true, now.Add(2*time.Minute))
+	if breaker.State() != StateClosed || breaker.Failures() != 0 {
+		t.Errorf("A successful trial should close the circuit, got %s with %d failures", breaker.State(), breaker.Failures())
+	}
+}
+
+func TestGuard(t *testing.T) {
+	guard := NewGuard([]string{"hooks.internal", "10.1.0.0/16", "127.0.0.2"})
+
+	blocked := []string{"127.0.0.1", "::1", "10.0.0.1", "192.168.1.1", "172.16.0.1", "169.254.169.254", "fe80::1", "0.0.0.0", "::ffff:127.0.0.1"}
+	for _, address := range blocked {
+		if err := guard.CheckIP(net.ParseIP(address)); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Expected %s to be blocked, got %v", address, err)
+		}
+	}
+	allowed := []string{"93.184.216.34", "2606:2800:220:1::1", "10.1.2.3", "127.0.0.2"}
+	for _, address := range allowed {
+		if err := guard.CheckIP(net.ParseIP(address)); err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", address, err)
+		}
+	}
+
+	ctx := context.Background()
+	if err := guard.Check(ctx, "localhost"); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected localhost to be blocked, got %v", err)
+	}
+	if err := guard.Check(ctx, "HOOKS.internal"); err != nil {
+		t.Errorf("Expected the allowed host name to be accepted, got %v", err)
+	}
+
+	// Connections are checked after resolution
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	dial := guard.DialContext(&net.Dialer{Timeout: time.Second})
+	if conn, err := dial(ctx, "tcp", listener.Addr().String()); !errors.Is(err, ErrBlockedAddress) {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Errorf("Expected the loopback connection to be refused, got %v", err)
+	}
+	conn, err := NewGuard([]string{"127.0.0.1"}).DialContext(&net.Dialer{Timeout: time.Second})(ctx, "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected the allowed address to be dialed, got %v", err)
+	}
+	conn.Close()
+}